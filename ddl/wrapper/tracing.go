@@ -0,0 +1,112 @@
+package wrapper
+
+import (
+	"context"
+	"database/sql"
+	"github.com/unionj-cloud/go-doudou/svc/tracing"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+	"strings"
+)
+
+// NewTracedQuerier wraps q so that each query starts an OpenTelemetry span as child of the span in ctx
+func NewTracedQuerier(q Querier) Querier {
+	return tracedQuerier{q}
+}
+
+// NewTracedDB wraps db so that each query, including those in transactions, starts an OpenTelemetry span
+// as child of the span in ctx
+func NewTracedDB(db DB) DB {
+	return tracedDB{
+		tracedQuerier: tracedQuerier{db},
+		db:            db,
+	}
+}
+
+type tracedQuerier struct {
+	q Querier
+}
+
+// startSpan starts a span named by sql operation, such as SELECT
+func startSpan(ctx context.Context, query string) (context.Context, trace.Span) {
+	operation := "SQL"
+	if fields := strings.Fields(query); len(fields) > 0 {
+		operation = strings.ToUpper(fields[0])
+	}
+	return tracing.Start(ctx, operation, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBOperationKey.String(operation), semconv.DBStatementKey.String(query)))
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil && err != sql.ErrNoRows {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (t tracedQuerier) NamedExecContext(ctx context.Context, query string, arg interface{}) (sql.Result, error) {
+	ctx, span := startSpan(ctx, query)
+	result, err := t.q.NamedExecContext(ctx, query, arg)
+	endSpan(span, err)
+	return result, err
+}
+
+func (t tracedQuerier) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := startSpan(ctx, query)
+	result, err := t.q.ExecContext(ctx, query, args...)
+	endSpan(span, err)
+	return result, err
+}
+
+func (t tracedQuerier) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	ctx, span := startSpan(ctx, query)
+	err := t.q.GetContext(ctx, dest, query, args...)
+	endSpan(span, err)
+	return err
+}
+
+func (t tracedQuerier) Rebind(query string) string {
+	return t.q.Rebind(query)
+}
+
+func (t tracedQuerier) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	ctx, span := startSpan(ctx, query)
+	err := t.q.SelectContext(ctx, dest, query, args...)
+	endSpan(span, err)
+	return err
+}
+
+type tracedDB struct {
+	tracedQuerier
+	db DB
+}
+
+func (t tracedDB) BeginTxx(ctx context.Context, opts *sql.TxOptions) (Tx, error) {
+	tx, err := t.db.BeginTxx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return tracedTx{
+		tracedQuerier: tracedQuerier{tx},
+		tx:            tx,
+	}, nil
+}
+
+func (t tracedDB) Close() error {
+	return t.db.Close()
+}
+
+type tracedTx struct {
+	tracedQuerier
+	tx Tx
+}
+
+func (t tracedTx) Commit() error {
+	return t.tx.Commit()
+}
+
+func (t tracedTx) Rollback() error {
+	return t.tx.Rollback()
+}
@@ -0,0 +1,63 @@
+package wrapper
+
+import (
+	"context"
+	"database/sql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/svc/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"testing"
+)
+
+type mockQuerier struct {
+	err error
+}
+
+func (m mockQuerier) NamedExecContext(ctx context.Context, query string, arg interface{}) (sql.Result, error) {
+	return nil, m.err
+}
+
+func (m mockQuerier) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return nil, m.err
+}
+
+func (m mockQuerier) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return m.err
+}
+
+func (m mockQuerier) Rebind(query string) string {
+	return query
+}
+
+func (m mockQuerier) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return m.err
+}
+
+func TestNewTracedQuerier(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracing.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer tracing.SetTracerProvider(nil)
+
+	ctx, parent := tracing.Start(context.Background(), "GetUser")
+	q := NewTracedQuerier(mockQuerier{})
+	require.NoError(t, q.SelectContext(ctx, nil, "select * from user where id = ?", 1))
+	_, err := q.ExecContext(ctx, " update user set name = ?", "jack")
+	require.NoError(t, err)
+	assert.Equal(t, sql.ErrNoRows, NewTracedQuerier(mockQuerier{err: sql.ErrNoRows}).GetContext(ctx, nil, "select 1"))
+	_, err = NewTracedQuerier(mockQuerier{err: sql.ErrConnDone}).NamedExecContext(ctx, "insert into user", nil)
+	require.Error(t, err)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 4)
+	assert.Equal(t, "SELECT", spans[0].Name())
+	assert.Contains(t, spans[0].Attributes(), attribute.String("db.statement", "select * from user where id = ?"))
+	assert.Equal(t, parent.SpanContext().SpanID(), spans[0].Parent().SpanID())
+	assert.Equal(t, "UPDATE", spans[1].Name())
+	assert.Equal(t, codes.Unset, spans[2].Status().Code)
+	assert.Equal(t, codes.Error, spans[3].Status().Code)
+	assert.Equal(t, sql.ErrConnDone.Error(), spans[3].Status().Description)
+}
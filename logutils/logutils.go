@@ -1,19 +1,72 @@
 package logutils
 
 import (
+	"context"
 	"github.com/sirupsen/logrus"
 	"github.com/unionj-cloud/go-doudou/svc/config"
+	"strings"
 )
 
+const (
+	// FormatText is the default log format, which is human friendly
+	FormatText = "text"
+	// FormatJson outputs each log entry as a line of json, which is friendly to log collectors
+	FormatJson = "json"
+)
+
+const timestampFormat = "2006-01-02 15:04:05"
+
+// NewFormatter creates logrus.Formatter by GDD_LOG_FORMAT
+func NewFormatter() logrus.Formatter {
+	switch format := strings.ToLower(config.GddLogFormat.Load()); format {
+	case FormatJson:
+		return &logrus.JSONFormatter{
+			TimestampFormat: timestampFormat,
+		}
+	default:
+		if format != "" && format != FormatText {
+			logrus.Warnf("Unknown %s %s, use text instead.\n", config.GddLogFormat, format)
+		}
+		return &logrus.TextFormatter{
+			TimestampFormat: timestampFormat,
+			FullTimestamp:   true,
+		}
+	}
+}
+
 // NewLogger creates a logrus.Logger instance
 func NewLogger() *logrus.Logger {
 	logger := logrus.New()
-	formatter := new(logrus.TextFormatter)
-	formatter.TimestampFormat = "2006-01-02 15:04:05"
-	formatter.FullTimestamp = true
-	logger.SetFormatter(formatter)
+	logger.SetFormatter(NewFormatter())
 	var loglevel config.LogLevel
 	(&loglevel).Decode(config.GddLogLevel.Load())
 	logger.SetLevel(logrus.Level(loglevel))
 	return logger
 }
+
+type fieldsKey struct{}
+
+// WithFields returns a copy of ctx carrying fields merged with fields already in ctx.
+// Loggers returned by FromContext(ctx) log with all of them
+func WithFields(ctx context.Context, fields logrus.Fields) context.Context {
+	merged := make(logrus.Fields, len(fields))
+	if existing, ok := ctx.Value(fieldsKey{}).(logrus.Fields); ok {
+		for k, v := range existing {
+			merged[k] = v
+		}
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, fieldsKey{}, merged)
+}
+
+// FromContext returns logger of logrus standard logger with fields in ctx, such as requestId, traceId, route and user
+// put by ddhttp.Logger and ddhttp.BearerAuth middlewares
+func FromContext(ctx context.Context) *logrus.Entry {
+	entry := logrus.NewEntry(logrus.StandardLogger()).WithContext(ctx)
+	if fields, ok := ctx.Value(fieldsKey{}).(logrus.Fields); ok {
+		entry = entry.WithFields(fields)
+	}
+	return entry
+}
@@ -0,0 +1,30 @@
+package logutils
+
+import (
+	"context"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/unionj-cloud/go-doudou/svc/config"
+	"os"
+	"testing"
+)
+
+func TestNewFormatter(t *testing.T) {
+	assert.IsType(t, &logrus.TextFormatter{}, NewFormatter())
+	config.GddLogFormat.Write("JSON")
+	defer os.Unsetenv(config.GddLogFormat.String())
+	assert.IsType(t, &logrus.JSONFormatter{}, NewFormatter())
+}
+
+func TestFromContext(t *testing.T) {
+	ctx := WithFields(context.Background(), logrus.Fields{
+		"requestId": "abc",
+		"route":     "GetUser",
+	})
+	child := WithFields(ctx, logrus.Fields{
+		"user": "jack",
+	})
+	assert.Equal(t, logrus.Fields{"requestId": "abc", "route": "GetUser"}, FromContext(ctx).Data)
+	assert.Equal(t, logrus.Fields{"requestId": "abc", "route": "GetUser", "user": "jack"}, FromContext(child).Data)
+	assert.Empty(t, FromContext(context.Background()).Data)
+}
@@ -0,0 +1,340 @@
+package logutils
+
+import (
+	"compress/gzip"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/unionj-cloud/cast"
+	"github.com/unionj-cloud/go-doudou/stringutils"
+	"github.com/unionj-cloud/go-doudou/svc/config"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+const compressSuffix = ".gz"
+
+// RotateOptions configures RotatingFile. Zero values disable corresponding features
+type RotateOptions struct {
+	// MaxSize is the max bytes of the file before it gets rotated
+	MaxSize int64
+	// Interval rotates the file periodically, at multiples of Interval since the zero time in local time zone,
+	// such as every midnight for 24h
+	Interval time.Duration
+	// MaxBackups is the max number of rotated files to retain
+	MaxBackups int
+	// MaxAge is the max age of rotated files to retain
+	MaxAge time.Duration
+	// Compress gzips rotated files
+	Compress bool
+}
+
+// RotatingFile is an io.WriteCloser writing to a file which is rotated by size and time.
+// Rotated files are renamed with timestamp, such as app-2006-01-02T15-04-05.000.log, suffixed by a sequence number
+// such as app-2006-01-02T15-04-05.000-1.log if rotated more than once within the same millisecond, then compressed and removed by retention options in background
+type RotatingFile struct {
+	filename string
+	opts     RotateOptions
+	lock     sync.Mutex
+	file     *os.File
+	size     int64
+	next     time.Time
+	millLock sync.Mutex
+	wg       sync.WaitGroup
+	now      func() time.Time
+}
+
+// NewRotatingFile creates a RotatingFile instance writing to filename. Directory of filename is created if not exist
+func NewRotatingFile(filename string, opts RotateOptions) (*RotatingFile, error) {
+	r := &RotatingFile{
+		filename: filename,
+		opts:     opts,
+		now:      time.Now,
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), os.ModePerm); err != nil {
+		return nil, errors.Wrapf(err, "create log directory for %s failed", filename)
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// open opens or creates the file in append mode. Caller must hold r.lock
+func (r *RotatingFile) open() error {
+	file, err := os.OpenFile(r.filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "open log file %s failed", r.filename)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return errors.Wrapf(err, "stat log file %s failed", r.filename)
+	}
+	r.file = file
+	r.size = info.Size()
+	r.next = r.nextRotateTime()
+	return nil
+}
+
+func (r *RotatingFile) nextRotateTime() time.Time {
+	if r.opts.Interval <= 0 {
+		return time.Time{}
+	}
+	now := r.now()
+	// align to local time, so that 24h rotates at local midnight
+	_, offset := now.Zone()
+	shift := time.Duration(offset) * time.Second
+	return now.Add(shift).Truncate(r.opts.Interval).Add(r.opts.Interval).Add(-shift)
+}
+
+// Write writes p to the file, rotating it first if p would exceed MaxSize or Interval elapsed
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.file == nil {
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+	if (r.opts.MaxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.opts.MaxSize) ||
+		(!r.next.IsZero() && !r.now().Before(r.next)) {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// Rotate closes the file, renames it with timestamp and opens a new one
+func (r *RotatingFile) Rotate() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.rotate()
+}
+
+func (r *RotatingFile) rotate() error {
+	if r.file != nil {
+		if err := r.file.Close(); err != nil {
+			return errors.Wrapf(err, "close log file %s failed", r.filename)
+		}
+		r.file = nil
+	}
+	if _, err := os.Stat(r.filename); err == nil {
+		if err = os.Rename(r.filename, r.backupName(r.now())); err != nil {
+			return errors.Wrapf(err, "rename log file %s failed", r.filename)
+		}
+	}
+	if err := r.open(); err != nil {
+		return err
+	}
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.mill()
+	}()
+	return nil
+}
+
+// Reopen closes and reopens the file, so that a file moved away by external tools such as logrotate is recreated
+func (r *RotatingFile) Reopen() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.file != nil {
+		r.file.Close()
+		r.file = nil
+	}
+	return r.open()
+}
+
+// Close closes the file and waits for background compression and removal of rotated files
+func (r *RotatingFile) Close() error {
+	r.lock.Lock()
+	var err error
+	if r.file != nil {
+		err = r.file.Close()
+		r.file = nil
+	}
+	r.lock.Unlock()
+	r.wg.Wait()
+	return err
+}
+
+func (r *RotatingFile) prefixAndExt() (string, string) {
+	base := filepath.Base(r.filename)
+	ext := filepath.Ext(base)
+	return strings.TrimSuffix(base, ext) + "-", ext
+}
+
+// backupName returns the first name for rotating at t not taken by an existing backup, either compressed or not
+func (r *RotatingFile) backupName(t time.Time) string {
+	prefix, ext := r.prefixAndExt()
+	stamp := prefix + t.Format(backupTimeFormat)
+	name := filepath.Join(filepath.Dir(r.filename), stamp+ext)
+	for i := 1; exists(name) || exists(name+compressSuffix); i++ {
+		name = filepath.Join(filepath.Dir(r.filename), stamp+"-"+strconv.Itoa(i)+ext)
+	}
+	return name
+}
+
+func exists(name string) bool {
+	_, err := os.Lstat(name)
+	return err == nil
+}
+
+type backup struct {
+	path      string
+	timestamp time.Time
+	// seq is the sequence number of backups rotated within the same millisecond
+	seq int
+}
+
+// parseBackup parses timestamp and sequence number from name of a rotated file without prefix and extension
+func parseBackup(name string) (time.Time, int, error) {
+	stamp, seq := name, 0
+	if len(name) > len(backupTimeFormat) {
+		stamp = name[:len(backupTimeFormat)]
+		if name[len(backupTimeFormat)] != '-' {
+			return time.Time{}, 0, errors.Errorf("invalid backup name %s", name)
+		}
+		var err error
+		if seq, err = strconv.Atoi(name[len(backupTimeFormat)+1:]); err != nil || seq < 1 {
+			return time.Time{}, 0, errors.Errorf("invalid backup name %s", name)
+		}
+	}
+	t, err := time.ParseInLocation(backupTimeFormat, stamp, time.Local)
+	if err != nil {
+		return time.Time{}, 0, errors.WithStack(err)
+	}
+	return t, seq, nil
+}
+
+// backups returns rotated files sorted from newest to oldest
+func (r *RotatingFile) backups() ([]backup, error) {
+	infos, err := ioutil.ReadDir(filepath.Dir(r.filename))
+	if err != nil {
+		return nil, errors.Wrap(err, "read log directory failed")
+	}
+	prefix, ext := r.prefixAndExt()
+	var backups []backup
+	for _, info := range infos {
+		if info.IsDir() {
+			continue
+		}
+		name := strings.TrimSuffix(info.Name(), compressSuffix)
+		if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		t, seq, err := parseBackup(strings.TrimSuffix(strings.TrimPrefix(name, prefix), ext))
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backup{
+			path:      filepath.Join(filepath.Dir(r.filename), info.Name()),
+			timestamp: t,
+			seq:       seq,
+		})
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		if backups[i].timestamp.Equal(backups[j].timestamp) {
+			return backups[i].seq > backups[j].seq
+		}
+		return backups[i].timestamp.After(backups[j].timestamp)
+	})
+	return backups, nil
+}
+
+// mill removes rotated files by retention options and compresses the rest
+func (r *RotatingFile) mill() {
+	r.millLock.Lock()
+	defer r.millLock.Unlock()
+	backups, err := r.backups()
+	if err != nil {
+		logrus.Warnf("Clean rotated log files failed: %+v\n", err)
+		return
+	}
+	cutoff := r.now().Add(-r.opts.MaxAge)
+	for i, b := range backups {
+		if (r.opts.MaxBackups > 0 && i >= r.opts.MaxBackups) || (r.opts.MaxAge > 0 && b.timestamp.Before(cutoff)) {
+			if err = os.Remove(b.path); err != nil {
+				logrus.Warnf("Remove rotated log file %s failed: %s\n", b.path, err.Error())
+			}
+			continue
+		}
+		if r.opts.Compress && !strings.HasSuffix(b.path, compressSuffix) {
+			if err = compress(b.path); err != nil {
+				logrus.Warnf("Compress rotated log file %s failed: %+v\n", b.path, err)
+			}
+		}
+	}
+}
+
+// compress gzips src to src.gz then removes src
+func compress(src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer in.Close()
+	out, err := os.OpenFile(src+compressSuffix, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	gz := gzip.NewWriter(out)
+	if _, err = io.Copy(gz, in); err != nil {
+		out.Close()
+		os.Remove(src + compressSuffix)
+		return errors.WithStack(err)
+	}
+	if err = gz.Close(); err != nil {
+		out.Close()
+		os.Remove(src + compressSuffix)
+		return errors.WithStack(err)
+	}
+	if err = out.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+	in.Close()
+	return os.Remove(src)
+}
+
+const (
+	defaultMaxSize    = 100
+	defaultMaxBackups = 10
+)
+
+// RotateOptionsFromEnv loads RotateOptions from GDD_LOG_MAX_SIZE, GDD_LOG_ROTATE_INTERVAL, GDD_LOG_MAX_BACKUPS,
+// GDD_LOG_MAX_AGE and GDD_LOG_COMPRESS
+func RotateOptionsFromEnv() RotateOptions {
+	opts := RotateOptions{
+		MaxSize:    defaultMaxSize << 20,
+		MaxBackups: defaultMaxBackups,
+		Compress:   config.GddLogCompress.Load() == "true",
+	}
+	if raw := config.GddLogMaxSize.Load(); stringutils.IsNotEmpty(raw) {
+		opts.MaxSize = cast.ToInt64(raw) << 20
+	}
+	if raw := config.GddLogMaxBackups.Load(); stringutils.IsNotEmpty(raw) {
+		opts.MaxBackups = cast.ToInt(raw)
+	}
+	opts.MaxAge = time.Duration(cast.ToInt(config.GddLogMaxAge.Load())) * 24 * time.Hour
+	if raw := config.GddLogRotateInterval.Load(); stringutils.IsNotEmpty(raw) {
+		interval, err := time.ParseDuration(raw)
+		if err != nil {
+			logrus.Warnf("Parse %s %s as time.Duration failed: %s, ignore it.\n", config.GddLogRotateInterval, raw, err.Error())
+		} else {
+			opts.Interval = interval
+		}
+	}
+	return opts
+}
@@ -0,0 +1,191 @@
+package logutils
+
+import (
+	"compress/gzip"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/svc/config"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	lock sync.Mutex
+	now  time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Set(now time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = now
+}
+
+func listDir(t *testing.T, dir string) []string {
+	infos, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestRotatingFile_MaxSize(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "log", "app.log")
+	r, err := NewRotatingFile(filename, RotateOptions{
+		MaxSize:    10,
+		MaxBackups: 2,
+	})
+	require.NoError(t, err)
+	clock := &fakeClock{}
+	r.now = clock.Now
+	for i, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		clock.Set(time.Date(2021, 1, 1, 0, 0, i, 0, time.Local))
+		_, err = r.Write([]byte(line))
+		require.NoError(t, err)
+	}
+	require.NoError(t, r.Close())
+
+	assert.Equal(t, []string{"app-2021-01-01T00-00-02.000.log", "app-2021-01-01T00-00-03.000.log", "app.log"}, listDir(t, filepath.Dir(filename)))
+	data, _ := ioutil.ReadFile(filename)
+	assert.Equal(t, "fourth\n", string(data))
+	data, _ = ioutil.ReadFile(filepath.Join(dir, "log", "app-2021-01-01T00-00-03.000.log"))
+	assert.Equal(t, "third\n", string(data))
+}
+
+func TestRotatingFile_Interval(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "app.log")
+	r, err := NewRotatingFile(filename, RotateOptions{
+		Interval: time.Hour,
+		Compress: true,
+	})
+	require.NoError(t, err)
+	clock := &fakeClock{now: time.Date(2021, 1, 1, 0, 30, 0, 0, time.Local)}
+	r.now = clock.Now
+	r.next = r.nextRotateTime()
+	assert.Equal(t, time.Date(2021, 1, 1, 1, 0, 0, 0, time.Local), r.next)
+	clock.Set(time.Date(2021, 1, 1, 0, 50, 0, 0, time.Local))
+	_, err = r.Write([]byte("before\n"))
+	require.NoError(t, err)
+	clock.Set(time.Date(2021, 1, 1, 1, 10, 0, 0, time.Local))
+	_, err = r.Write([]byte("after\n"))
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+
+	assert.Equal(t, []string{"app-2021-01-01T01-10-00.000.log.gz", "app.log"}, listDir(t, dir))
+	f, err := os.Open(filepath.Join(dir, "app-2021-01-01T01-10-00.000.log.gz"))
+	require.NoError(t, err)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	data, _ := ioutil.ReadAll(gz)
+	assert.Equal(t, "before\n", string(data))
+}
+
+func TestRotatingFile_MaxAge(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "app.log")
+	old := filepath.Join(dir, "app-2020-12-01T00-00-00.000.log.gz")
+	recent := filepath.Join(dir, "app-2020-12-31T00-00-00.000.log")
+	require.NoError(t, ioutil.WriteFile(old, []byte("old"), 0644))
+	require.NoError(t, ioutil.WriteFile(recent, []byte("recent"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "other.log"), []byte("other"), 0644))
+	r, err := NewRotatingFile(filename, RotateOptions{
+		MaxAge: 7 * 24 * time.Hour,
+	})
+	require.NoError(t, err)
+	r.now = (&fakeClock{now: time.Date(2021, 1, 1, 0, 0, 1, 0, time.Local)}).Now
+	require.NoError(t, r.Rotate())
+	require.NoError(t, r.Close())
+	assert.Equal(t, []string{"app-2020-12-31T00-00-00.000.log", "app-2021-01-01T00-00-01.000.log", "app.log", "other.log"}, listDir(t, dir))
+}
+
+func TestRotatingFile_SameMillisecond(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "app.log")
+	// compressed backup of the same millisecond is not overwritten either
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "app-2021-01-01T00-00-00.000.log.gz"), []byte("gz"), 0644))
+	r, err := NewRotatingFile(filename, RotateOptions{
+		MaxSize:    5,
+		MaxBackups: 3,
+	})
+	require.NoError(t, err)
+	r.now = (&fakeClock{now: time.Date(2021, 1, 1, 0, 0, 0, 0, time.Local)}).Now
+	for _, line := range []string{"1111\n", "2222\n", "3333\n", "4444\n"} {
+		_, err = r.Write([]byte(line))
+		require.NoError(t, err)
+	}
+	require.NoError(t, r.Close())
+
+	// the oldest one is removed by MaxBackups
+	assert.Equal(t, []string{"app-2021-01-01T00-00-00.000-1.log", "app-2021-01-01T00-00-00.000-2.log",
+		"app-2021-01-01T00-00-00.000-3.log", "app.log"}, listDir(t, dir))
+	for name, want := range map[string]string{
+		"app-2021-01-01T00-00-00.000-1.log": "1111\n",
+		"app-2021-01-01T00-00-00.000-2.log": "2222\n",
+		"app-2021-01-01T00-00-00.000-3.log": "3333\n",
+		"app.log":                           "4444\n",
+	} {
+		data, _ := ioutil.ReadFile(filepath.Join(dir, name))
+		assert.Equal(t, want, string(data), name)
+	}
+}
+
+func TestRotatingFile_Reopen(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "app.log")
+	r, err := NewRotatingFile(filename, RotateOptions{})
+	require.NoError(t, err)
+	defer r.Close()
+	_, err = r.Write([]byte("first\n"))
+	require.NoError(t, err)
+	// moved away by logrotate
+	require.NoError(t, os.Rename(filename, filename+".1"))
+	require.NoError(t, r.Reopen())
+	_, err = r.Write([]byte("second\n"))
+	require.NoError(t, err)
+	data, _ := ioutil.ReadFile(filename)
+	assert.Equal(t, "second\n", string(data))
+	data, _ = ioutil.ReadFile(filename + ".1")
+	assert.Equal(t, "first\n", string(data))
+}
+
+func TestRotateOptionsFromEnv(t *testing.T) {
+	assert.Equal(t, RotateOptions{
+		MaxSize:    100 << 20,
+		MaxBackups: 10,
+	}, RotateOptionsFromEnv())
+
+	config.GddLogMaxSize.Write("0")
+	config.GddLogRotateInterval.Write("24h")
+	config.GddLogMaxBackups.Write("3")
+	config.GddLogMaxAge.Write("7")
+	config.GddLogCompress.Write("true")
+	defer func() {
+		os.Unsetenv(config.GddLogMaxSize.String())
+		os.Unsetenv(config.GddLogRotateInterval.String())
+		os.Unsetenv(config.GddLogMaxBackups.String())
+		os.Unsetenv(config.GddLogMaxAge.String())
+		os.Unsetenv(config.GddLogCompress.String())
+	}()
+	assert.Equal(t, RotateOptions{
+		Interval:   24 * time.Hour,
+		MaxBackups: 3,
+		MaxAge:     7 * 24 * time.Hour,
+		Compress:   true,
+	}, RotateOptionsFromEnv())
+}
@@ -49,6 +49,7 @@ import (
 	ddhttp "github.com/unionj-cloud/go-doudou/svc/http"
 	v3 "github.com/unionj-cloud/go-doudou/openapi/v3"
 	"io"
+	"io/ioutil"
 	"mime/multipart"
 	"net/url"
 	"os"
@@ -88,7 +89,7 @@ func (receiver *{{.Meta.Name}}Client) SetClient(client *resty.Client) {
 			_server string
 			_err error
 		)
-		if _server, _err = receiver.provider.SelectServer(); _err != nil {
+		if _server, _err = ddhttp.SelectServer(ctx, receiver.provider); _err != nil {
 			err = errors.Wrap(_err, "")
 			return
 		}
@@ -129,9 +130,14 @@ func (receiver *{{.Meta.Name}}Client) SetClient(client *resty.Client) {
 			{{- end }}
 		{{- end }}
 
+		{{- $events := false }}
 		{{- range $r := $m.Results }}
 			{{- if eq $r.Type "*os.File" }}
 				_req.SetDoNotParseResponse(true)
+			{{- else if contains $r.Type "<-chan " }}
+				_req.SetDoNotParseResponse(true)
+				_req.SetHeader("Accept", "text/event-stream")
+				{{- $events = true }}
 			{{- end }}
 		{{- end }}
 
@@ -141,7 +147,13 @@ func (receiver *{{.Meta.Name}}Client) SetClient(client *resty.Client) {
 			return
 		}
 		if _resp.IsError() {
+			{{- if $events }}
+			defer _resp.RawBody().Close()
+			_body, _ := ioutil.ReadAll(_resp.RawBody())
+			err = errors.New(string(_body))
+			{{- else }}
 			err = errors.New(_resp.String())
+			{{- end }}
 			return
 		}
 		{{- $done := false }}
@@ -173,6 +185,27 @@ func (receiver *{{.Meta.Name}}Client) SetClient(client *resty.Client) {
 				{{ $r.Name }} = _outFile
 				return
 				{{- $done = true }}	
+			{{- else if contains $r.Type "<-chan " }}
+				_events := make(chan {{ $r.Type | chanElem }})
+				go func() {
+					defer close(_events)
+					defer _resp.RawBody().Close()
+					_reader := ddhttp.NewEventReader(_resp.RawBody())
+					for {
+						var _item {{ $r.Type | chanElem }}
+						if _err := _reader.Next(&_item); _err != nil {
+							return
+						}
+						select {
+						case _events <- _item:
+						case <-ctx.Done():
+							return
+						}
+					}
+				}()
+				{{ $r.Name }} = _events
+				return
+				{{- $done = true }}
 			{{- end }}
 		{{- end }}
 		{{- if not $done }}
@@ -242,6 +275,11 @@ func restyMethod(method string) string {
 	return strings.Title(strings.ToLower(httpMethod(method)))
 }
 
+// chanElem returns element type of channel result type for Server-Sent Events
+func chanElem(t string) string {
+	return strings.TrimPrefix(t, "<-chan ")
+}
+
 func genGoHTTP(paths map[string]v3.Path, svcname, dir, env, pkg string) {
 	_ = os.MkdirAll(dir, os.ModePerm)
 	output := filepath.Join(dir, svcname+"client.go")
@@ -265,6 +303,7 @@ func genGoHTTP(paths map[string]v3.Path, svcname, dir, env, pkg string) {
 	funcMap["contains"] = strings.Contains
 	funcMap["restyMethod"] = restyMethod
 	funcMap["toUpper"] = strings.ToUpper
+	funcMap["chanElem"] = chanElem
 	tpl, _ := template.New("http.go.tmpl").Funcs(funcMap).Parse(httptmpl)
 	var sqlBuf bytes.Buffer
 	_ = tpl.Execute(&sqlBuf, struct {
@@ -416,6 +455,11 @@ func responseBody(endpoint, httpMethod string, operation *v3.Operation) (results
 			Name: "_downloadFile",
 			Type: "*os.File",
 		})
+	} else if content.EventStream != nil {
+		// each Server-Sent Event carries an element as json
+		ret := schema2Field(content.EventStream.Schema, "ret")
+		ret.Type = "<-chan " + ret.Type
+		results = append(results, *ret)
 	} else if content.TextPlain != nil {
 		results = append(results, *schema2Field(content.TextPlain.Schema, "ret"))
 	} else if content.Default != nil {
@@ -77,12 +77,13 @@ type MediaType struct {
 // and the value describes it. For requests that match multiple keys, only the most specific key is applicable.
 // e.g. text/plain overrides text/*
 type Content struct {
-	TextPlain *MediaType `json:"text/plain,omitempty"`
-	JSON      *MediaType `json:"application/json,omitempty"`
-	FormURL   *MediaType `json:"application/x-www-form-urlencoded,omitempty"`
-	Stream    *MediaType `json:"application/octet-stream,omitempty"`
-	FormData  *MediaType `json:"multipart/form-data,omitempty"`
-	Default   *MediaType `json:"*/*,omitempty"`
+	TextPlain   *MediaType `json:"text/plain,omitempty"`
+	JSON        *MediaType `json:"application/json,omitempty"`
+	FormURL     *MediaType `json:"application/x-www-form-urlencoded,omitempty"`
+	Stream      *MediaType `json:"application/octet-stream,omitempty"`
+	FormData    *MediaType `json:"multipart/form-data,omitempty"`
+	EventStream *MediaType `json:"text/event-stream,omitempty"`
+	Default     *MediaType `json:"*/*,omitempty"`
 }
 
 // Parameter https://spec.openapis.org/oas/v3.0.3#parameter-object
@@ -150,10 +151,10 @@ type Callback struct {
 	// TODO
 }
 
-// Security not implemented yet
-type Security struct {
-	// TODO
-}
+// Security https://spec.openapis.org/oas/v3.0.3#security-requirement-object
+// key is name of a security scheme declared in Components.SecuritySchemes,
+// value is required scope names for oauth2 or openIdConnect, otherwise empty
+type Security map[string][]string
 
 // Operation https://spec.openapis.org/oas/v3.0.3#operation-object
 type Operation struct {
@@ -181,9 +182,46 @@ type Path struct {
 	Parameters []Parameter `json:"parameters,omitempty"`
 }
 
+// SecuritySchemeType is type of security scheme
+type SecuritySchemeType string
+
+const (
+	// APIKeySecurity api key in header, query or cookie
+	APIKeySecurity SecuritySchemeType = "apiKey"
+	// HTTPSecurity http authentication such as basic and bearer
+	HTTPSecurity SecuritySchemeType = "http"
+	// OAuth2Security oauth2 flows
+	OAuth2Security SecuritySchemeType = "oauth2"
+	// OpenIDConnectSecurity openid connect discovery
+	OpenIDConnectSecurity SecuritySchemeType = "openIdConnect"
+)
+
 // SecurityScheme https://spec.openapis.org/oas/v3.0.3#security-scheme-object
 type SecurityScheme struct {
-	// TODO
+	Type             SecuritySchemeType `json:"type,omitempty"`
+	Description      string             `json:"description,omitempty"`
+	Name             string             `json:"name,omitempty"`
+	In               string             `json:"in,omitempty"`
+	Scheme           string             `json:"scheme,omitempty"`
+	BearerFormat     string             `json:"bearerFormat,omitempty"`
+	Flows            *OAuthFlows        `json:"flows,omitempty"`
+	OpenIDConnectURL string             `json:"openIdConnectUrl,omitempty"`
+}
+
+// OAuthFlows https://spec.openapis.org/oas/v3.0.3#oauth-flows-object
+type OAuthFlows struct {
+	Implicit          *OAuthFlow `json:"implicit,omitempty"`
+	Password          *OAuthFlow `json:"password,omitempty"`
+	ClientCredentials *OAuthFlow `json:"clientCredentials,omitempty"`
+	AuthorizationCode *OAuthFlow `json:"authorizationCode,omitempty"`
+}
+
+// OAuthFlow https://spec.openapis.org/oas/v3.0.3#oauth-flow-object
+type OAuthFlow struct {
+	AuthorizationURL string            `json:"authorizationUrl,omitempty"`
+	TokenURL         string            `json:"tokenUrl,omitempty"`
+	RefreshURL       string            `json:"refreshUrl,omitempty"`
+	Scopes           map[string]string `json:"scopes"`
 }
 
 // Discriminator https://spec.openapis.org/oas/v3.0.3#discriminator-object
@@ -41,8 +41,35 @@ const (
 	GddLogLevel envVariable = "GDD_LOG_LEVEL"
 	// GddLogPath sets log path
 	GddLogPath envVariable = "GDD_LOG_PATH"
+	// GddLogMaxSize sets max megabytes of the log file under GddLogPath before it gets rotated. Default is 100.
+	// Size based rotation is disabled if it is 0
+	GddLogMaxSize envVariable = "GDD_LOG_MAX_SIZE"
+	// GddLogRotateInterval rotates the log file periodically, such as 24h for every midnight. Disabled if empty or not set
+	GddLogRotateInterval envVariable = "GDD_LOG_ROTATE_INTERVAL"
+	// GddLogMaxBackups sets max number of rotated log files to retain. Default is 10. All are retained if it is 0
+	GddLogMaxBackups envVariable = "GDD_LOG_MAX_BACKUPS"
+	// GddLogMaxAge sets max days to retain rotated log files. Rotated log files are not removed by age if it is 0 or not set
+	GddLogMaxAge envVariable = "GDD_LOG_MAX_AGE"
+	// GddLogCompress accepts true or false, if true, rotated log files are compressed by gzip
+	GddLogCompress envVariable = "GDD_LOG_COMPRESS"
+	// GddLogFormat accepts text or json. Default is text
+	GddLogFormat envVariable = "GDD_LOG_FORMAT"
+	// GddLogBodyLimit sets max bytes of request body and response body logged by ddhttp.Logger middleware. Default is 4096.
+	// Bodies are not logged if it is 0 or negative
+	GddLogBodyLimit envVariable = "GDD_LOG_BODY_LIMIT"
+	// GddLogRedactHeaders sets headers whose values are masked by ddhttp.Logger middleware.
+	// Default is Authorization,Proxy-Authorization,Cookie,Set-Cookie
+	GddLogRedactHeaders envVariable = "GDD_LOG_REDACT_HEADERS"
+	// GddLogRedactFields sets json and form fields whose values are masked by ddhttp.Logger middleware. Fields whose
+	// names contain any of them are masked, such as access_token and client_secret. Default is password,secret,token
+	GddLogRedactFields envVariable = "GDD_LOG_REDACT_FIELDS"
 	// GddGraceTimeout sets graceful shutdown timeout
 	GddGraceTimeout envVariable = "GDD_GRACE_TIMEOUT"
+	// GddStartTimeout sets timeout for running each start hook registered by Srv.OnStart
+	GddStartTimeout envVariable = "GDD_START_TIMEOUT"
+	// GddPreStopDelay sets delay between failing readiness and stopping http server on shutdown, such as 5s,
+	// so that load balancers stop sending requests. It counts in GddGraceTimeout
+	GddPreStopDelay envVariable = "GDD_PRESTOP_DELAY"
 	// GddWriteTimeout sets http connection write timeout
 	GddWriteTimeout envVariable = "GDD_WRITE_TIMEOUT"
 	// GddReadTimeout sets http connection read timeout
@@ -67,6 +94,89 @@ const (
 	GddManageUser envVariable = "GDD_MANAGE_USER"
 	// GddManagePass manage api endpoint http basic auth password
 	GddManagePass envVariable = "GDD_MANAGE_PASS"
+	// GddJwtSecret sets HMAC secret for validating HS256, HS384 and HS512 signed bearer tokens
+	GddJwtSecret envVariable = "GDD_JWT_SECRET"
+	// GddJwtJwks sets path of a local JWKS file for validating RS256, RS384, RS512, ES256, ES384 and ES512 signed bearer tokens
+	GddJwtJwks envVariable = "GDD_JWT_JWKS"
+	// GddJwtIssuer if not empty, iss claim of bearer tokens must be equal to it
+	GddJwtIssuer envVariable = "GDD_JWT_ISSUER"
+	// GddJwtAudience if not empty, aud claim of bearer tokens must contain it
+	GddJwtAudience envVariable = "GDD_JWT_AUDIENCE"
+	// GddJwtLeeway sets allowed clock skew when validating exp and nbf claims, such as 30s
+	GddJwtLeeway envVariable = "GDD_JWT_LEEWAY"
+	// GddJwtRolesClaim sets claim name of user roles for checking roles declared by @role annotation. Default is roles
+	GddJwtRolesClaim envVariable = "GDD_JWT_ROLES_CLAIM"
+	// GddJwtAllowNoExp accepts true or false, if true, bearer tokens without exp claim are accepted. Default is false
+	GddJwtAllowNoExp envVariable = "GDD_JWT_ALLOW_NO_EXP"
+	// GddRateLimitRoutes sets rate limits per route name for ddhttp.RateLimit middleware,
+	// such as GetUser=10/s,PageUsers=100/m:150. The number after colon is burst
+	GddRateLimitRoutes envVariable = "GDD_RATELIMIT_ROUTES"
+	// GddRateLimitIp sets rate limit per client ip for ddhttp.RateLimit middleware, such as 20/s:40
+	GddRateLimitIp envVariable = "GDD_RATELIMIT_IP"
+	// GddRateLimitMaxKeys sets max number of keys such as client ips tracked by each policy of ddhttp.RateLimit middleware,
+	// least recently used keys are evicted when exceeded. Default is 10000, 0 means unlimited
+	GddRateLimitMaxKeys envVariable = "GDD_RATELIMIT_MAX_KEYS"
+	// GddRouteTimeout sets default request timeout for each route for ddhttp.Timeout middleware, such as 10s.
+	// Context of the request will be cancelled after timeout
+	GddRouteTimeout envVariable = "GDD_ROUTE_TIMEOUT"
+	// GddRouteTimeouts sets request timeout per route name for ddhttp.Timeout middleware, such as GetUser=3s,PageUsers=10s
+	GddRouteTimeouts envVariable = "GDD_ROUTE_TIMEOUTS"
+	// GddRouteConcurrency sets default max concurrent requests for each route for ddhttp.Bulkhead middleware
+	GddRouteConcurrency envVariable = "GDD_ROUTE_CONCURRENCY"
+	// GddRouteConcurrencies sets max concurrent requests per route name for ddhttp.Bulkhead middleware, such as GetUser=10,PageUsers=50
+	GddRouteConcurrencies envVariable = "GDD_ROUTE_CONCURRENCIES"
+	// GddCacheTtl sets default ttl of cached responses for each route for ddhttp.Cache middleware, such as 1m.
+	// If empty or not set, responses are not stored, but ETag is still computed
+	GddCacheTtl envVariable = "GDD_CACHE_TTL"
+	// GddCacheTtls sets ttl of cached responses per route name for ddhttp.Cache middleware, such as GetUser=30s,PageUsers=0s
+	GddCacheTtls envVariable = "GDD_CACHE_TTLS"
+	// GddCacheSize sets max number of responses held by in-memory LRU store of ddhttp.Cache middleware. Default is 1000
+	GddCacheSize envVariable = "GDD_CACHE_SIZE"
+	// GddShedMaxInflight ddhttp.LoadShedding middleware rejects requests when in-flight requests exceed it
+	GddShedMaxInflight envVariable = "GDD_SHED_MAX_INFLIGHT"
+	// GddShedMaxLatency ddhttp.LoadShedding middleware starts rejecting part of requests
+	// when moving average of request latency exceeds it, such as 500ms
+	GddShedMaxLatency envVariable = "GDD_SHED_MAX_LATENCY"
+	// GddCorsAllowedOrigins sets allowed origins for ddhttp.Cors middleware, such as https://example.com,https://*.example.com.
+	// * allows all origins. If empty or not set, cors is disabled
+	GddCorsAllowedOrigins envVariable = "GDD_CORS_ALLOWED_ORIGINS"
+	// GddCorsAllowedMethods sets allowed methods for ddhttp.Cors middleware. Default is GET,POST,PUT,PATCH,DELETE,HEAD
+	GddCorsAllowedMethods envVariable = "GDD_CORS_ALLOWED_METHODS"
+	// GddCorsAllowedHeaders sets allowed request headers for ddhttp.Cors middleware.
+	// Default is Origin,Accept,Content-Type,Authorization,X-Requested-With,X-Request-ID. * allows all headers
+	GddCorsAllowedHeaders envVariable = "GDD_CORS_ALLOWED_HEADERS"
+	// GddCorsExposedHeaders sets response headers which browsers are allowed to access for ddhttp.Cors middleware
+	GddCorsExposedHeaders envVariable = "GDD_CORS_EXPOSED_HEADERS"
+	// GddCorsAllowCredentials accepts true or false, if true, cookies and authorization headers are allowed in cross-origin requests
+	GddCorsAllowCredentials envVariable = "GDD_CORS_ALLOW_CREDENTIALS"
+	// GddCorsMaxAge sets how long in second the results of a preflight request can be cached by browsers
+	GddCorsMaxAge envVariable = "GDD_CORS_MAX_AGE"
+	// GddTlsCert sets path of the certificate file. If both GddTlsCert and GddTlsKey are set, https will be served.
+	// The certificate is also used as client certificate by clients created by ddhttp.NewClient
+	GddTlsCert envVariable = "GDD_TLS_CERT"
+	// GddTlsKey sets path of the private key file matching GddTlsCert
+	GddTlsKey envVariable = "GDD_TLS_KEY"
+	// GddTlsCa sets path of the CA certificate file. If set, client certificates signed by it are required (mTLS)
+	// except for health endpoints requested by kubernetes probes, and clients created by ddhttp.NewClient trust servers whose certificates are signed by it
+	GddTlsCa envVariable = "GDD_TLS_CA"
+	// GddH2c accepts true or false, if true, http server serves HTTP/2 over cleartext tcp (h2c) besides HTTP/1.1.
+	// It is ignored when tls is enabled because HTTP/2 is always served over tls
+	GddH2c envVariable = "GDD_H2C"
+	// GddTracingExporter sets where OpenTelemetry spans are exported, accepts none, stdout, otlp or zipkin.
+	// Default is none, which still propagates W3C trace context but doesn't export spans
+	GddTracingExporter envVariable = "GDD_TRACING_EXPORTER"
+	// GddTracingEndpoint sets collector url for otlp and zipkin exporters. Default is http://localhost:4318/v1/traces
+	// for otlp, and http://localhost:9411/api/v2/spans for zipkin
+	GddTracingEndpoint envVariable = "GDD_TRACING_ENDPOINT"
+	// GddTracingSampleRatio sets ratio between 0 and 1 of traces to be sampled. Default is 1.
+	// Requests carrying traceparent header follow sampling decision of the caller
+	GddTracingSampleRatio envVariable = "GDD_TRACING_SAMPLE_RATIO"
+	// GddPrometheusDurationBuckets sets buckets in seconds for http_response_time_seconds and http_client_request_duration_seconds
+	// histograms, such as 0.01,0.05,0.1,0.5,1,5. Default is prometheus.DefBuckets
+	GddPrometheusDurationBuckets envVariable = "GDD_PROMETHEUS_DURATION_BUCKETS"
+	// GddPrometheusSizeBuckets sets buckets in bytes for http_request_size_bytes and http_response_size_bytes histograms,
+	// such as 100,1000,10000. Default is 100,1000,10000,100000,1e+06,1e+07
+	GddPrometheusSizeBuckets envVariable = "GDD_PROMETHEUS_SIZE_BUCKETS"
 	// GddMemSeed sets cluster seeds for joining
 	GddMemSeed envVariable = "GDD_MEM_SEED"
 	// GddMemName unique name of this node in cluster. if empty or not set, hostname will be used instead
@@ -87,8 +197,74 @@ const (
 	// GddMemReclaimTimeout dead node will be replaced with new node with the same name but different full address in GddMemReclaimTimeout second
 	// expose DeadNodeReclaimTime property of memberlist.Config
 	GddMemReclaimTimeout envVariable = "GDD_MEM_RECLAIM_TIMEOUT"
+	// GddMemProfile selects default memberlist config: lan, wan or local. Default is wan
+	GddMemProfile envVariable = "GDD_MEM_PROFILE"
+	// GddMemProbeInterval sets interval between failure probes of random nodes, such as 1s
+	GddMemProbeInterval envVariable = "GDD_MEM_PROBE_INTERVAL"
+	// GddMemProbeTimeout sets timeout of a failure probe, should not be greater than GddMemProbeInterval
+	GddMemProbeTimeout envVariable = "GDD_MEM_PROBE_TIMEOUT"
+	// GddMemSuspicionMult sets multiplier of timeout before a suspect node is declared dead
+	GddMemSuspicionMult envVariable = "GDD_MEM_SUSPICION_MULT"
+	// GddMemGossipInterval sets interval between gossip messages, such as 200ms
+	GddMemGossipInterval envVariable = "GDD_MEM_GOSSIP_INTERVAL"
+	// GddMemGossipNodes sets number of random nodes gossip messages are sent to per GddMemGossipInterval
+	GddMemGossipNodes envVariable = "GDD_MEM_GOSSIP_NODES"
+	// GddMemRetransmitMult sets multiplier of retransmissions of broadcast messages
+	GddMemRetransmitMult envVariable = "GDD_MEM_RETRANSMIT_MULT"
+	// GddMemTCPTimeout sets timeout of tcp connections for push/pull sync and probes
+	GddMemTCPTimeout envVariable = "GDD_MEM_TCP_TIMEOUT"
+	// GddMemIndirectChecks sets number of nodes asked to probe a node indirectly when direct probe failed
+	GddMemIndirectChecks envVariable = "GDD_MEM_INDIRECT_CHECKS"
+	// GddMemTags sets tags of this node in registry meta data, such as zone=us-east-1a,version=v2
+	GddMemTags envVariable = "GDD_MEM_TAGS"
+	// GddMemSecret sets base64 encoded key of 16, 24 or 32 bytes for gossip encryption
+	GddMemSecret envVariable = "GDD_MEM_SECRET"
+	// GddMemKeyring sets comma separated base64 encoded keys for gossip encryption. The first one is primary
+	// if GddMemSecret is not set, the others are only used for decrypting messages during key rotation
+	GddMemKeyring envVariable = "GDD_MEM_KEYRING"
+	// GddMemCluster sets cluster name, nodes of other clusters are rejected
+	GddMemCluster envVariable = "GDD_MEM_CLUSTER"
+	// GddMemMetaCodec sets encoding of node meta data, accepts json or msgpack. Default is json, which nodes of
+	// older versions can read. Switch to msgpack for compact meta data after all nodes of the cluster are upgraded
+	GddMemMetaCodec envVariable = "GDD_MEM_META_CODEC"
+	// GddMemSuspectTimeout nodes not answering probes of this node within it are skipped by clients, such as 10s.
+	// Default is twice the time of probing all nodes, 0 disables it
+	GddMemSuspectTimeout envVariable = "GDD_MEM_SUSPECT_TIMEOUT"
+	// GddOutlierErrors clients stop sending requests to a node for a while after GddOutlierErrors consecutive failures.
+	// Default is 5, 0 disables outlier ejection
+	GddOutlierErrors envVariable = "GDD_OUTLIER_ERRORS"
+	// GddOutlierLatency requests slower than it are counted as failures for outlier ejection, such as 2s. Empty disables it
+	GddOutlierLatency envVariable = "GDD_OUTLIER_LATENCY"
+	// GddOutlierBackoff sets duration of the first ejection of a node, doubled on each ejection in a row. Default is 30s
+	GddOutlierBackoff envVariable = "GDD_OUTLIER_BACKOFF"
+	// GddOutlierMaxBackoff sets max duration of ejections. Default is 5m
+	GddOutlierMaxBackoff envVariable = "GDD_OUTLIER_MAX_BACKOFF"
+	// GddRouteVersions sets comma separated versions accepted from X-Route-Version header by ddhttp.VersionRouting
+	// middleware, such as v1,v2. Other values are ignored. Empty accepts any value
+	GddRouteVersions envVariable = "GDD_ROUTE_VERSIONS"
+	// GddRegistry selects service registry backend: memberlist, file or dns. Default is memberlist
+	GddRegistry envVariable = "GDD_REGISTRY"
+	// GddRegistryFile sets path of yaml file of file registry. Default is registry.yaml
+	GddRegistryFile envVariable = "GDD_REGISTRY_FILE"
+	// GddRegistryRefresh sets interval of reloading file registry and resolving dns registry. Default is 10s
+	GddRegistryRefresh envVariable = "GDD_REGISTRY_REFRESH"
+	// GddRegistryDnsName sets domain name of services for dns registry, {service} is replaced by service name,
+	// such as {service}-svc-headless.default.svc.cluster.local. Default is {service}
+	GddRegistryDnsName envVariable = "GDD_REGISTRY_DNS_NAME"
+	// GddRegistryDnsPortName sets port name of SRV records for dns registry, such as http-port.
+	// If empty, SRV records of the domain name itself are looked up
+	GddRegistryDnsPortName envVariable = "GDD_REGISTRY_DNS_PORT_NAME"
+	// GddRegistryDnsPort sets port of nodes resolved from A records when no SRV record found. Default is 6060
+	GddRegistryDnsPort envVariable = "GDD_REGISTRY_DNS_PORT"
 )
 
+// EnvLoader is implemented by environment variables defined in this package,
+// so that helpers parsing them can be shared by different variables
+type EnvLoader interface {
+	Load() string
+	String() string
+}
+
 // Load loads value from environment variable
 func (receiver envVariable) Load() string {
 	return os.Getenv(string(receiver))
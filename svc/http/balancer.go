@@ -0,0 +1,253 @@
+package ddhttp
+
+import (
+	"context"
+	"github.com/unionj-cloud/go-doudou/stringutils"
+	"github.com/unionj-cloud/go-doudou/svc/registry"
+	"hash/crc32"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// LoadBalancer selects a node from nodes supplying the service for a request. nodes is never empty
+type LoadBalancer interface {
+	Select(ctx context.Context, nodes []*registry.Node) *registry.Node
+}
+
+type hashKeyCtxKey struct{}
+
+// WithHashKey returns a copy of ctx carrying key for consistent hash load balancer,
+// such as user id for routing requests of the same user to the same node
+func WithHashKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, hashKeyCtxKey{}, key)
+}
+
+// HashKey returns key set by WithHashKey
+func HashKey(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	key, _ := ctx.Value(hashKeyCtxKey{}).(string)
+	return key
+}
+
+// hostCounter counts in-flight requests by target host
+type hostCounter struct {
+	counts sync.Map
+}
+
+func (c *hostCounter) add(host string, delta int64) {
+	value, _ := c.counts.LoadOrStore(host, new(int64))
+	atomic.AddInt64(value.(*int64), delta)
+}
+
+func (c *hostCounter) get(host string) int64 {
+	if value, ok := c.counts.Load(host); ok {
+		return atomic.LoadInt64(value.(*int64))
+	}
+	return 0
+}
+
+// inflightRequests is maintained by clients created by NewClient or measured by MeasureClient
+var inflightRequests = &hostCounter{}
+
+func inflight(node *registry.Node) int64 {
+	return inflightRequests.get(node.Address())
+}
+
+type roundRobin struct {
+	next uint64
+}
+
+// NewRoundRobin creates a LoadBalancer selecting nodes in turn. It is the default one
+func NewRoundRobin() LoadBalancer {
+	return &roundRobin{}
+}
+
+func (b *roundRobin) Select(ctx context.Context, nodes []*registry.Node) *registry.Node {
+	return nodes[(atomic.AddUint64(&b.next, 1)-1)%uint64(len(nodes))]
+}
+
+type weightedRoundRobin struct {
+	lock    sync.Mutex
+	current map[string]int
+}
+
+// NewWeightedRoundRobin creates a LoadBalancer selecting nodes in turn in proportion to their weights
+// set by registry.WithWeight. Selections of a node are spread evenly instead of in a burst
+func NewWeightedRoundRobin() LoadBalancer {
+	return &weightedRoundRobin{
+		current: make(map[string]int),
+	}
+}
+
+// Select implements smooth weighted round-robin algorithm of nginx
+func (b *weightedRoundRobin) Select(ctx context.Context, nodes []*registry.Node) *registry.Node {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	var (
+		selected *registry.Node
+		max      int
+		total    int
+	)
+	seen := make(map[string]struct{}, len(nodes))
+	for _, node := range nodes {
+		key := node.BaseUrl()
+		seen[key] = struct{}{}
+		weight := node.Weight()
+		total += weight
+		b.current[key] += weight
+		if selected == nil || b.current[key] > max {
+			selected = node
+			max = b.current[key]
+		}
+	}
+	b.current[selected.BaseUrl()] -= total
+	// forget nodes which have left
+	for key := range b.current {
+		if _, ok := seen[key]; !ok {
+			delete(b.current, key)
+		}
+	}
+	return selected
+}
+
+type random struct{}
+
+// NewRandom creates a LoadBalancer selecting nodes randomly
+func NewRandom() LoadBalancer {
+	return random{}
+}
+
+func (random) Select(ctx context.Context, nodes []*registry.Node) *registry.Node {
+	return nodes[rand.Intn(len(nodes))]
+}
+
+type leastInFlight struct{}
+
+// NewLeastInFlight creates a LoadBalancer selecting the node with the least in-flight requests sent by
+// clients created by NewClient or measured by MeasureClient. Ties are broken randomly
+func NewLeastInFlight() LoadBalancer {
+	return leastInFlight{}
+}
+
+func (leastInFlight) Select(ctx context.Context, nodes []*registry.Node) *registry.Node {
+	start := rand.Intn(len(nodes))
+	selected := nodes[start]
+	min := inflight(selected)
+	for i := 1; i < len(nodes) && min > 0; i++ {
+		node := nodes[(start+i)%len(nodes)]
+		if n := inflight(node); n < min {
+			selected, min = node, n
+		}
+	}
+	return selected
+}
+
+type p2c struct{}
+
+// NewP2C creates a power-of-two-choices LoadBalancer which picks two nodes randomly and selects the one with
+// less in-flight requests. It avoids herding to the same node which least in-flight strategy suffers from
+// when many clients see the same counts
+func NewP2C() LoadBalancer {
+	return p2c{}
+}
+
+func (p2c) Select(ctx context.Context, nodes []*registry.Node) *registry.Node {
+	if len(nodes) == 1 {
+		return nodes[0]
+	}
+	i := rand.Intn(len(nodes))
+	j := rand.Intn(len(nodes) - 1)
+	if j >= i {
+		j++
+	}
+	a, b := nodes[i], nodes[j]
+	if inflight(b) < inflight(a) {
+		return b
+	}
+	return a
+}
+
+const defaultReplicas = 100
+
+type hashRing struct {
+	signature string
+	hashes    []uint32
+	nodes     map[uint32]*registry.Node
+}
+
+type consistentHash struct {
+	replicas int
+	fallback LoadBalancer
+	lock     sync.Mutex
+	ring     *hashRing
+}
+
+// NewConsistentHash creates a LoadBalancer selecting node by consistent hashing on key set by WithHashKey,
+// so that requests of the same key go to the same node, and only a few keys move when nodes join or leave.
+// Each node has replicas virtual nodes on the ring, default 100 if not positive.
+// Requests without key are balanced by round-robin
+func NewConsistentHash(replicas int) LoadBalancer {
+	if replicas <= 0 {
+		replicas = defaultReplicas
+	}
+	return &consistentHash{
+		replicas: replicas,
+		fallback: NewRoundRobin(),
+	}
+}
+
+// getRing returns ring of nodes, rebuilt only if nodes changed
+func (b *consistentHash) getRing(nodes []*registry.Node) *hashRing {
+	urls := make([]string, len(nodes))
+	for i, node := range nodes {
+		urls[i] = node.BaseUrl()
+	}
+	sort.Strings(urls)
+	signature := strings.Join(urls, ",")
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.ring != nil && b.ring.signature == signature {
+		return b.ring
+	}
+	ring := &hashRing{
+		signature: signature,
+		nodes:     make(map[uint32]*registry.Node, len(nodes)*b.replicas),
+	}
+	for _, node := range nodes {
+		for i := 0; i < b.replicas; i++ {
+			hash := crc32.ChecksumIEEE([]byte(strconv.Itoa(i) + node.BaseUrl()))
+			if _, ok := ring.nodes[hash]; ok {
+				continue
+			}
+			ring.nodes[hash] = node
+			ring.hashes = append(ring.hashes, hash)
+		}
+	}
+	sort.Slice(ring.hashes, func(i, j int) bool {
+		return ring.hashes[i] < ring.hashes[j]
+	})
+	b.ring = ring
+	return ring
+}
+
+func (b *consistentHash) Select(ctx context.Context, nodes []*registry.Node) *registry.Node {
+	key := HashKey(ctx)
+	if stringutils.IsEmpty(key) {
+		return b.fallback.Select(ctx, nodes)
+	}
+	ring := b.getRing(nodes)
+	hash := crc32.ChecksumIEEE([]byte(key))
+	i := sort.Search(len(ring.hashes), func(i int) bool {
+		return ring.hashes[i] >= hash
+	})
+	if i == len(ring.hashes) {
+		i = 0
+	}
+	return ring.nodes[ring.hashes[i]]
+}
@@ -0,0 +1,164 @@
+package ddhttp
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/svc/registry"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestNodes(t *testing.T, hosts ...string) []*registry.Node {
+	var nodes []*registry.Node
+	for _, host := range hosts {
+		node, err := registry.NewRemoteNode("testsvc", "http://"+host)
+		require.NoError(t, err)
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+func TestRoundRobin(t *testing.T) {
+	nodes := newTestNodes(t, "rr1:80", "rr2:80", "rr3:80")
+	lb := NewRoundRobin()
+	var got []string
+	for i := 0; i < 4; i++ {
+		got = append(got, lb.Select(context.Background(), nodes).BaseUrl())
+	}
+	assert.Equal(t, []string{"http://rr1:80", "http://rr2:80", "http://rr3:80", "http://rr1:80"}, got)
+
+	var (
+		wg     sync.WaitGroup
+		lock   sync.Mutex
+		counts = make(map[string]int)
+	)
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			url := lb.Select(context.Background(), nodes).BaseUrl()
+			lock.Lock()
+			counts[url]++
+			lock.Unlock()
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, map[string]int{"http://rr1:80": 10, "http://rr2:80": 10, "http://rr3:80": 10}, counts)
+}
+
+func TestWeightedRoundRobin(t *testing.T) {
+	nodes := newTestNodes(t, "wrr1:80", "wrr2:80", "wrr3:80")
+	a, err := registry.NewRemoteNode("testsvc", "http://wrr1:80", registry.WithWeight(5))
+	require.NoError(t, err)
+	nodes[0] = a
+	lb := NewWeightedRoundRobin()
+	var got []string
+	for i := 0; i < 7; i++ {
+		got = append(got, lb.Select(context.Background(), nodes).BaseUrl()[7:11])
+	}
+	assert.Equal(t, []string{"wrr1", "wrr1", "wrr2", "wrr1", "wrr3", "wrr1", "wrr1"}, got)
+
+	// state of left nodes is dropped
+	lb.Select(context.Background(), nodes[1:])
+	assert.Len(t, lb.(*weightedRoundRobin).current, 2)
+}
+
+func TestLeastInFlight(t *testing.T) {
+	nodes := newTestNodes(t, "lif1:80", "lif2:80", "lif3:80")
+	inflightRequests.add("lif1:80", 2)
+	inflightRequests.add("lif3:80", 1)
+	defer inflightRequests.add("lif1:80", -2)
+	defer inflightRequests.add("lif3:80", -1)
+	lb := NewLeastInFlight()
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, "http://lif2:80", lb.Select(context.Background(), nodes).BaseUrl())
+	}
+}
+
+func TestP2C(t *testing.T) {
+	nodes := newTestNodes(t, "p2c1:80", "p2c2:80")
+	inflightRequests.add("p2c1:80", 3)
+	defer inflightRequests.add("p2c1:80", -3)
+	lb := NewP2C()
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, "http://p2c2:80", lb.Select(context.Background(), nodes).BaseUrl())
+	}
+	assert.Equal(t, "http://p2c1:80", lb.Select(context.Background(), nodes[:1]).BaseUrl())
+
+	nodes = newTestNodes(t, "rnd1:80", "rnd2:80")
+	assert.Contains(t, []string{"http://rnd1:80", "http://rnd2:80"}, NewRandom().Select(context.Background(), nodes).BaseUrl())
+}
+
+func TestConsistentHash(t *testing.T) {
+	nodes := newTestNodes(t, "ch1:80", "ch2:80", "ch3:80", "ch4:80")
+	lb := NewConsistentHash(0)
+	selected := make(map[string]string)
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprint("user", i)
+		ctx := WithHashKey(context.Background(), key)
+		selected[key] = lb.Select(ctx, nodes).BaseUrl()
+		assert.Equal(t, selected[key], lb.Select(ctx, nodes).BaseUrl())
+	}
+	// only keys of the left node move
+	for key, url := range selected {
+		got := lb.Select(WithHashKey(context.Background(), key), nodes[:3]).BaseUrl()
+		if url != "http://ch4:80" {
+			assert.Equal(t, url, got)
+		}
+	}
+	// requests without key are balanced by round-robin
+	assert.NotEqual(t, lb.Select(context.Background(), nodes).BaseUrl(), lb.Select(context.Background(), nodes).BaseUrl())
+}
+
+type testRegistry []*registry.Node
+
+func (r testRegistry) Register() error {
+	return nil
+}
+
+func (r testRegistry) Discover(svc string) ([]*registry.Node, error) {
+	return r, nil
+}
+
+func TestMemberlistServiceProvider_SelectServer(t *testing.T) {
+	nodes := newTestNodes(t, "msp1:80", "msp2:80")
+	draining, err := registry.NewRemoteNode("testsvc", "http://msp3:80", registry.WithStatus(registry.StatusDraining))
+	require.NoError(t, err)
+	provider := NewMemberlistServiceProvider("testsvc", testRegistry(append(nodes, draining)), WithLoadBalancer(NewConsistentHash(10)))
+	for i := 0; i < 10; i++ {
+		url, err := SelectServer(WithHashKey(context.Background(), fmt.Sprint(i)), provider)
+		require.NoError(t, err)
+		assert.NotEqual(t, "http://msp3:80", url)
+	}
+	_, err = NewMemberlistServiceProvider("testsvc", testRegistry{draining}).SelectServer()
+	assert.Error(t, err)
+
+	os.Setenv("TESTSVC", "http://localhost:6060")
+	defer os.Unsetenv("TESTSVC")
+	url, err := SelectServer(context.Background(), NewServiceProvider("TESTSVC"))
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost:6060", url)
+}
+
+func TestMemberlistServiceProvider_Ejected(t *testing.T) {
+	nodes := newTestNodes(t, "ej1:80", "ej2:80")
+	provider := NewMemberlistServiceProvider("testsvc", testRegistry(nodes))
+	for i := 0; i < 5; i++ {
+		registry.ObserveResult("ej1:80", true, time.Millisecond)
+	}
+	for i := 0; i < 4; i++ {
+		url, err := provider.SelectServer()
+		require.NoError(t, err)
+		assert.Equal(t, "http://ej2:80", url)
+	}
+	// all nodes are ejected
+	for i := 0; i < 5; i++ {
+		registry.ObserveResult("ej2:80", true, time.Millisecond)
+	}
+	_, err := provider.SelectServer()
+	assert.NoError(t, err)
+}
@@ -0,0 +1,455 @@
+package ddhttp
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha1"
+	"fmt"
+	"github.com/felixge/httpsnoop"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/unionj-cloud/cast"
+	"github.com/unionj-cloud/go-doudou/stringutils"
+	"github.com/unionj-cloud/go-doudou/svc/config"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var cacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "http_cache_requests_total",
+	Help: "Number of GET requests handled by response cache. Result is hit, miss, not_modified or bypass.",
+}, []string{"route", "result"})
+
+// CachedResponse is a response stored in CacheStore. It must not be modified after stored
+type CachedResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	ETag       string
+	// Vary holds names of request headers listed in Vary response header. Such responses are stored by keys
+	// built with values of these request headers, and the key of the request only stores Vary for finding them
+	Vary []string
+}
+
+// CacheStore stores responses for ResponseCache. Implement it to share cached responses between instances,
+// such as by redis
+type CacheStore interface {
+	// Get returns the response stored by key, false if not found or expired
+	Get(key string) (*CachedResponse, bool)
+	// Set stores the response by key for ttl
+	Set(key string, resp *CachedResponse, ttl time.Duration)
+}
+
+type lruEntry struct {
+	key      string
+	resp     *CachedResponse
+	expireAt time.Time
+}
+
+// lruStore is an in-memory CacheStore evicting least recently used responses
+type lruStore struct {
+	size  int
+	lock  sync.Mutex
+	ll    *list.List
+	items map[string]*list.Element
+	now   func() time.Time
+}
+
+// NewLRUCacheStore creates an in-memory CacheStore holding at most size responses.
+// Least recently used responses are evicted when it is full
+func NewLRUCacheStore(size int) CacheStore {
+	if size <= 0 {
+		size = defaultCacheSize
+	}
+	return &lruStore{
+		size:  size,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+		now:   time.Now,
+	}
+}
+
+func (s *lruStore) Get(key string) (*CachedResponse, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	elem, ok := s.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*lruEntry)
+	if !s.now().Before(entry.expireAt) {
+		s.ll.Remove(elem)
+		delete(s.items, key)
+		return nil, false
+	}
+	s.ll.MoveToFront(elem)
+	return entry.resp, true
+}
+
+func (s *lruStore) Set(key string, resp *CachedResponse, ttl time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	expireAt := s.now().Add(ttl)
+	if elem, ok := s.items[key]; ok {
+		entry := elem.Value.(*lruEntry)
+		entry.resp = resp
+		entry.expireAt = expireAt
+		s.ll.MoveToFront(elem)
+		return
+	}
+	s.items[key] = s.ll.PushFront(&lruEntry{
+		key:      key,
+		resp:     resp,
+		expireAt: expireAt,
+	})
+	for s.ll.Len() > s.size {
+		oldest := s.ll.Back()
+		s.ll.Remove(oldest)
+		delete(s.items, oldest.Value.(*lruEntry).key)
+	}
+}
+
+const defaultCacheSize = 1000
+
+// ResponseCache computes ETag for successful GET responses and replies 304 status code if it matches
+// If-None-Match request header. Responses of routes with positive ttl are also stored in CacheStore
+type ResponseCache struct {
+	store       CacheStore
+	def         time.Duration
+	routes      map[string]time.Duration
+	credentials bool
+}
+
+// ResponseCacheOption sets options of ResponseCache
+type ResponseCacheOption func(*ResponseCache)
+
+// WithCacheStore replaces default in-memory LRU store
+func WithCacheStore(store CacheStore) ResponseCacheOption {
+	return func(c *ResponseCache) {
+		c.store = store
+	}
+}
+
+// WithCacheTTL caches responses of the route named route for ttl. Zero ttl disables caching of the route
+func WithCacheTTL(route string, ttl time.Duration) ResponseCacheOption {
+	return func(c *ResponseCache) {
+		c.routes[route] = ttl
+	}
+}
+
+// WithCacheCredentials caches responses of requests carrying Authorization or Cookie header as well.
+// They are cached per credential, so that a client only gets responses to its own requests.
+// By default such requests bypass the cache, because responses to them may differ between clients
+func WithCacheCredentials() ResponseCacheOption {
+	return func(c *ResponseCache) {
+		c.credentials = true
+	}
+}
+
+// NewResponseCache creates a ResponseCache configured by GDD_CACHE_TTL, GDD_CACHE_TTLS, GDD_CACHE_SIZE and options
+func NewResponseCache(opts ...ResponseCacheOption) *ResponseCache {
+	c := &ResponseCache{
+		def:    parseDuration(config.GddCacheTtl, config.GddCacheTtl.Load()),
+		routes: make(map[string]time.Duration),
+	}
+	for route, value := range routeValues(config.GddCacheTtls) {
+		c.routes[route] = parseDuration(config.GddCacheTtls, value)
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.store == nil {
+		c.store = NewLRUCacheStore(cast.ToInt(config.GddCacheSize.Load()))
+	}
+	return c
+}
+
+func (c *ResponseCache) ttl(route string) time.Duration {
+	if ttl, ok := c.routes[route]; ok {
+		return ttl
+	}
+	return c.def
+}
+
+// cacheKey identifies responses by route name, path and query. Query parameters are sorted,
+// so that ?a=1&b=2 and ?b=2&a=1 share the same response
+func cacheKey(route string, r *http.Request) string {
+	return route + " " + r.URL.Path + "?" + r.URL.Query().Encode()
+}
+
+// credential returns Authorization and Cookie headers of r, empty if neither is set
+func credential(r *http.Request) string {
+	auth, cookie := r.Header.Get("Authorization"), strings.Join(r.Header.Values("Cookie"), "; ")
+	if stringutils.IsEmpty(auth) && stringutils.IsEmpty(cookie) {
+		return ""
+	}
+	return auth + "\n" + cookie
+}
+
+// parseVary returns names of request headers in Vary header values. any is true if it contains *
+func parseVary(values []string) (names []string, any bool) {
+	for _, value := range values {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name == "*" {
+				return nil, true
+			}
+			if stringutils.IsNotEmpty(name) {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	return names, false
+}
+
+// varyKey appends values of request headers named by vary to key
+func varyKey(key string, vary []string, r *http.Request) string {
+	var b strings.Builder
+	b.WriteString(key)
+	for _, name := range vary {
+		b.WriteString("\n")
+		b.WriteString(name)
+		b.WriteString(": ")
+		b.WriteString(strings.Join(r.Header.Values(name), ","))
+	}
+	return b.String()
+}
+
+// lookup returns response stored for r by key, following Vary of the stored entry
+func (c *ResponseCache) lookup(key string, r *http.Request) (*CachedResponse, bool) {
+	resp, ok := c.store.Get(key)
+	if !ok || len(resp.Vary) == 0 {
+		return resp, ok
+	}
+	return c.store.Get(varyKey(key, resp.Vary, r))
+}
+
+// save stores resp by key, or by the key built with request headers in vary
+func (c *ResponseCache) save(key string, vary []string, r *http.Request, resp *CachedResponse, ttl time.Duration) {
+	if len(vary) > 0 {
+		c.store.Set(key, &CachedResponse{Vary: vary}, ttl)
+		key = varyKey(key, vary, r)
+	}
+	c.store.Set(key, resp, ttl)
+}
+
+// etagMatch reports whether If-None-Match header value matches etag by weak comparison
+func etagMatch(ifNoneMatch, etag string) bool {
+	if stringutils.IsEmpty(ifNoneMatch) || stringutils.IsEmpty(etag) {
+		return false
+	}
+	for _, item := range strings.Split(ifNoneMatch, ",") {
+		item = strings.TrimSpace(item)
+		if item == "*" || strings.TrimPrefix(item, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheable reports whether the response can be shared between clients
+func cacheable(header http.Header) bool {
+	if len(header.Values("Set-Cookie")) > 0 {
+		return false
+	}
+	cc := strings.ToLower(header.Get("Cache-Control"))
+	return !strings.Contains(cc, "no-store") && !strings.Contains(cc, "private")
+}
+
+// headerDiff returns headers in after which are added or changed since before
+func headerDiff(before, after http.Header) http.Header {
+	diff := make(http.Header)
+	for k, v := range after {
+		if strings.Join(before[k], ",") != strings.Join(v, ",") {
+			diff[k] = append([]string(nil), v...)
+		}
+	}
+	return diff
+}
+
+func writeNotModified(w http.ResponseWriter, etag string) {
+	header := w.Header()
+	header.Del("Content-Type")
+	header.Del("Content-Length")
+	header.Set("ETag", etag)
+	w.WriteHeader(http.StatusNotModified)
+}
+
+func serveCached(w http.ResponseWriter, r *http.Request, resp *CachedResponse) {
+	header := w.Header()
+	for k, v := range resp.Header {
+		header[k] = append([]string(nil), v...)
+	}
+	if etagMatch(r.Header.Get("If-None-Match"), resp.ETag) {
+		writeNotModified(w, resp.ETag)
+		return
+	}
+	w.WriteHeader(resp.StatusCode)
+	if r.Method != http.MethodHead {
+		w.Write(resp.Body)
+	}
+}
+
+// bufferedWriter holds response in memory for computing ETag. It switches to pass through
+// if the handler flushes, such as streaming responses
+type bufferedWriter struct {
+	w           http.ResponseWriter
+	code        int
+	buf         bytes.Buffer
+	passthrough bool
+}
+
+func (b *bufferedWriter) flushBuffer() {
+	if b.passthrough {
+		return
+	}
+	b.passthrough = true
+	if b.code == 0 {
+		b.code = http.StatusOK
+	}
+	b.w.WriteHeader(b.code)
+	if b.buf.Len() > 0 {
+		b.w.Write(b.buf.Bytes())
+		b.buf.Reset()
+	}
+}
+
+func (b *bufferedWriter) wrap() http.ResponseWriter {
+	return httpsnoop.Wrap(b.w, httpsnoop.Hooks{
+		WriteHeader: func(next httpsnoop.WriteHeaderFunc) httpsnoop.WriteHeaderFunc {
+			return func(code int) {
+				if b.passthrough {
+					next(code)
+					return
+				}
+				if b.code == 0 {
+					b.code = code
+				}
+			}
+		},
+		Write: func(next httpsnoop.WriteFunc) httpsnoop.WriteFunc {
+			return func(p []byte) (int, error) {
+				if b.passthrough {
+					return next(p)
+				}
+				if b.code == 0 {
+					b.code = http.StatusOK
+				}
+				return b.buf.Write(p)
+			}
+		},
+		ReadFrom: func(next httpsnoop.ReadFromFunc) httpsnoop.ReadFromFunc {
+			return func(src io.Reader) (int64, error) {
+				if b.passthrough {
+					return next(src)
+				}
+				if b.code == 0 {
+					b.code = http.StatusOK
+				}
+				return b.buf.ReadFrom(src)
+			}
+		},
+		Flush: func(next httpsnoop.FlushFunc) httpsnoop.FlushFunc {
+			return func() {
+				b.flushBuffer()
+				next()
+			}
+		},
+	})
+}
+
+// Middleware returns response caching middleware. Only GET and HEAD requests are handled. Responses with
+// Set-Cookie header, Vary: * header or Cache-Control no-store or private directive are never stored, and requests
+// with Authorization or Cookie header bypass the cache unless WithCacheCredentials is set. Responses with Vary
+// header are cached per value of the request headers it names. Cached responses are served without calling
+// inner handlers, so put it after handlers.CompressHandler and authentication middlewares
+func (c *ResponseCache) Middleware(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			inner.ServeHTTP(w, r)
+			return
+		}
+		route := routeName(r)
+		ttl := c.ttl(route)
+		key := cacheKey(route, r)
+		if cred := credential(r); ttl > 0 && stringutils.IsNotEmpty(cred) {
+			if c.credentials {
+				key += fmt.Sprintf("\n%x", sha1.Sum([]byte(cred)))
+			} else {
+				cacheRequests.WithLabelValues(route, "bypass").Inc()
+				ttl = 0
+			}
+		}
+		if ttl > 0 {
+			if resp, ok := c.lookup(key, r); ok {
+				if etagMatch(r.Header.Get("If-None-Match"), resp.ETag) {
+					cacheRequests.WithLabelValues(route, "not_modified").Inc()
+				} else {
+					cacheRequests.WithLabelValues(route, "hit").Inc()
+				}
+				serveCached(w, r, resp)
+				return
+			}
+			cacheRequests.WithLabelValues(route, "miss").Inc()
+		}
+		if r.Method == http.MethodHead {
+			inner.ServeHTTP(w, r)
+			return
+		}
+		// headers set by outer middlewares such as X-Request-Id are not stored
+		before := w.Header().Clone()
+		b := &bufferedWriter{w: w}
+		inner.ServeHTTP(b.wrap(), r)
+		if b.passthrough {
+			return
+		}
+		if b.code == 0 {
+			b.code = http.StatusOK
+		}
+		header := w.Header()
+		if b.code != http.StatusOK {
+			b.flushBuffer()
+			return
+		}
+		etag := header.Get("ETag")
+		if stringutils.IsEmpty(etag) {
+			etag = fmt.Sprintf(`"%x"`, sha1.Sum(b.buf.Bytes()))
+			header.Set("ETag", etag)
+		}
+		diff := headerDiff(before, header)
+		// Vary set by outer middlewares such as Accept-Encoding by handlers.CompressHandler is handled by themselves
+		vary, any := parseVary(diff.Values("Vary"))
+		if ttl > 0 && cacheable(header) && !any {
+			c.save(key, vary, r, &CachedResponse{
+				StatusCode: b.code,
+				Header:     diff,
+				Body:       append([]byte(nil), b.buf.Bytes()...),
+				ETag:       etag,
+			}, ttl)
+		}
+		if etagMatch(r.Header.Get("If-None-Match"), etag) {
+			writeNotModified(w, etag)
+			return
+		}
+		b.flushBuffer()
+	})
+}
+
+var (
+	responseCacheOnce    sync.Once
+	defaultResponseCache *ResponseCache
+)
+
+// Cache is response caching middleware configured by GDD_CACHE_TTL, GDD_CACHE_TTLS and GDD_CACHE_SIZE.
+// ETag is computed for all successful GET responses, while only responses of routes with positive ttl
+// are stored in in-memory LRU store. Cached routes must return the same response for all anonymous clients,
+// and requests with credentials bypass the cache. Use NewResponseCache with WithCacheStore option for a shared store
+func Cache(inner http.Handler) http.Handler {
+	responseCacheOnce.Do(func() {
+		defaultResponseCache = NewResponseCache()
+	})
+	return defaultResponseCache.Middleware(inner)
+}
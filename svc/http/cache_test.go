@@ -0,0 +1,270 @@
+package ddhttp
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/svc/config"
+	"github.com/unionj-cloud/go-doudou/svc/http/model"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func newCacheSrv(c *ResponseCache, calls *int) *DefaultHttpSrv {
+	srv := NewDefaultHttpSrv()
+	srv.AddMiddleware(c.Middleware)
+	srv.AddRoute(model.Route{
+		Name:    "GetUser",
+		Method:  "GET",
+		Pattern: "/user/{id}",
+		HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+			*calls++
+			if r.URL.Query().Get("login") == "true" {
+				http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc"})
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"id":1}`))
+		},
+	}, model.Route{
+		Name:    "GetBook",
+		Method:  "GET",
+		Pattern: "/book",
+		HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+			*calls++
+			w.Write([]byte("book"))
+		},
+	}, model.Route{
+		Name:    "GetMissing",
+		Method:  "GET",
+		Pattern: "/missing",
+		HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+			*calls++
+			http.Error(w, "not found", http.StatusNotFound)
+		},
+	})
+	return srv
+}
+
+func serveCache(srv *DefaultHttpSrv, method, target, ifNoneMatch string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	if ifNoneMatch != "" {
+		req.Header.Set("If-None-Match", ifNoneMatch)
+	}
+	rec := httptest.NewRecorder()
+	srv.rootRouter.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestResponseCache_ETag(t *testing.T) {
+	var calls int
+	srv := newCacheSrv(NewResponseCache(), &calls)
+
+	rec := serveCache(srv, "GET", "/book", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "book", rec.Body.String())
+	etag := rec.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	rec = serveCache(srv, "GET", "/book", `"other", W/`+etag)
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+	assert.Empty(t, rec.Body.String())
+	assert.Equal(t, etag, rec.Header().Get("ETag"))
+
+	rec = serveCache(srv, "GET", "/missing", "*")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Empty(t, rec.Header().Get("ETag"))
+	// no ttl, nothing cached
+	assert.Equal(t, 3, calls)
+}
+
+func TestResponseCache_TTL(t *testing.T) {
+	config.GddCacheTtls.Write("GetUser=1m")
+	defer os.Unsetenv(config.GddCacheTtls.String())
+	var calls int
+	srv := newCacheSrv(NewResponseCache(WithCacheTTL("GetMissing", time.Minute)), &calls)
+
+	rec := serveCache(srv, "GET", "/user/1?b=2&a=1", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	etag := rec.Header().Get("ETag")
+	rec = serveCache(srv, "GET", "/user/1?a=1&b=2", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `{"id":1}`, rec.Body.String())
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	assert.Equal(t, etag, rec.Header().Get("ETag"))
+	rec = serveCache(srv, "GET", "/user/1?a=1&b=2", etag)
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+	assert.Equal(t, 1, calls)
+
+	serveCache(srv, "GET", "/user/2", "")
+	assert.Equal(t, 2, calls)
+
+	// responses with cookies are never shared
+	serveCache(srv, "GET", "/user/1?login=true", "")
+	serveCache(srv, "GET", "/user/1?login=true", "")
+	assert.Equal(t, 4, calls)
+
+	// only successful responses are cached
+	serveCache(srv, "GET", "/missing", "")
+	serveCache(srv, "GET", "/missing", "")
+	assert.Equal(t, 6, calls)
+
+	// GetBook has no ttl
+	serveCache(srv, "GET", "/book", "")
+	serveCache(srv, "GET", "/book", "")
+	assert.Equal(t, 8, calls)
+}
+
+func TestResponseCache_Flush(t *testing.T) {
+	srv := NewDefaultHttpSrv()
+	srv.AddMiddleware(NewResponseCache(WithCacheTTL("Stream", time.Minute)).Middleware)
+	srv.AddRoute(model.Route{
+		Name:    "Stream",
+		Method:  "GET",
+		Pattern: "/stream",
+		HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("data: 1\n\n"))
+			w.(http.Flusher).Flush()
+			w.Write([]byte("data: 2\n\n"))
+		},
+	})
+	rec := serveCache(srv, "GET", "/stream", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, rec.Flushed)
+	assert.Equal(t, "data: 1\n\ndata: 2\n\n", rec.Body.String())
+	assert.Empty(t, rec.Header().Get("ETag"))
+}
+
+func newAuthCacheSrv(c *ResponseCache, calls *int) *DefaultHttpSrv {
+	srv := NewDefaultHttpSrv()
+	srv.AddMiddleware(c.Middleware, func(inner http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer good" && r.Header.Get("Authorization") != "Bearer other" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			inner.ServeHTTP(w, r)
+		})
+	})
+	srv.AddRoute(model.Route{
+		Name:    "GetProfile",
+		Method:  "GET",
+		Pattern: "/profile",
+		HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+			*calls++
+			w.Write([]byte(r.Header.Get("Authorization")))
+		},
+	})
+	return srv
+}
+
+func serveAuth(srv *DefaultHttpSrv, authorization string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/profile", nil)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	rec := httptest.NewRecorder()
+	srv.rootRouter.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestResponseCache_Credentials(t *testing.T) {
+	var calls int
+	srv := newAuthCacheSrv(NewResponseCache(WithCacheTTL("GetProfile", time.Minute)), &calls)
+	assert.Equal(t, http.StatusOK, serveAuth(srv, "Bearer good").Code)
+	assert.Equal(t, http.StatusOK, serveAuth(srv, "Bearer good").Code)
+	assert.Equal(t, 2, calls)
+	// response to authorized request is not served before authentication
+	assert.Equal(t, http.StatusUnauthorized, serveAuth(srv, "").Code)
+	assert.Equal(t, http.StatusUnauthorized, serveAuth(srv, "Bearer bad").Code)
+
+	calls = 0
+	srv = newAuthCacheSrv(NewResponseCache(WithCacheTTL("GetProfile", time.Minute), WithCacheCredentials()), &calls)
+	assert.Equal(t, "Bearer good", serveAuth(srv, "Bearer good").Body.String())
+	assert.Equal(t, "Bearer good", serveAuth(srv, "Bearer good").Body.String())
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, "Bearer other", serveAuth(srv, "Bearer other").Body.String())
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, http.StatusUnauthorized, serveAuth(srv, "").Code)
+	assert.Equal(t, http.StatusUnauthorized, serveAuth(srv, "Bearer bad").Code)
+
+	req := httptest.NewRequest("GET", "/profile", nil)
+	req.Header.Set("Authorization", "Bearer good")
+	req.AddCookie(&http.Cookie{Name: "session", Value: "abc"})
+	rec := httptest.NewRecorder()
+	srv.rootRouter.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 3, calls)
+}
+
+func TestResponseCache_Vary(t *testing.T) {
+	var calls int
+	srv := NewDefaultHttpSrv()
+	srv.AddMiddleware(NewResponseCache(WithCacheTTL("GetGreeting", time.Minute), WithCacheTTL("GetAny", time.Minute)).Middleware)
+	srv.AddRoute(model.Route{
+		Name:    "GetGreeting",
+		Method:  "GET",
+		Pattern: "/greeting",
+		HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.Header().Set("Vary", "accept-language")
+			if r.Header.Get("Accept-Language") == "zh" {
+				w.Write([]byte("你好"))
+				return
+			}
+			w.Write([]byte("hello"))
+		},
+	}, model.Route{
+		Name:    "GetAny",
+		Method:  "GET",
+		Pattern: "/any",
+		HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.Header().Set("Vary", "*")
+			w.Write([]byte("any"))
+		},
+	})
+	greet := func(lang string) string {
+		req := httptest.NewRequest("GET", "/greeting", nil)
+		if lang != "" {
+			req.Header.Set("Accept-Language", lang)
+		}
+		rec := httptest.NewRecorder()
+		srv.rootRouter.ServeHTTP(rec, req)
+		assert.Equal(t, "accept-language", rec.Header().Get("Vary"))
+		return rec.Body.String()
+	}
+	assert.Equal(t, "hello", greet("en"))
+	assert.Equal(t, "你好", greet("zh"))
+	assert.Equal(t, "hello", greet("en"))
+	assert.Equal(t, "你好", greet("zh"))
+	assert.Equal(t, "hello", greet(""))
+	assert.Equal(t, 3, calls)
+
+	serveCache(srv, "GET", "/any", "")
+	serveCache(srv, "GET", "/any", "")
+	assert.Equal(t, 5, calls)
+}
+
+func TestLRUCacheStore(t *testing.T) {
+	store := NewLRUCacheStore(2).(*lruStore)
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+	store.Set("a", &CachedResponse{ETag: "a"}, time.Minute)
+	store.Set("b", &CachedResponse{ETag: "b"}, time.Second)
+	_, ok := store.Get("a")
+	assert.True(t, ok)
+	store.Set("c", &CachedResponse{ETag: "c"}, time.Minute)
+	// b is least recently used
+	_, ok = store.Get("b")
+	assert.False(t, ok)
+	resp, ok := store.Get("c")
+	assert.True(t, ok)
+	assert.Equal(t, "c", resp.ETag)
+
+	now = now.Add(time.Minute)
+	_, ok = store.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, 1, store.ll.Len())
+}
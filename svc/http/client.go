@@ -1,16 +1,18 @@
 package ddhttp
 
 import (
+	"context"
 	"fmt"
 	"github.com/go-resty/resty/v2"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	"github.com/unionj-cloud/go-doudou/stringutils"
+	"github.com/unionj-cloud/go-doudou/svc/config"
 	"github.com/unionj-cloud/go-doudou/svc/registry"
 	"net"
 	"net/http"
 	"os"
 	"runtime"
-	"sync/atomic"
 	"time"
 )
 
@@ -37,11 +39,88 @@ func WithClient(client *resty.Client) DdClientOption {
 	}
 }
 
+// TokenSource supplies bearer token for requests sent by generated clients
+type TokenSource interface {
+	Token() (string, error)
+}
+
+// TokenSourceFunc is an adapter to allow the use of ordinary functions as TokenSource
+type TokenSourceFunc func() (string, error)
+
+// Token calls f()
+func (f TokenSourceFunc) Token() (string, error) {
+	return f()
+}
+
+// StaticTokenSource returns a TokenSource which always supplies the same token
+func StaticTokenSource(token string) TokenSource {
+	return TokenSourceFunc(func() (string, error) {
+		return token, nil
+	})
+}
+
+// TokenSourceSetter is implemented by generated clients which accept a token source
+type TokenSourceSetter interface {
+	SetTokenSource(ts TokenSource)
+}
+
+// WithTokenSource sets token source for clients which implement TokenSourceSetter
+func WithTokenSource(ts TokenSource) DdClientOption {
+	return func(c DdClient) {
+		if setter, ok := c.(TokenSourceSetter); ok {
+			setter.SetTokenSource(ts)
+		}
+	}
+}
+
+// StreamClientSetter is implemented by generated clients which send requests with streamed response body
+// by a separate client
+type StreamClientSetter interface {
+	SetStreamClient(client *resty.Client)
+}
+
+// WithStreamClient sets http client for requests whose response body is streamed, such as io.ReadCloser
+// and server-sent events results. It should have no overall timeout like clients created by NewStreamClient
+func WithStreamClient(client *resty.Client) DdClientOption {
+	return func(c DdClient) {
+		if setter, ok := c.(StreamClientSetter); ok {
+			setter.SetStreamClient(client)
+		}
+	}
+}
+
+// SetBearerToken sets Authorization header of the request with token from ts. Do nothing if ts is nil
+func SetBearerToken(req *resty.Request, ts TokenSource) error {
+	if ts == nil {
+		return nil
+	}
+	token, err := ts.Token()
+	if err != nil {
+		return errors.Wrap(err, "get token from token source failed")
+	}
+	req.SetAuthToken(token)
+	return nil
+}
+
 // IServiceProvider defines service provider interface for server discovery
 type IServiceProvider interface {
 	SelectServer() (string, error)
 }
 
+// ContextServiceProvider is implemented by service providers selecting server by request context,
+// such as by key set by WithHashKey
+type ContextServiceProvider interface {
+	SelectServerContext(ctx context.Context) (string, error)
+}
+
+// SelectServer selects server by provider for the request of ctx. It is called by generated clients
+func SelectServer(ctx context.Context, provider IServiceProvider) (string, error) {
+	if p, ok := provider.(ContextServiceProvider); ok && ctx != nil {
+		return p.SelectServerContext(ctx)
+	}
+	return provider.SelectServer()
+}
+
 // ServiceProvider defines an implementation for IServiceProvider
 type ServiceProvider struct {
 	Env string
@@ -72,28 +151,55 @@ func NewServiceProvider(env string, opts ...ServiceProviderOption) IServiceProvi
 	return provider
 }
 
-// NewClient creates new resty Client instance
+const defaultClientTimeout = 1 * time.Minute
+
+// NewClient creates new resty Client instance. If GDD_TLS_CA is set, servers whose certificates are signed by it
+// are trusted. If GDD_TLS_CERT and GDD_TLS_KEY are set, the certificate is sent as client certificate for mTLS.
+// Requests are traced and carry W3C trace context from their context, and measured by prometheus metrics.
+// Requests time out after 1 minute including reading response body
 func NewClient() *resty.Client {
+	return newClient(defaultClientTimeout)
+}
+
+// NewStreamClient creates resty Client instance like NewClient, but without overall timeout, so that response body
+// can be streamed for as long as it takes. Waiting for response headers still times out after 1 minute,
+// and reading response body stops when context of the request is cancelled
+func NewStreamClient() *resty.Client {
+	return newClient(0)
+}
+
+func newClient(timeout time.Duration) *resty.Client {
 	client := resty.New()
-	client.SetTimeout(1 * time.Minute)
+	client.SetTimeout(timeout)
 
 	dialer := &net.Dialer{
 		Timeout:   30 * time.Second,
 		KeepAlive: 30 * time.Second,
 		DualStack: true,
 	}
-	client.SetTransport(&http.Transport{
+	transport := &http.Transport{
 		Proxy:                 http.ProxyFromEnvironment,
 		DialContext:           dialer.DialContext,
 		ForceAttemptHTTP2:     true,
 		MaxIdleConns:          100,
 		IdleConnTimeout:       90 * time.Second,
 		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: defaultClientTimeout,
 		ExpectContinueTimeout: 1 * time.Second,
 		MaxIdleConnsPerHost:   runtime.GOMAXPROCS(0) + 1,
 		MaxConnsPerHost:       100,
-	})
-	return client
+	}
+	if tlsEnabled() || stringutils.IsNotEmpty(config.GddTlsCa.Load()) {
+		tlsConfig, err := ClientTLSConfig(config.GddTlsCert.Load(), config.GddTlsKey.Load(), config.GddTlsCa.Load())
+		if err != nil {
+			logrus.Warnf("Load client tls config failed: %+v, use default tls config instead.\n", err)
+		} else {
+			transport.TLSClientConfig = tlsConfig
+		}
+	}
+	client.SetTransport(transport)
+	client.OnBeforeRequest(propagateRouteVersion)
+	return MeasureClient(TraceClient(client))
 }
 
 // MemberlistServiceProvider defines an implementation for IServiceProvider. Recommend to use.
@@ -101,32 +207,63 @@ type MemberlistServiceProvider struct {
 	// Name of the service that dependent on
 	name     string
 	registry registry.IRegistry
-	current  uint64
+	lb       LoadBalancer
+	zone     string
+	canary   *canary
 }
 
 // SelectServer selects a node which is supplying service specified by name property from cluster
 func (m *MemberlistServiceProvider) SelectServer() (string, error) {
-	nodes, err := m.registry.Discover(m.name)
+	return m.SelectServerContext(context.Background())
+}
+
+// SelectServerContext selects a node by load balancer of the provider from healthy nodes of preferred version and zone.
+// ctx carries key set by WithHashKey and version set by WithRouteVersion
+func (m *MemberlistServiceProvider) SelectServerContext(ctx context.Context) (string, error) {
+	discovered, err := registry.Discover(ctx, m.registry, m.name)
 	if err != nil {
 		return "", errors.Wrap(err, "SelectServer() fail")
 	}
-	if len(nodes) == 0 {
+	// draining nodes are skipped
+	var up, nodes []*registry.Node
+	for _, node := range discovered {
+		if node.Status() != registry.StatusUp {
+			continue
+		}
+		up = append(up, node)
+		if !node.Suspect() && !node.Ejected() {
+			nodes = append(nodes, node)
+		}
+	}
+	if len(up) == 0 {
 		return "", errors.Wrap(errors.New(fmt.Sprintf("no service %s supplier found", m.name)), "SelectServer() fail")
 	}
-	next := int(atomic.AddUint64(&m.current, uint64(1)) % uint64(len(nodes)))
-	m.current = uint64(next)
-	selected := nodes[next]
-	return selected.BaseUrl(), nil
+	if len(nodes) == 0 {
+		// all nodes are unhealthy, better to try them than fail immediately
+		nodes = up
+	}
+	return m.lb.Select(ctx, m.route(ctx, nodes)).BaseUrl(), nil
 }
 
 // MemberlistProviderOption defines a function for setting properties of MemberlistServiceProvider
 type MemberlistProviderOption func(IServiceProvider)
 
+// WithLoadBalancer sets load balancer of MemberlistServiceProvider, such as NewWeightedRoundRobin(),
+// NewRandom(), NewLeastInFlight(), NewP2C() and NewConsistentHash(0). Default is NewRoundRobin()
+func WithLoadBalancer(lb LoadBalancer) MemberlistProviderOption {
+	return func(provider IServiceProvider) {
+		if p, ok := provider.(*MemberlistServiceProvider); ok && lb != nil {
+			p.lb = lb
+		}
+	}
+}
+
 // NewMemberlistServiceProvider create an NewMemberlistServiceProvider instance
 func NewMemberlistServiceProvider(name string, registry registry.IRegistry, opts ...MemberlistProviderOption) IServiceProvider {
 	provider := &MemberlistServiceProvider{
 		name:     name,
 		registry: registry,
+		lb:       NewRoundRobin(),
 	}
 
 	for _, opt := range opts {
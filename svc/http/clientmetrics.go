@@ -0,0 +1,107 @@
+package ddhttp
+
+import (
+	"github.com/go-resty/resty/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	ddprometheus "github.com/unionj-cloud/go-doudou/svc/http/prometheus"
+	"github.com/unionj-cloud/go-doudou/svc/registry"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type clientMetrics struct {
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	inflight *prometheus.GaugeVec
+	// pending holds in-flight requests, because resty hooks can only pass data by *resty.Request
+	pending sync.Map
+}
+
+type pendingRequest struct {
+	host   string
+	method string
+	start  time.Time
+}
+
+func newClientMetrics(reg prometheus.Registerer) *clientMetrics {
+	m := &clientMetrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_client_requests_total",
+			Help: "Number of requests sent by http clients. Status is error if no response received.",
+		}, []string{"host", "method", "status"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_client_request_duration_seconds",
+			Help:    "Duration of requests sent by http clients.",
+			Buckets: ddprometheus.DurationBuckets(),
+		}, []string{"host", "method"}),
+		inflight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "http_client_requests_in_flight",
+			Help: "Number of requests sent by http clients waiting for response.",
+		}, []string{"host"}),
+	}
+	reg.MustRegister(m.requests, m.duration, m.inflight)
+	return m
+}
+
+func (m *clientMetrics) observe(req *resty.Request, status string) {
+	value, ok := m.pending.Load(req)
+	if !ok {
+		return
+	}
+	m.pending.Delete(req)
+	p := value.(pendingRequest)
+	m.inflight.WithLabelValues(p.host).Dec()
+	inflightRequests.add(p.host, -1)
+	latency := time.Since(p.start)
+	m.requests.WithLabelValues(p.host, p.method, status).Inc()
+	m.duration.WithLabelValues(p.host, p.method).Observe(latency.Seconds())
+	registry.ObserveResult(p.host, status == "error" || strings.HasPrefix(status, "5"), latency)
+}
+
+func (m *clientMetrics) instrument(client *resty.Client) *resty.Client {
+	client.OnBeforeRequest(func(c *resty.Client, req *resty.Request) error {
+		// previous attempt failed before getting response when retrying
+		m.observe(req, "error")
+		host := c.HostURL
+		if u, err := url.Parse(req.URL); err == nil && u.Host != "" {
+			host = u.Host
+		} else if u, err = url.Parse(c.HostURL); err == nil && u.Host != "" {
+			host = u.Host
+		}
+		m.inflight.WithLabelValues(host).Inc()
+		inflightRequests.add(host, 1)
+		m.pending.Store(req, pendingRequest{
+			host:   host,
+			method: req.Method,
+			start:  time.Now(),
+		})
+		return nil
+	})
+	client.OnAfterResponse(func(c *resty.Client, resp *resty.Response) error {
+		m.observe(resp.Request, strconv.Itoa(resp.StatusCode()))
+		return nil
+	})
+	client.OnError(func(req *resty.Request, err error) {
+		m.observe(req, "error")
+	})
+	return client
+}
+
+var (
+	clientMetricsOnce    sync.Once
+	defaultClientMetrics *clientMetrics
+)
+
+// MeasureClient makes client record prometheus metrics http_client_requests_total, http_client_request_duration_seconds
+// and http_client_requests_in_flight labeled by target host. In-flight requests are also counted for NewLeastInFlight
+// and NewP2C load balancers, and results are reported to registry.ObserveResult for outlier ejection. Clients created by NewClient are already measured, so it is only needed for clients
+// created in other ways
+func MeasureClient(client *resty.Client) *resty.Client {
+	clientMetricsOnce.Do(func() {
+		defaultClientMetrics = newClientMetrics(prometheus.DefaultRegisterer)
+	})
+	return defaultClientMetrics.instrument(client)
+}
@@ -0,0 +1,38 @@
+package ddhttp
+
+import (
+	"github.com/go-resty/resty/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestClientMetrics(t *testing.T) {
+	m := newClientMetrics(prometheus.NewRegistry())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+
+	client := m.instrument(resty.New())
+	_, err := client.R().Get(server.URL + "/user/1")
+	require.NoError(t, err)
+	_, err = client.SetHostURL(server.URL).R().Post("/user")
+	require.NoError(t, err)
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.requests.WithLabelValues(u.Host, "GET", "418")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.requests.WithLabelValues(u.Host, "POST", "418")))
+	assert.Equal(t, float64(0), testutil.ToFloat64(m.inflight.WithLabelValues(u.Host)))
+	assert.Equal(t, 2, testutil.CollectAndCount(m.duration))
+
+	server.Close()
+	_, err = m.instrument(resty.New()).SetRetryCount(1).R().Get(server.URL)
+	require.Error(t, err)
+	assert.Equal(t, float64(2), testutil.ToFloat64(m.requests.WithLabelValues(u.Host, "GET", "error")))
+	assert.Equal(t, float64(0), testutil.ToFloat64(m.inflight.WithLabelValues(u.Host)))
+}
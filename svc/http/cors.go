@@ -0,0 +1,178 @@
+package ddhttp
+
+import (
+	"github.com/unionj-cloud/cast"
+	"github.com/unionj-cloud/go-doudou/sliceutils"
+	"github.com/unionj-cloud/go-doudou/stringutils"
+	"github.com/unionj-cloud/go-doudou/svc/config"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const (
+	defaultCorsMethods = "GET,POST,PUT,PATCH,DELETE,HEAD"
+	defaultCorsHeaders = "Origin,Accept,Content-Type,Authorization,X-Requested-With,X-Request-ID"
+)
+
+// CorsOptions configures Cors middleware
+type CorsOptions struct {
+	// AllowedOrigins can contain one wildcard, such as https://*.example.com. * allows all origins
+	AllowedOrigins []string
+	AllowedMethods []string
+	// AllowedHeaders * allows all headers
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	// MaxAge is in second
+	MaxAge int
+}
+
+func splitList(value string, canonical bool) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if stringutils.IsEmpty(item) {
+			continue
+		}
+		if canonical {
+			item = http.CanonicalHeaderKey(item)
+		}
+		list = append(list, item)
+	}
+	return list
+}
+
+// CorsOptionsFromEnv returns CorsOptions configured by GDD_CORS_* environment variables
+func CorsOptionsFromEnv() CorsOptions {
+	methods := config.GddCorsAllowedMethods.Load()
+	if stringutils.IsEmpty(methods) {
+		methods = defaultCorsMethods
+	}
+	headers := config.GddCorsAllowedHeaders.Load()
+	if stringutils.IsEmpty(headers) {
+		headers = defaultCorsHeaders
+	}
+	return CorsOptions{
+		AllowedOrigins:   splitList(config.GddCorsAllowedOrigins.Load(), false),
+		AllowedMethods:   splitList(strings.ToUpper(methods), false),
+		AllowedHeaders:   splitList(headers, true),
+		ExposedHeaders:   splitList(config.GddCorsExposedHeaders.Load(), true),
+		AllowCredentials: config.GddCorsAllowCredentials.Load() == "true",
+		MaxAge:           cast.ToInt(config.GddCorsMaxAge.Load()),
+	}
+}
+
+type cors struct {
+	opts CorsOptions
+}
+
+func (c *cors) originAllowed(origin string) bool {
+	for _, item := range c.opts.AllowedOrigins {
+		if item == "*" || item == origin {
+			return true
+		}
+		if i := strings.Index(item, "*"); i >= 0 {
+			prefix, suffix := item[:i], item[i+1:]
+			if len(origin) >= len(prefix)+len(suffix) && strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c *cors) headersAllowed(requested string) bool {
+	if sliceutils.StringContains(c.opts.AllowedHeaders, "*") {
+		return true
+	}
+	for _, header := range splitList(requested, true) {
+		if !sliceutils.StringContains(c.opts.AllowedHeaders, header) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *cors) setOrigin(w http.ResponseWriter, origin string) {
+	w.Header().Add("Vary", "Origin")
+	if sliceutils.StringContains(c.opts.AllowedOrigins, "*") && !c.opts.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	} else {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+	}
+	if c.opts.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func (c *cors) preflight(w http.ResponseWriter, r *http.Request, origin string) {
+	w.Header().Add("Vary", "Access-Control-Request-Method")
+	w.Header().Add("Vary", "Access-Control-Request-Headers")
+	method := strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))
+	requested := r.Header.Get("Access-Control-Request-Headers")
+	if !sliceutils.StringContains(c.opts.AllowedMethods, method) || !c.headersAllowed(requested) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	c.setOrigin(w, origin)
+	w.Header().Set("Access-Control-Allow-Methods", strings.Join(c.opts.AllowedMethods, ","))
+	if sliceutils.StringContains(c.opts.AllowedHeaders, "*") {
+		if stringutils.IsNotEmpty(requested) {
+			w.Header().Set("Access-Control-Allow-Headers", requested)
+		}
+	} else {
+		w.Header().Set("Access-Control-Allow-Headers", strings.Join(c.opts.AllowedHeaders, ","))
+	}
+	if c.opts.MaxAge > 0 {
+		w.Header().Set("Access-Control-Max-Age", cast.ToString(c.opts.MaxAge))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *cors) middleware(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if stringutils.IsEmpty(origin) || len(c.opts.AllowedOrigins) == 0 {
+			inner.ServeHTTP(w, r)
+			return
+		}
+		if !c.originAllowed(origin) {
+			if r.Method == http.MethodOptions && stringutils.IsNotEmpty(r.Header.Get("Access-Control-Request-Method")) {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			inner.ServeHTTP(w, r)
+			return
+		}
+		if r.Method == http.MethodOptions && stringutils.IsNotEmpty(r.Header.Get("Access-Control-Request-Method")) {
+			c.preflight(w, r, origin)
+			return
+		}
+		c.setOrigin(w, origin)
+		if len(c.opts.ExposedHeaders) > 0 {
+			w.Header().Set("Access-Control-Expose-Headers", strings.Join(c.opts.ExposedHeaders, ","))
+		}
+		inner.ServeHTTP(w, r)
+	})
+}
+
+// NewCors returns cors middleware configured by opts
+func NewCors(opts CorsOptions) func(http.Handler) http.Handler {
+	return (&cors{opts: opts}).middleware
+}
+
+var (
+	corsOnce    sync.Once
+	defaultCors func(http.Handler) http.Handler
+)
+
+// Cors handles cross-origin requests configured by GDD_CORS_* environment variables.
+// It answers preflight requests by itself, so put it before authentication middlewares.
+// If GDD_CORS_ALLOWED_ORIGINS is empty or not set, it does nothing
+func Cors(inner http.Handler) http.Handler {
+	corsOnce.Do(func() {
+		defaultCors = NewCors(CorsOptionsFromEnv())
+	})
+	return defaultCors(inner)
+}
@@ -0,0 +1,111 @@
+package ddhttp
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/unionj-cloud/go-doudou/svc/config"
+	"github.com/unionj-cloud/go-doudou/svc/http/model"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func newCorsSrv(opts CorsOptions) *DefaultHttpSrv {
+	srv := NewDefaultHttpSrv()
+	srv.AddMiddleware(NewCors(opts))
+	srv.AddRoute(model.Route{
+		Name:    "GetUser",
+		Method:  "GET",
+		Pattern: "/user",
+		HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("user"))
+		},
+	}, model.Route{
+		Name:        "DeleteUser",
+		Method:      "DELETE",
+		Pattern:     "/user",
+		HandlerFunc: func(w http.ResponseWriter, r *http.Request) {},
+	})
+	return srv
+}
+
+func TestCorsOptionsFromEnv(t *testing.T) {
+	config.GddCorsAllowedOrigins.Write("https://example.com, https://*.example.com")
+	config.GddCorsAllowedHeaders.Write("content-type,x-token")
+	config.GddCorsAllowCredentials.Write("true")
+	config.GddCorsMaxAge.Write("600")
+	defer func() {
+		os.Unsetenv(config.GddCorsAllowedOrigins.String())
+		os.Unsetenv(config.GddCorsAllowedHeaders.String())
+		os.Unsetenv(config.GddCorsAllowCredentials.String())
+		os.Unsetenv(config.GddCorsMaxAge.String())
+	}()
+	assert.Equal(t, CorsOptions{
+		AllowedOrigins:   []string{"https://example.com", "https://*.example.com"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD"},
+		AllowedHeaders:   []string{"Content-Type", "X-Token"},
+		AllowCredentials: true,
+		MaxAge:           600,
+	}, CorsOptionsFromEnv())
+}
+
+func TestCorsPreflight(t *testing.T) {
+	srv := newCorsSrv(CorsOptions{
+		AllowedOrigins:   []string{"https://*.example.com"},
+		AllowedMethods:   []string{"GET", "DELETE"},
+		AllowedHeaders:   []string{"Content-Type", "Authorization"},
+		AllowCredentials: true,
+		MaxAge:           600,
+	})
+	preflight := func(origin, method, headers string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("OPTIONS", "/user", nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", method)
+		req.Header.Set("Access-Control-Request-Headers", headers)
+		rec := httptest.NewRecorder()
+		srv.rootRouter.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := preflight("https://app.example.com", "DELETE", "authorization")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "https://app.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "GET,DELETE", rec.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "Content-Type,Authorization", rec.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "true", rec.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "600", rec.Header().Get("Access-Control-Max-Age"))
+
+	rec = preflight("https://evil.com", "DELETE", "")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+
+	rec = preflight("https://app.example.com", "PUT", "")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = preflight("https://app.example.com", "GET", "X-Unknown")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestCorsActualRequest(t *testing.T) {
+	srv := newCorsSrv(CorsOptions{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{"GET"},
+		ExposedHeaders: []string{"X-Request-Id"},
+	})
+	req := httptest.NewRequest("GET", "/user", nil)
+	req.Header.Set("Origin", "https://example.com")
+	rec := httptest.NewRecorder()
+	srv.rootRouter.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "user", rec.Body.String())
+	assert.Equal(t, "*", rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "X-Request-Id", rec.Header().Get("Access-Control-Expose-Headers"))
+}
+
+func TestDefaultHttpSrv_Options(t *testing.T) {
+	srv := newCorsSrv(CorsOptions{})
+	rec := httptest.NewRecorder()
+	srv.rootRouter.ServeHTTP(rec, httptest.NewRequest("OPTIONS", "/user", nil))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "GET,DELETE,OPTIONS", rec.Header().Get("Allow"))
+}
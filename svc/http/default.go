@@ -2,19 +2,25 @@ package ddhttp
 
 import (
 	"context"
+	"fmt"
 	"github.com/common-nighthawk/go-figure"
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
 	"github.com/unionj-cloud/go-doudou/stringutils"
 	"github.com/unionj-cloud/go-doudou/svc/config"
+	"github.com/unionj-cloud/go-doudou/svc/http/health"
 	"github.com/unionj-cloud/go-doudou/svc/http/model"
 	"github.com/unionj-cloud/go-doudou/svc/http/onlinedoc"
 	"github.com/unionj-cloud/go-doudou/svc/http/prometheus"
 	"github.com/unionj-cloud/go-doudou/svc/http/registry"
+	ddregistry "github.com/unionj-cloud/go-doudou/svc/registry"
+	"github.com/unionj-cloud/go-doudou/svc/tracing"
 	"net/http"
 	"os"
 	"os/signal"
 	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
@@ -23,6 +29,14 @@ type DefaultHttpSrv struct {
 	*mux.Router
 	rootRouter *mux.Router
 	routes     []model.Route
+	// roles stores roles required by routes, key is route name
+	roles map[string][]string
+	// methods stores methods registered for each path pattern, used for answering OPTIONS requests
+	methods map[string][]string
+	// ready is 1 when http server is serving, 0 when it is starting or draining
+	ready         int32
+	startHooks    []func(ctx context.Context) error
+	shutdownHooks []func(ctx context.Context) error
 }
 
 const gddPathPrefix = "/go-doudou/"
@@ -31,7 +45,30 @@ const gddPathPrefix = "/go-doudou/"
 func NewDefaultHttpSrv() *DefaultHttpSrv {
 	rootRouter := mux.NewRouter().StrictSlash(true)
 	bizRouter := rootRouter.PathPrefix(config.GddRouteRootPath.Load()).Subrouter().StrictSlash(true)
-	var routes []model.Route
+	srv := &DefaultHttpSrv{
+		Router:     bizRouter,
+		rootRouter: rootRouter,
+		roles:      make(map[string][]string),
+		methods:    make(map[string][]string),
+	}
+	bizRouter.Use(srv.withRoles)
+	if logFile != nil {
+		// registered before tracing so that logs of all other shutdown hooks are written to the file
+		srv.OnShutdown(closeLogFile)
+	}
+	// registered first so that spans from other shutdown hooks are flushed as well
+	srv.OnShutdown(tracing.Shutdown)
+	// health routes are not protected by http basic auth for kubernetes probes
+	healthRouter := rootRouter.PathPrefix(gddPathPrefix + "health").Subrouter()
+	healthRoutes := health.Routes(srv.Ready)
+	for _, item := range healthRoutes {
+		healthRouter.
+			Methods(item.Method).
+			Path("/" + strings.TrimPrefix(item.Pattern, gddPathPrefix+"health/")).
+			Name(item.Name).
+			Handler(item.HandlerFunc)
+	}
+	srv.routes = append(srv.routes, healthRoutes...)
 	if config.GddManage.Load() == "true" {
 		bizRouter.Use(prometheus.PrometheusMiddleware)
 		gddRouter := rootRouter.PathPrefix(gddPathPrefix).Subrouter().StrictSlash(true)
@@ -47,13 +84,9 @@ func NewDefaultHttpSrv() *DefaultHttpSrv {
 				Name(item.Name).
 				Handler(item.HandlerFunc)
 		}
-		routes = append(routes, mergedRoutes...)
-	}
-	return &DefaultHttpSrv{
-		Router:     bizRouter,
-		rootRouter: rootRouter,
-		routes:     routes,
+		srv.routes = append(srv.routes, mergedRoutes...)
 	}
+	return srv
 }
 
 // AddRoute adds routes to router
@@ -64,12 +97,43 @@ func (srv *DefaultHttpSrv) AddRoute(route ...model.Route) {
 	srv.routes = routes[:]
 	routes = nil
 	for _, item := range route {
+		if len(item.Roles) > 0 {
+			srv.roles[item.Name] = item.Roles
+		}
 		srv.
 			Methods(item.Method).
 			Path(item.Pattern).
 			Name(item.Name).
-			Handler(item.HandlerFunc)
+			Handler(routeHandler(item))
 	}
+	for _, item := range route {
+		methods, exists := srv.methods[item.Pattern]
+		srv.methods[item.Pattern] = append(methods, item.Method)
+		if exists || item.Method == http.MethodOptions {
+			continue
+		}
+		srv.
+			Methods(http.MethodOptions).
+			Path(item.Pattern).
+			Handler(srv.options(item.Pattern))
+	}
+}
+
+// options answers OPTIONS requests to the pattern, preflight requests are answered by Cors middleware before it
+func (srv *DefaultHttpSrv) options(pattern string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Allow", strings.Join(append(srv.methods[pattern], http.MethodOptions), ","))
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// routeHandler wraps handler of the route with its own middlewares
+func routeHandler(route model.Route) http.Handler {
+	var handler http.Handler = route.HandlerFunc
+	for i := len(route.Middlewares) - 1; i >= 0; i-- {
+		handler = route.Middlewares[i](handler)
+	}
+	return handler
 }
 
 // AddMiddleware adds middlewares to router
@@ -81,6 +145,65 @@ func (srv *DefaultHttpSrv) AddMiddleware(mwf ...func(http.Handler) http.Handler)
 	srv.Use(middlewares...)
 }
 
+// Ready returns true if http server is serving and not draining
+func (srv *DefaultHttpSrv) Ready() bool {
+	return atomic.LoadInt32(&srv.ready) == 1
+}
+
+func graceTimeout() time.Duration {
+	grace, err := time.ParseDuration(config.GddGraceTimeout.Load())
+	if err != nil {
+		logrus.Warnf("Parse %s %s as time.Duration failed: %s, use default 15s instead.\n", config.GddGraceTimeout,
+			config.GddGraceTimeout.Load(), err.Error())
+		grace = 15 * time.Second
+	}
+	return grace
+}
+
+func preStopDelay() time.Duration {
+	if stringutils.IsEmpty(config.GddPreStopDelay.Load()) {
+		return 0
+	}
+	delay, err := time.ParseDuration(config.GddPreStopDelay.Load())
+	if err != nil || delay < 0 {
+		logrus.Warnf("Parse %s %s as time.Duration failed, no delay instead.\n", config.GddPreStopDelay,
+			config.GddPreStopDelay.Load())
+		delay = 0
+	}
+	return delay
+}
+
+// shutdown drains the server within GDD_GRACE_TIMEOUT. It fails readiness and leaves memberlist cluster first,
+// and waits GDD_PRESTOP_DELAY so that load balancers stop sending requests, then stops accepting new connections
+// and waits for in-flight requests, finally runs shutdown hooks with what remains of the deadline
+func (srv *DefaultHttpSrv) shutdown(server *http.Server) {
+	atomic.StoreInt32(&srv.ready, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), graceTimeout())
+	defer cancel()
+	deadline, _ := ctx.Deadline()
+	if ddregistry.LocalNode != nil {
+		ddregistry.LocalNode.Leave(time.Until(deadline))
+	}
+
+	if delay := preStopDelay(); delay > 0 {
+		logrus.Infof("Wait %s before stopping http server\n", delay)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+	}
+
+	// Doesn't block if no connections, but will otherwise wait
+	// until the timeout deadline.
+	if err := server.Shutdown(ctx); err != nil {
+		logrus.Warnf("Http server shutdown fail: %s, some in-flight requests may be interrupted\n", err.Error())
+	}
+
+	srv.runShutdownHooks(ctx)
+}
+
 // Run runs http server
 func (srv *DefaultHttpSrv) Run() {
 	start := time.Now()
@@ -97,33 +220,42 @@ func (srv *DefaultHttpSrv) Run() {
 	printRoutes(srv.routes)
 
 	server := newServer(srv.rootRouter)
+	serveErrs := startServer(server)
+	fail := func(err error) {
+		srv.shutdown(server)
+		logrus.Panicln(fmt.Sprintf("%+v", err))
+	}
+	select {
+	case err := <-serveErrs:
+		fail(err)
+	default:
+	}
+	if err := srv.runStartHooks(startTimeout()); err != nil {
+		fail(err)
+	}
+	select {
+	case err := <-serveErrs:
+		fail(err)
+	default:
+	}
+	atomic.StoreInt32(&srv.ready, 1)
 
 	logrus.Infof("Started in %s\n", time.Since(start))
 
 	c := make(chan os.Signal, 1)
-	// We'll accept graceful shutdowns when quit via SIGINT (Ctrl+C)
-	// SIGKILL, SIGQUIT or SIGTERM (Ctrl+/) will not be caught.
-	signal.Notify(c, os.Interrupt)
-
-	// Block until we receive our signal.
-	<-c
+	// We'll accept graceful shutdowns when quit via SIGINT (Ctrl+C) or SIGTERM sent by kubernetes
+	// SIGKILL or SIGQUIT (Ctrl+/) will not be caught.
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 
-	// Create a deadline to wait for.
-	grace, err := time.ParseDuration(config.GddGraceTimeout.Load())
-	if err != nil {
-		logrus.Warnf("Parse %s %s as time.Duration failed: %s, use default 15s instead.\n", "GDD_GRACETIMEOUT",
-			config.GddGraceTimeout.Load(), err.Error())
-		grace = 15 * time.Second
+	// Block until we receive our signal, or the server stops unexpectedly.
+	select {
+	case sig := <-c:
+		logrus.Infof("Received signal %s, start draining\n", sig)
+	case err := <-serveErrs:
+		fail(err)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), grace)
-	defer cancel()
-	// Doesn't block if no connections, but will otherwise wait
-	// until the timeout deadline.
-	server.Shutdown(ctx)
+	srv.shutdown(server)
 
-	// Optionally, you could run srv.Shutdown in a goroutine and block on
-	// <-ctx.Done() if your application should wait for other services
-	// to finalize based on context cancellation.
 	logrus.Infoln("shutting down")
 }
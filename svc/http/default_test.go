@@ -0,0 +1,229 @@
+package ddhttp
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/svc/config"
+	"github.com/unionj-cloud/go-doudou/svc/http/health"
+	"github.com/unionj-cloud/go-doudou/svc/http/model"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDefaultHttpSrv_AddRoute(t *testing.T) {
+	var trace []string
+	mw := func(name string) func(http.Handler) http.Handler {
+		return func(inner http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				trace = append(trace, name)
+				inner.ServeHTTP(w, r)
+			})
+		}
+	}
+	var roles []string
+	srv := NewDefaultHttpSrv()
+	srv.AddMiddleware(func(inner http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			roles = RolesFromContext(r.Context())
+			inner.ServeHTTP(w, r)
+		})
+	})
+	srv.AddRoute(model.Route{
+		Name:    "GetUser",
+		Method:  "GET",
+		Pattern: "/user",
+		HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+			trace = append(trace, "handler")
+		},
+		Middlewares: []func(http.Handler) http.Handler{mw("first"), mw("second")},
+		Roles:       []string{"admin"},
+	}, model.Route{
+		Name:    "GetBook",
+		Method:  "GET",
+		Pattern: "/book",
+		HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+			trace = append(trace, "handler")
+		},
+	})
+
+	srv.rootRouter.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/user", nil))
+	assert.Equal(t, []string{"first", "second", "handler"}, trace)
+	assert.Equal(t, []string{"admin"}, roles)
+
+	trace = nil
+	srv.rootRouter.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/book", nil))
+	assert.Equal(t, []string{"handler"}, trace)
+	assert.Empty(t, roles)
+}
+
+func TestDefaultHttpSrv_shutdown(t *testing.T) {
+	srv := NewDefaultHttpSrv()
+	started := make(chan struct{})
+	srv.AddRoute(model.Route{
+		Name:    "GetSlow",
+		Method:  "GET",
+		Pattern: "/slow",
+		HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			time.Sleep(200 * time.Millisecond)
+			w.Write([]byte("done"))
+		},
+	})
+	var hooks []string
+	srv.OnShutdown(func(ctx context.Context) error {
+		hooks = append(hooks, "first")
+		return nil
+	}, func(ctx context.Context) error {
+		hooks = append(hooks, "second")
+		return errors.New("mock error")
+	})
+	ts := httptest.NewServer(srv.rootRouter)
+	defer ts.Close()
+	atomic.StoreInt32(&srv.ready, 1)
+	assert.True(t, srv.Ready())
+
+	type result struct {
+		body string
+		err  error
+	}
+	done := make(chan result)
+	go func() {
+		resp, err := http.Get(ts.URL + "/slow")
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		done <- result{body: string(body), err: err}
+	}()
+	<-started
+
+	srv.shutdown(ts.Config)
+	assert.False(t, srv.Ready())
+	assert.Equal(t, []string{"second", "first"}, hooks)
+	res := <-done
+	assert.NoError(t, res.err)
+	assert.Equal(t, "done", res.body)
+}
+
+func TestDefaultHttpSrv_shutdownDeadline(t *testing.T) {
+	_ = config.GddGraceTimeout.Write("300ms")
+	_ = config.GddPreStopDelay.Write("100ms")
+	defer func() {
+		os.Unsetenv(config.GddGraceTimeout.String())
+		os.Unsetenv(config.GddPreStopDelay.String())
+	}()
+	srv := NewDefaultHttpSrv()
+	srv.AddRoute(model.Route{
+		Name:    "GetPing",
+		Method:  "GET",
+		Pattern: "/ping",
+		HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("pong"))
+		},
+	})
+	deadlines := make(chan time.Time, 2)
+	srv.OnShutdown(func(ctx context.Context) error {
+		deadline, _ := ctx.Deadline()
+		deadlines <- deadline
+		return nil
+	}, func(ctx context.Context) error {
+		deadline, _ := ctx.Deadline()
+		deadlines <- deadline
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	ts := httptest.NewServer(srv.rootRouter)
+	defer ts.Close()
+	atomic.StoreInt32(&srv.ready, 1)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		srv.shutdown(ts.Config)
+	}()
+	// requests are still served during pre-stop delay
+	time.Sleep(20 * time.Millisecond)
+	assert.False(t, srv.Ready())
+	if resp, err := http.Get(ts.URL + "/ping"); assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	start := time.Now()
+	<-done
+	elapsed := time.Since(start)
+	assert.True(t, elapsed > 200*time.Millisecond && elapsed < time.Second, elapsed)
+	// hooks share the deadline, the first one blocking till the deadline makes the other skipped
+	assert.Len(t, deadlines, 1)
+	assert.WithinDuration(t, start.Add(280*time.Millisecond), <-deadlines, 50*time.Millisecond)
+}
+
+func TestDefaultHttpSrv_RunListenFailed(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	_ = config.GddHost.Write("127.0.0.1")
+	_ = config.GddPort.Write(port)
+	_ = config.GddBanner.Write("false")
+	defer func() {
+		os.Unsetenv(config.GddHost.String())
+		os.Unsetenv(config.GddPort.String())
+		os.Unsetenv(config.GddBanner.String())
+	}()
+	srv := NewDefaultHttpSrv()
+	var trace []string
+	srv.OnStart(func(ctx context.Context) error {
+		trace = append(trace, "start")
+		return nil
+	})
+	srv.OnShutdown(func(ctx context.Context) error {
+		trace = append(trace, "shutdown")
+		return nil
+	})
+	assert.Panics(t, srv.Run)
+	assert.False(t, srv.Ready())
+	assert.Equal(t, []string{"shutdown"}, trace)
+}
+
+func TestDefaultHttpSrv_health(t *testing.T) {
+	config.GddManageUser.Write("admin")
+	config.GddManagePass.Write("admin")
+	defer func() {
+		os.Unsetenv(config.GddManageUser.String())
+		os.Unsetenv(config.GddManagePass.String())
+	}()
+	srv := NewDefaultHttpSrv()
+
+	rec := httptest.NewRecorder()
+	srv.rootRouter.ServeHTTP(rec, httptest.NewRequest("GET", "/go-doudou/health/live", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	srv.rootRouter.ServeHTTP(rec, httptest.NewRequest("GET", "/go-doudou/health/ready", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	atomic.StoreInt32(&srv.ready, 1)
+	rec = httptest.NewRecorder()
+	srv.rootRouter.ServeHTTP(rec, httptest.NewRequest("GET", "/go-doudou/health/ready", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	RegisterHealthCheck("db", func(ctx context.Context) error {
+		return errors.New("connection refused")
+	})
+	defer health.UnregisterHealthCheck("db")
+	rec = httptest.NewRecorder()
+	srv.rootRouter.ServeHTTP(rec, httptest.NewRequest("GET", "/go-doudou/health/ready", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Contains(t, rec.Body.String(), "connection refused")
+}
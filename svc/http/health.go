@@ -0,0 +1,12 @@
+package ddhttp
+
+import (
+	"context"
+	"github.com/unionj-cloud/go-doudou/svc/http/health"
+)
+
+// RegisterHealthCheck registers a named check run by readiness probe /go-doudou/health/ready,
+// such as RegisterHealthCheck("db", conn.PingContext). Memberlist check is registered by registry.NewNode
+func RegisterHealthCheck(name string, check func(ctx context.Context) error) {
+	health.RegisterHealthCheck(name, check)
+}
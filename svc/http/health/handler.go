@@ -0,0 +1,55 @@
+package health
+
+import (
+	"encoding/json"
+	"github.com/unionj-cloud/go-doudou/svc/http/model"
+	"net/http"
+)
+
+func write(w http.ResponseWriter, result Result) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if result.Status != StatusUp {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(result)
+}
+
+// Live answers liveness probe. It only tells the process is alive and doesn't run any check,
+// so that the pod won't be restarted when dependencies like database are down
+func Live(w http.ResponseWriter, r *http.Request) {
+	write(w, Result{
+		Status: StatusUp,
+	})
+}
+
+// Ready returns handler for readiness probe. It fails if ready returns false,
+// such as when the server is starting or draining, or if any registered check fails
+func Ready(ready func() bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !ready() {
+			write(w, Result{
+				Status: StatusDown,
+			})
+			return
+		}
+		write(w, Check(r.Context()))
+	}
+}
+
+// Routes return route slice for gorilla mux
+func Routes(ready func() bool) []model.Route {
+	return []model.Route{
+		{
+			Name:        "HealthLive",
+			Method:      "GET",
+			Pattern:     "/go-doudou/health/live",
+			HandlerFunc: Live,
+		},
+		{
+			Name:        "HealthReady",
+			Method:      "GET",
+			Pattern:     "/go-doudou/health/ready",
+			HandlerFunc: Ready(ready),
+		},
+	}
+}
@@ -0,0 +1,111 @@
+package health
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// checkTimeout bounds each health check, so that a hanging dependency cannot block probes
+const checkTimeout = 3 * time.Second
+
+var (
+	checksLock sync.RWMutex
+	checks     = make(map[string]func(ctx context.Context) error)
+)
+
+// RegisterHealthCheck registers a named check which is run by readiness probe.
+// Registering with an existing name replaces the old check
+func RegisterHealthCheck(name string, check func(ctx context.Context) error) {
+	checksLock.Lock()
+	defer checksLock.Unlock()
+	checks[name] = check
+}
+
+// UnregisterHealthCheck removes the named check
+func UnregisterHealthCheck(name string) {
+	checksLock.Lock()
+	defer checksLock.Unlock()
+	delete(checks, name)
+}
+
+const (
+	// StatusUp means healthy
+	StatusUp = "UP"
+	// StatusDown means unhealthy
+	StatusDown = "DOWN"
+)
+
+// CheckResult represents result of a health check
+type CheckResult struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Result represents overall health status
+type Result struct {
+	Status string        `json:"status"`
+	Checks []CheckResult `json:"checks,omitempty"`
+}
+
+// Check runs all registered checks concurrently and returns overall result.
+// The overall status is DOWN if any check fails
+func Check(ctx context.Context) Result {
+	checksLock.RLock()
+	snapshot := make(map[string]func(ctx context.Context) error, len(checks))
+	for name, check := range checks {
+		snapshot[name] = check
+	}
+	checksLock.RUnlock()
+
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	result := Result{
+		Status: StatusUp,
+	}
+	var (
+		wg   sync.WaitGroup
+		lock sync.Mutex
+	)
+	for name, check := range snapshot {
+		wg.Add(1)
+		go func(name string, check func(ctx context.Context) error) {
+			defer wg.Done()
+			cr := CheckResult{
+				Name:   name,
+				Status: StatusUp,
+			}
+			if err := run(ctx, check); err != nil {
+				cr.Status = StatusDown
+				cr.Error = err.Error()
+			}
+			lock.Lock()
+			defer lock.Unlock()
+			result.Checks = append(result.Checks, cr)
+			if cr.Status == StatusDown {
+				result.Status = StatusDown
+			}
+		}(name, check)
+	}
+	wg.Wait()
+	sort.Slice(result.Checks, func(i, j int) bool {
+		return result.Checks[i].Name < result.Checks[j].Name
+	})
+	return result
+}
+
+// run runs check and returns ctx error if it doesn't return in time
+func run(ctx context.Context, check func(ctx context.Context) error) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- check(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
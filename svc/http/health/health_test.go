@@ -0,0 +1,62 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCheck(t *testing.T) {
+	RegisterHealthCheck("ok", func(ctx context.Context) error {
+		return nil
+	})
+	defer UnregisterHealthCheck("ok")
+	assert.Equal(t, Result{
+		Status: StatusUp,
+		Checks: []CheckResult{{Name: "ok", Status: StatusUp}},
+	}, Check(context.Background()))
+
+	RegisterHealthCheck("db", func(ctx context.Context) error {
+		return errors.New("connection refused")
+	})
+	defer UnregisterHealthCheck("db")
+	RegisterHealthCheck("slow", func(ctx context.Context) error {
+		time.Sleep(time.Hour)
+		return nil
+	})
+	defer UnregisterHealthCheck("slow")
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, Result{
+		Status: StatusDown,
+		Checks: []CheckResult{
+			{Name: "db", Status: StatusDown, Error: "connection refused"},
+			{Name: "ok", Status: StatusUp},
+			{Name: "slow", Status: StatusDown, Error: context.DeadlineExceeded.Error()},
+		},
+	}, Check(ctx))
+}
+
+func TestReady(t *testing.T) {
+	ready := false
+	handler := Ready(func() bool {
+		return ready
+	})
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("GET", "/go-doudou/health/ready", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	ready = true
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("GET", "/go-doudou/health/ready", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var result Result
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &result))
+	assert.Equal(t, StatusUp, result.Status)
+}
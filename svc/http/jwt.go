@@ -0,0 +1,380 @@
+package ddhttp
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/unionj-cloud/go-doudou/sliceutils"
+	"github.com/unionj-cloud/go-doudou/stringutils"
+	"github.com/unionj-cloud/go-doudou/svc/config"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Claims wraps claims of a validated bearer token
+type Claims map[string]interface{}
+
+// Subject returns sub claim
+func (c Claims) Subject() string {
+	sub, _ := c["sub"].(string)
+	return sub
+}
+
+// Strings returns value of the claim as string slice. Space-separated string value such as scope claim is split.
+func (c Claims) Strings(name string) []string {
+	switch value := c[name].(type) {
+	case string:
+		return strings.Fields(value)
+	case []interface{}:
+		var ret []string
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				ret = append(ret, s)
+			}
+		}
+		return ret
+	default:
+		return nil
+	}
+}
+
+type claimsCtxKey struct{}
+
+// ClaimsFromContext returns claims of the bearer token validated by BearerAuth
+func ClaimsFromContext(ctx context.Context) (Claims, bool) {
+	claims, ok := ctx.Value(claimsCtxKey{}).(Claims)
+	return claims, ok
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// jwtValidator validates bearer tokens against a HMAC secret or public keys from a local JWKS file
+type jwtValidator struct {
+	secret     []byte
+	keys       map[string]crypto.PublicKey
+	issuer     string
+	audience   string
+	leeway     time.Duration
+	rolesClaim string
+	// allowNoExp accepts tokens without exp claim, which never expire
+	allowNoExp bool
+}
+
+func newJwtValidator() (*jwtValidator, error) {
+	v := &jwtValidator{
+		secret:     []byte(config.GddJwtSecret.Load()),
+		issuer:     config.GddJwtIssuer.Load(),
+		audience:   config.GddJwtAudience.Load(),
+		rolesClaim: config.GddJwtRolesClaim.Load(),
+		allowNoExp: config.GddJwtAllowNoExp.Load() == "true",
+	}
+	if stringutils.IsEmpty(v.rolesClaim) {
+		v.rolesClaim = "roles"
+	}
+	if leeway := config.GddJwtLeeway.Load(); stringutils.IsNotEmpty(leeway) {
+		var err error
+		if v.leeway, err = time.ParseDuration(leeway); err != nil {
+			logrus.Warnf("Parse %s %s as time.Duration failed: %s, use default 0s instead.\n", "GDD_JWT_LEEWAY",
+				leeway, err.Error())
+		}
+	}
+	if jwksfile := config.GddJwtJwks.Load(); stringutils.IsNotEmpty(jwksfile) {
+		keys, err := loadJwks(jwksfile)
+		if err != nil {
+			return nil, err
+		}
+		v.keys = keys
+	}
+	if len(v.secret) == 0 && len(v.keys) == 0 {
+		return nil, errors.Errorf("neither %s nor %s is configured", config.GddJwtSecret, config.GddJwtJwks)
+	}
+	return v, nil
+}
+
+func loadJwks(file string) (map[string]crypto.PublicKey, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "read jwks file failed")
+	}
+	var jwks struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err = json.Unmarshal(data, &jwks); err != nil {
+		return nil, errors.Wrap(err, "parse jwks file failed")
+	}
+	keys := make(map[string]crypto.PublicKey)
+	for _, key := range jwks.Keys {
+		pub, err := key.publicKey()
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse key %s failed", key.Kid)
+		}
+		keys[key.Kid] = pub
+	}
+	return keys, nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, errors.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, errors.Errorf("unsupported key type %s", k.Kty)
+	}
+}
+
+func hashOf(alg string) (crypto.Hash, error) {
+	if len(alg) != 5 {
+		return 0, errors.Errorf("unsupported alg %s", alg)
+	}
+	switch alg[2:] {
+	case "256":
+		return crypto.SHA256, nil
+	case "384":
+		return crypto.SHA384, nil
+	case "512":
+		return crypto.SHA512, nil
+	default:
+		return 0, errors.Errorf("unsupported alg %s", alg)
+	}
+}
+
+func (v *jwtValidator) verifySignature(header jwtHeader, signingInput, signature []byte) error {
+	hash, err := hashOf(header.Alg)
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(header.Alg, "HS") {
+		if len(v.secret) == 0 {
+			return errors.Errorf("alg %s is not allowed", header.Alg)
+		}
+		mac := hmac.New(hash.New, v.secret)
+		mac.Write(signingInput)
+		if subtle.ConstantTimeCompare(mac.Sum(nil), signature) != 1 {
+			return errors.New("invalid signature")
+		}
+		return nil
+	}
+	key, ok := v.keys[header.Kid]
+	if !ok {
+		return errors.Errorf("no key found for kid %s", header.Kid)
+	}
+	h := hash.New()
+	h.Write(signingInput)
+	digest := h.Sum(nil)
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(header.Alg, "RS") {
+			return errors.Errorf("alg %s does not match key type", header.Alg)
+		}
+		if err = rsa.VerifyPKCS1v15(pub, hash, digest, signature); err != nil {
+			return errors.New("invalid signature")
+		}
+	case *ecdsa.PublicKey:
+		if !strings.HasPrefix(header.Alg, "ES") {
+			return errors.Errorf("alg %s does not match key type", header.Alg)
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return errors.New("invalid signature")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return errors.New("invalid signature")
+		}
+	default:
+		return errors.Errorf("unsupported key for kid %s", header.Kid)
+	}
+	return nil
+}
+
+func numericDate(claims Claims, name string) (time.Time, bool) {
+	value, ok := claims[name].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(value), 0), true
+}
+
+// Validate validates the token and returns its claims
+func (v *jwtValidator) Validate(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+	var (
+		header    jwtHeader
+		claims    Claims
+		raw       []byte
+		signature []byte
+		err       error
+	)
+	if raw, err = base64.RawURLEncoding.DecodeString(parts[0]); err != nil {
+		return nil, errors.Wrap(err, "malformed token header")
+	}
+	if err = json.Unmarshal(raw, &header); err != nil {
+		return nil, errors.Wrap(err, "malformed token header")
+	}
+	if signature, err = base64.RawURLEncoding.DecodeString(parts[2]); err != nil {
+		return nil, errors.Wrap(err, "malformed token signature")
+	}
+	if err = v.verifySignature(header, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+	if raw, err = base64.RawURLEncoding.DecodeString(parts[1]); err != nil {
+		return nil, errors.Wrap(err, "malformed token payload")
+	}
+	if err = json.Unmarshal(raw, &claims); err != nil {
+		return nil, errors.Wrap(err, "malformed token payload")
+	}
+	now := time.Now()
+	exp, ok := numericDate(claims, "exp")
+	if !ok && !v.allowNoExp {
+		return nil, errors.New("token has no exp claim")
+	}
+	if ok && now.After(exp.Add(v.leeway)) {
+		return nil, errors.New("token is expired")
+	}
+	if nbf, ok := numericDate(claims, "nbf"); ok && now.Add(v.leeway).Before(nbf) {
+		return nil, errors.New("token is not valid yet")
+	}
+	if stringutils.IsNotEmpty(v.issuer) {
+		if iss, _ := claims["iss"].(string); iss != v.issuer {
+			return nil, errors.Errorf("invalid issuer %s", iss)
+		}
+	}
+	if stringutils.IsNotEmpty(v.audience) && !sliceutils.StringContains(claims.Strings("aud"), v.audience) {
+		return nil, errors.New("invalid audience")
+	}
+	return claims, nil
+}
+
+func hasAnyRole(userRoles []string, roles []string) bool {
+	for _, role := range roles {
+		if sliceutils.StringContains(userRoles, role) {
+			return true
+		}
+	}
+	return false
+}
+
+func bearerError(w http.ResponseWriter, code int, errCode string, err error) {
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="%s", error_description="%s"`, errCode, err.Error()))
+	http.Error(w, err.Error(), code)
+}
+
+// middleware validates bearer token and checks roles declared by the matched route
+func (v *jwtValidator) middleware(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if len(auth) < 7 || !strings.EqualFold(auth[:7], "Bearer ") {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "missing bearer token", http.StatusUnauthorized)
+			return
+		}
+		claims, err := v.Validate(strings.TrimSpace(auth[7:]))
+		if err != nil {
+			bearerError(w, http.StatusUnauthorized, "invalid_token", err)
+			return
+		}
+		if roles := RolesFromContext(r.Context()); len(roles) > 0 && !hasAnyRole(claims.Strings(v.rolesClaim), roles) {
+			bearerError(w, http.StatusForbidden, "insufficient_scope", errors.New("permission denied"))
+			return
+		}
+		ctx := setLogUser(context.WithValue(r.Context(), claimsCtxKey{}, claims), claims.Subject())
+		inner.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+var (
+	validatorOnce    sync.Once
+	defaultValidator *jwtValidator
+	validatorErr     error
+)
+
+// misconfigured answers 500 to every request, so that routes are not exposed without authentication
+func misconfigured(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bearer authentication is not configured", http.StatusInternalServerError)
+	})
+}
+
+// BearerAuth validates JWT bearer token in Authorization header against GDD_JWT_SECRET or GDD_JWT_JWKS,
+// then puts claims into request context. If the matched route declared roles by @role annotation,
+// user must have one of them in the claim named by GDD_JWT_ROLES_CLAIM.
+// Validator is created only once, because gorilla mux wraps handler with middlewares for each request.
+// If it failed to be created, the error is logged once and every request is answered with 500
+func BearerAuth(inner http.Handler) http.Handler {
+	validatorOnce.Do(func() {
+		if defaultValidator, validatorErr = newJwtValidator(); validatorErr != nil {
+			logrus.Errorln(fmt.Sprintf("BearerAuth() error: %+v", validatorErr))
+		}
+	})
+	if validatorErr != nil {
+		return misconfigured(inner)
+	}
+	return defaultValidator.middleware(inner)
+}
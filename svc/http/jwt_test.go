@@ -0,0 +1,204 @@
+package ddhttp
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/svc/config"
+	"github.com/unionj-cloud/go-doudou/svc/http/model"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func signingInput(header map[string]interface{}, claims map[string]interface{}) string {
+	h, _ := json.Marshal(header)
+	c, _ := json.Marshal(claims)
+	return b64(h) + "." + b64(c)
+}
+
+func hs256Token(secret string, claims map[string]interface{}) string {
+	input := signingInput(map[string]interface{}{"alg": "HS256", "typ": "JWT"}, claims)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(input))
+	return input + "." + b64(mac.Sum(nil))
+}
+
+func rs256Token(key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	input := signingInput(map[string]interface{}{"alg": "RS256", "typ": "JWT", "kid": kid}, claims)
+	digest := sha256.Sum256([]byte(input))
+	sig, _ := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	return input + "." + b64(sig)
+}
+
+func es256Token(key *ecdsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	input := signingInput(map[string]interface{}{"alg": "ES256", "typ": "JWT", "kid": kid}, claims)
+	digest := sha256.Sum256([]byte(input))
+	r, s, _ := ecdsa.Sign(rand.Reader, key, digest[:])
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return input + "." + b64(sig)
+}
+
+func newBearerSrv() *DefaultHttpSrv {
+	validator, err := newJwtValidator()
+	if err != nil {
+		panic(err)
+	}
+	srv := NewDefaultHttpSrv()
+	srv.AddMiddleware(validator.middleware)
+	srv.AddRoute(model.Route{
+		Name:    "GetUser",
+		Method:  "GET",
+		Pattern: "/user",
+		HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+			claims, _ := ClaimsFromContext(r.Context())
+			w.Write([]byte(claims.Subject()))
+		},
+	}, model.Route{
+		Name:    "DeleteUser",
+		Method:  "DELETE",
+		Pattern: "/user",
+		HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("deleted"))
+		},
+		Roles: []string{"admin"},
+	})
+	return srv
+}
+
+func serve(srv *DefaultHttpSrv, method string, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/user", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	srv.rootRouter.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestBearerAuthHMAC(t *testing.T) {
+	config.GddJwtSecret.Write("secret")
+	defer os.Unsetenv(config.GddJwtSecret.String())
+	srv := newBearerSrv()
+	exp := float64(time.Now().Add(time.Hour).Unix())
+
+	rec := serve(srv, "GET", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = serve(srv, "GET", hs256Token("secret", map[string]interface{}{"sub": "jack", "exp": exp}))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "jack", rec.Body.String())
+
+	rec = serve(srv, "GET", hs256Token("wrong", map[string]interface{}{"sub": "jack", "exp": exp}))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = serve(srv, "GET", hs256Token("secret", map[string]interface{}{"sub": "jack", "exp": float64(time.Now().Add(-time.Hour).Unix())}))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = serve(srv, "DELETE", hs256Token("secret", map[string]interface{}{"sub": "jack", "exp": exp, "roles": []string{"user"}}))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = serve(srv, "DELETE", hs256Token("secret", map[string]interface{}{"sub": "jack", "exp": exp, "roles": []string{"user", "admin"}}))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// tokens without exp never expire, so they are rejected unless allowed explicitly
+	rec = serve(srv, "GET", hs256Token("secret", map[string]interface{}{"sub": "jack"}))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	config.GddJwtAllowNoExp.Write("true")
+	defer os.Unsetenv(config.GddJwtAllowNoExp.String())
+	rec = serve(newBearerSrv(), "GET", hs256Token("secret", map[string]interface{}{"sub": "jack"}))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestBearerAuthMisconfigured(t *testing.T) {
+	validatorOnce = sync.Once{}
+	defer func() {
+		validatorOnce = sync.Once{}
+	}()
+	srv := NewDefaultHttpSrv()
+	srv.AddMiddleware(BearerAuth)
+	srv.AddRoute(model.Route{
+		Name:    "GetUser",
+		Method:  "GET",
+		Pattern: "/user",
+		HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("user"))
+		},
+	})
+	for i := 0; i < 2; i++ {
+		rec := serve(srv, "GET", hs256Token("secret", map[string]interface{}{"sub": "jack"}))
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	}
+}
+
+func TestBearerAuthJwks(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	jwks := map[string]interface{}{
+		"keys": []map[string]string{
+			{
+				"kty": "RSA",
+				"kid": "rsa1",
+				"n":   b64(rsaKey.N.Bytes()),
+				"e":   b64(big.NewInt(int64(rsaKey.E)).Bytes()),
+			},
+			{
+				"kty": "EC",
+				"kid": "ec1",
+				"crv": "P-256",
+				"x":   b64(ecKey.X.Bytes()),
+				"y":   b64(ecKey.Y.Bytes()),
+			},
+		},
+	}
+	data, _ := json.Marshal(jwks)
+	jwksfile := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, ioutil.WriteFile(jwksfile, data, os.ModePerm))
+	config.GddJwtJwks.Write(jwksfile)
+	config.GddJwtIssuer.Write("https://auth.example.com")
+	defer func() {
+		os.Unsetenv(config.GddJwtJwks.String())
+		os.Unsetenv(config.GddJwtIssuer.String())
+	}()
+	srv := newBearerSrv()
+	exp := float64(time.Now().Add(time.Hour).Unix())
+	claims := map[string]interface{}{"sub": "jack", "iss": "https://auth.example.com", "exp": exp}
+
+	rec := serve(srv, "GET", rs256Token(rsaKey, "rsa1", claims))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = serve(srv, "GET", es256Token(ecKey, "ec1", claims))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = serve(srv, "GET", rs256Token(rsaKey, "unknown", claims))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = serve(srv, "GET", rs256Token(rsaKey, "rsa1", map[string]interface{}{"sub": "jack", "iss": "someone", "exp": exp}))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	// HMAC signed tokens must be rejected when no secret configured
+	rec = serve(srv, "GET", hs256Token("", claims))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
@@ -0,0 +1,93 @@
+package ddhttp
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/unionj-cloud/go-doudou/svc/config"
+	"io"
+	"time"
+)
+
+// OnStart registers hooks run in order after http server started listening, such as warming up caches.
+// The server becomes ready only after all hooks succeeded. Each hook is bounded by GDD_START_TIMEOUT.
+// If any hook fails or times out, shutdown hooks will be run and the program panics
+func (srv *DefaultHttpSrv) OnStart(hooks ...func(ctx context.Context) error) {
+	srv.startHooks = append(srv.startHooks, hooks...)
+}
+
+// OnShutdown registers hooks run in reverse order of registration after http server stopped, like defer statements,
+// such as closing database connections. Hooks share the deadline of GDD_GRACE_TIMEOUT with draining the server,
+// a hook not returned before the deadline is abandoned, and hooks after it are skipped
+func (srv *DefaultHttpSrv) OnShutdown(hooks ...func(ctx context.Context) error) {
+	srv.shutdownHooks = append(srv.shutdownHooks, hooks...)
+}
+
+// Closer returns a shutdown hook closing c, such as database connection
+func Closer(name string, c io.Closer) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		if c == nil {
+			return nil
+		}
+		if err := c.Close(); err != nil {
+			return errors.Wrapf(err, "close %s failed", name)
+		}
+		logrus.Infof("%s is closed\n", name)
+		return nil
+	}
+}
+
+func startTimeout() time.Duration {
+	timeout, err := time.ParseDuration(config.GddStartTimeout.Load())
+	if err != nil {
+		logrus.Warnf("Parse %s %s as time.Duration failed: %s, use default 30s instead.\n", config.GddStartTimeout,
+			config.GddStartTimeout.Load(), err.Error())
+		timeout = 30 * time.Second
+	}
+	return timeout
+}
+
+// runHook runs hook in a goroutine and waits until ctx is done, so that hooks ignoring ctx cannot block the program
+func runHook(ctx context.Context, hook func(ctx context.Context) error) error {
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if e := recover(); e != nil {
+				done <- errors.Errorf("hook panic: %v", e)
+			}
+		}()
+		done <- hook(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "hook not returned in time")
+	}
+}
+
+func (srv *DefaultHttpSrv) runStartHooks(timeout time.Duration) error {
+	for i, hook := range srv.startHooks {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err := runHook(ctx, hook)
+		cancel()
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("start hook %d fail", i))
+		}
+	}
+	return nil
+}
+
+// runShutdownHooks runs shutdown hooks with what remains of the deadline of ctx
+func (srv *DefaultHttpSrv) runShutdownHooks(ctx context.Context) {
+	for i := len(srv.shutdownHooks) - 1; i >= 0; i-- {
+		if ctx.Err() != nil {
+			logrus.Errorf("Shutdown hook %d skipped: %s\n", i, ctx.Err())
+			continue
+		}
+		if err := runHook(ctx, srv.shutdownHooks[i]); err != nil {
+			logrus.Errorf("Shutdown hook %d fail: %+v\n", i, err)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package ddhttp
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type mockCloser struct {
+	closed bool
+}
+
+func (m *mockCloser) Close() error {
+	m.closed = true
+	return nil
+}
+
+func TestDefaultHttpSrv_runStartHooks(t *testing.T) {
+	srv := NewDefaultHttpSrv()
+	var trace []string
+	srv.OnStart(func(ctx context.Context) error {
+		trace = append(trace, "first")
+		return nil
+	}, func(ctx context.Context) error {
+		trace = append(trace, "second")
+		return nil
+	})
+	assert.NoError(t, srv.runStartHooks(time.Second))
+	assert.Equal(t, []string{"first", "second"}, trace)
+
+	trace = nil
+	srv.OnStart(func(ctx context.Context) error {
+		return errors.New("mock error")
+	}, func(ctx context.Context) error {
+		trace = append(trace, "never")
+		return nil
+	})
+	assert.Error(t, srv.runStartHooks(time.Second))
+	assert.Equal(t, []string{"first", "second"}, trace)
+}
+
+func TestDefaultHttpSrv_runShutdownHooks(t *testing.T) {
+	srv := NewDefaultHttpSrv()
+	var trace []string
+	closer := &mockCloser{}
+	srv.OnShutdown(func(ctx context.Context) error {
+		trace = append(trace, "never")
+		return nil
+	}, func(ctx context.Context) error {
+		// ignores ctx and blocks
+		time.Sleep(time.Hour)
+		return nil
+	}, Closer("mock", closer), func(ctx context.Context) error {
+		trace = append(trace, "first")
+		return nil
+	}, func(ctx context.Context) error {
+		panic("mock panic")
+	})
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	srv.runShutdownHooks(ctx)
+	assert.True(t, time.Since(start) < time.Second)
+	// hooks after the deadline are skipped
+	assert.Equal(t, []string{"first"}, trace)
+	assert.True(t, closer.closed)
+}
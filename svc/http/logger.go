@@ -0,0 +1,295 @@
+package ddhttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ascarter/requestid"
+	"github.com/felixge/httpsnoop"
+	"github.com/sirupsen/logrus"
+	"github.com/unionj-cloud/cast"
+	"github.com/unionj-cloud/go-doudou/logutils"
+	"github.com/unionj-cloud/go-doudou/stringutils"
+	"github.com/unionj-cloud/go-doudou/svc/config"
+	"github.com/unionj-cloud/go-doudou/svc/tracing"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultLogBodyLimit = 4096
+	redacted            = "***"
+)
+
+var (
+	defaultRedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+	defaultRedactFields  = []string{"password", "secret", "token"}
+)
+
+// bodyCapture keeps the first limit bytes of a body streamed through it
+type bodyCapture struct {
+	limit     int
+	buf       bytes.Buffer
+	truncated bool
+}
+
+func (c *bodyCapture) write(p []byte) {
+	remaining := c.limit - c.buf.Len()
+	if len(p) > remaining {
+		p = p[:remaining]
+		c.truncated = true
+	}
+	c.buf.Write(p)
+}
+
+func (c *bodyCapture) Write(p []byte) (int, error) {
+	c.write(p)
+	return len(p), nil
+}
+
+type captureReader struct {
+	io.ReadCloser
+	capture *bodyCapture
+}
+
+func (r *captureReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.capture.write(p[:n])
+	return n, err
+}
+
+type httpLogKey struct{}
+
+type httpLogger struct {
+	limit         int
+	redactHeaders map[string]struct{}
+	jsonFields    *regexp.Regexp
+	formFields    *regexp.Regexp
+}
+
+func envList(env config.EnvLoader, def []string) []string {
+	raw := env.Load()
+	if stringutils.IsEmpty(raw) {
+		return def
+	}
+	var values []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); stringutils.IsNotEmpty(item) {
+			values = append(values, item)
+		}
+	}
+	return values
+}
+
+func newHttpLogger() *httpLogger {
+	l := &httpLogger{
+		limit:         defaultLogBodyLimit,
+		redactHeaders: make(map[string]struct{}),
+	}
+	if raw := config.GddLogBodyLimit.Load(); stringutils.IsNotEmpty(raw) {
+		l.limit = cast.ToInt(raw)
+	}
+	for _, item := range envList(config.GddLogRedactHeaders, defaultRedactHeaders) {
+		l.redactHeaders[http.CanonicalHeaderKey(item)] = struct{}{}
+	}
+	var fields []string
+	for _, item := range envList(config.GddLogRedactFields, defaultRedactFields) {
+		fields = append(fields, regexp.QuoteMeta(item))
+	}
+	if len(fields) > 0 {
+		// names containing any of fields, such as access_token and client_secret
+		names := strings.Join(fields, "|")
+		l.jsonFields = regexp.MustCompile(`(?i)("[^"]*?(?:` + names + `)[^"]*"\s*:\s*)("(?:[^"\\]|\\.)*"?|[^,}\]\s]*)`)
+		l.formFields = regexp.MustCompile(`(?i)((?:^|&)[^=&]*?(?:` + names + `)[^=&]*=)[^&]*`)
+	}
+	return l
+}
+
+func (l *httpLogger) header(header http.Header) http.Header {
+	masked := make(http.Header, len(header))
+	for k, v := range header {
+		if _, ok := l.redactHeaders[k]; ok {
+			v = []string{redacted}
+		}
+		masked[k] = v
+	}
+	return masked
+}
+
+func (l *httpLogger) query(query string) string {
+	if l.formFields == nil {
+		return query
+	}
+	return l.formFields.ReplaceAllString(query, "${1}"+redacted)
+}
+
+// body returns captured body with sensitive fields masked. Bodies other than text, json, xml
+// and urlencoded form are omitted
+func (l *httpLogger) body(contentType string, capture *bodyCapture) string {
+	if capture == nil || capture.buf.Len() == 0 {
+		return ""
+	}
+	contentType = strings.ToLower(contentType)
+	body := capture.buf.String()
+	switch {
+	case strings.Contains(contentType, "json"):
+		if l.jsonFields != nil {
+			body = l.jsonFields.ReplaceAllString(body, `${1}"`+redacted+`"`)
+		}
+	case strings.Contains(contentType, "x-www-form-urlencoded"):
+		body = l.query(body)
+	case contentType == "", strings.HasPrefix(contentType, "text/"), strings.Contains(contentType, "xml"):
+	default:
+		return fmt.Sprintf("[%s body omitted]", contentType)
+	}
+	if capture.truncated {
+		body += "...(truncated)"
+	}
+	return body
+}
+
+func (l *httpLogger) middleware(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.RequestURI(), "/go-doudou/") {
+			inner.ServeHTTP(w, r)
+			return
+		}
+		fields := logrus.Fields{}
+		rid, _ := requestid.FromContext(r.Context())
+		if stringutils.IsNotEmpty(rid) {
+			fields["requestId"] = rid
+		}
+		traceId := tracing.TraceIDFromContext(r.Context())
+		if stringutils.IsNotEmpty(traceId) {
+			fields["traceId"] = traceId
+		}
+		route := routeName(r)
+		if stringutils.IsNotEmpty(route) {
+			fields["route"] = route
+		}
+		ctx := logutils.WithFields(r.Context(), fields)
+		if !logrus.IsLevelEnabled(logrus.DebugLevel) {
+			inner.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
+		start := time.Now()
+		uri := r.URL.Path
+		if r.URL.RawQuery != "" {
+			uri += "?" + l.query(r.URL.RawQuery)
+		}
+		hlog := &HttpLog{
+			ClientIp:         r.RemoteAddr,
+			HttpMethod:       r.Method,
+			Uri:              uri,
+			Proto:            r.Proto,
+			Host:             r.Host,
+			ReqContentLength: r.ContentLength,
+			ReqHeader:        l.header(r.Header),
+			RequestId:        rid,
+			TraceId:          traceId,
+			Route:            route,
+		}
+		r = r.WithContext(context.WithValue(ctx, httpLogKey{}, hlog))
+		var reqBody, respBody *bodyCapture
+		if l.limit > 0 {
+			reqBody = &bodyCapture{limit: l.limit}
+			respBody = &bodyCapture{limit: l.limit}
+			if r.Body != nil && r.Body != http.NoBody {
+				r.Body = &captureReader{ReadCloser: r.Body, capture: reqBody}
+			}
+		}
+		var (
+			code        int
+			written     int64
+			wroteHeader bool
+		)
+		ww := httpsnoop.Wrap(w, httpsnoop.Hooks{
+			WriteHeader: func(next httpsnoop.WriteHeaderFunc) httpsnoop.WriteHeaderFunc {
+				return func(c int) {
+					if !wroteHeader {
+						wroteHeader = true
+						code = c
+					}
+					next(c)
+				}
+			},
+			Write: func(next httpsnoop.WriteFunc) httpsnoop.WriteFunc {
+				return func(b []byte) (int, error) {
+					wroteHeader = true
+					n, err := next(b)
+					written += int64(n)
+					if respBody != nil {
+						respBody.write(b[:n])
+					}
+					return n, err
+				}
+			},
+			ReadFrom: func(next httpsnoop.ReadFromFunc) httpsnoop.ReadFromFunc {
+				return func(src io.Reader) (int64, error) {
+					wroteHeader = true
+					if respBody != nil {
+						src = io.TeeReader(src, respBody)
+					}
+					n, err := next(src)
+					written += n
+					return n, err
+				}
+			},
+		})
+		inner.ServeHTTP(ww, r)
+		if code == 0 {
+			code = http.StatusOK
+		}
+
+		hlog.ReqBody = l.body(r.Header.Get("Content-Type"), reqBody)
+		hlog.StatusCode = code
+		hlog.RespHeader = l.header(w.Header())
+		hlog.RespContentLength = int(written)
+		hlog.RespBody = l.body(w.Header().Get("Content-Type"), respBody)
+		hlog.ElapsedTime = time.Since(start).String()
+		hlog.Elapsed = time.Since(start).Milliseconds()
+		logutils.FromContext(r.Context()).WithFields(hlog.fields()).Debugf("%s %s %d", hlog.HttpMethod, hlog.Uri, hlog.StatusCode)
+	})
+}
+
+var (
+	httpLoggerOnce    sync.Once
+	defaultHttpLogger *httpLogger
+)
+
+// Logger puts requestId, traceId and route name into request context for logutils.FromContext.
+// If log level is debug or trace, it also logs request and response with bodies captured while streaming,
+// which are capped by GDD_LOG_BODY_LIMIT and masked by GDD_LOG_REDACT_HEADERS and GDD_LOG_REDACT_FIELDS
+func Logger(inner http.Handler) http.Handler {
+	httpLoggerOnce.Do(func() {
+		defaultHttpLogger = newHttpLogger()
+	})
+	return defaultHttpLogger.middleware(inner)
+}
+
+// setLogUser puts user into request context for logutils.FromContext, and into request log if any
+func setLogUser(ctx context.Context, user string) context.Context {
+	if stringutils.IsEmpty(user) {
+		return ctx
+	}
+	if hlog, ok := ctx.Value(httpLogKey{}).(*HttpLog); ok {
+		hlog.User = user
+	}
+	return logutils.WithFields(ctx, logrus.Fields{
+		"user": user,
+	})
+}
+
+// fields converts h to logrus.Fields keyed by json names
+func (h *HttpLog) fields() logrus.Fields {
+	fields := logrus.Fields{}
+	data, _ := json.Marshal(h)
+	_ = json.Unmarshal(data, &fields)
+	return fields
+}
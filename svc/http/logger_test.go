@@ -0,0 +1,147 @@
+package ddhttp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"github.com/ascarter/requestid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/logutils"
+	"github.com/unionj-cloud/go-doudou/svc/config"
+	"github.com/unionj-cloud/go-doudou/svc/http/model"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// captureLog redirects standard logger to a buffer in json format at level
+func captureLog(t *testing.T, level logrus.Level) *bytes.Buffer {
+	var buf bytes.Buffer
+	logger := logrus.StandardLogger()
+	out, formatter, old := logger.Out, logger.Formatter, logger.GetLevel()
+	logger.SetOutput(&buf)
+	logger.SetFormatter(&logrus.JSONFormatter{})
+	logger.SetLevel(level)
+	t.Cleanup(func() {
+		logger.SetOutput(out)
+		logger.SetFormatter(formatter)
+		logger.SetLevel(old)
+	})
+	return &buf
+}
+
+func logEntries(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	var entries []map[string]interface{}
+	scanner := bufio.NewScanner(buf)
+	for scanner.Scan() {
+		var entry map[string]interface{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func newLoggerSrv(handler http.HandlerFunc) *DefaultHttpSrv {
+	srv := NewDefaultHttpSrv()
+	srv.AddMiddleware(requestid.RequestIDHandler, newHttpLogger().middleware)
+	srv.AddRoute(model.Route{
+		Name:        "CreateUser",
+		Method:      "POST",
+		Pattern:     "/user",
+		HandlerFunc: handler,
+	})
+	return srv
+}
+
+func TestLogger(t *testing.T) {
+	config.GddLogBodyLimit.Write("64")
+	defer os.Unsetenv(config.GddLogBodyLimit.String())
+	buf := captureLog(t, logrus.DebugLevel)
+
+	srv := newLoggerSrv(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		r = r.WithContext(setLogUser(r.Context(), "jack"))
+		logutils.FromContext(r.Context()).Info("creating user")
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Set-Cookie", "session=abc")
+		w.WriteHeader(http.StatusCreated)
+		w.(http.Flusher).Flush()
+		w.Write(body)
+		w.Write([]byte(strings.Repeat(" ", 100)))
+	})
+	body := `{"name":"jack","password":"123456","profile":{"Token": 42}}`
+	req := httptest.NewRequest("POST", "/user?token=abc&page=1", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer abc")
+	rec := httptest.NewRecorder()
+	srv.rootRouter.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.True(t, rec.Flushed)
+	assert.Equal(t, body+strings.Repeat(" ", 100), rec.Body.String())
+
+	entries := logEntries(t, buf)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "creating user", entries[0]["msg"])
+	assert.Equal(t, "CreateUser", entries[0]["route"])
+	assert.Equal(t, "jack", entries[0]["user"])
+	assert.NotEmpty(t, entries[0]["requestId"])
+
+	hlog := entries[1]
+	assert.Equal(t, "debug", hlog["level"])
+	assert.Equal(t, "POST /user?token=***&page=1 201", hlog["msg"])
+	assert.Equal(t, entries[0]["requestId"], hlog["requestId"])
+	assert.Equal(t, "CreateUser", hlog["route"])
+	assert.Equal(t, "jack", hlog["user"])
+	assert.Equal(t, `{"name":"jack","password":"***","profile":{"Token": "***"}}`, hlog["reqBody"])
+	assert.Equal(t, `{"name":"jack","password":"***","profile":{"Token": "***"}}     ...(truncated)`, hlog["respBody"])
+	assert.Equal(t, float64(len(body)+100), hlog["respContentLength"])
+	assert.Equal(t, []interface{}{"***"}, hlog["reqHeader"].(map[string]interface{})["Authorization"])
+	assert.Equal(t, []interface{}{"***"}, hlog["respHeader"].(map[string]interface{})["Set-Cookie"])
+}
+
+func TestLogger_InfoLevel(t *testing.T) {
+	buf := captureLog(t, logrus.InfoLevel)
+	srv := newLoggerSrv(func(w http.ResponseWriter, r *http.Request) {
+		logutils.FromContext(r.Context()).Info("creating user")
+		w.Write([]byte("ok"))
+	})
+	rec := httptest.NewRecorder()
+	srv.rootRouter.ServeHTTP(rec, httptest.NewRequest("POST", "/user", nil))
+	assert.Equal(t, "ok", rec.Body.String())
+	entries := logEntries(t, buf)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "CreateUser", entries[0]["route"])
+}
+
+func TestHttpLogger_defaultFields(t *testing.T) {
+	l := newHttpLogger()
+	assert.Equal(t, "grant_type=client_credentials&client_secret=***&access_token=***",
+		l.query("grant_type=client_credentials&client_secret=abc&access_token=def"))
+	c := &bodyCapture{limit: 200}
+	c.write([]byte(`{"refresh_token":"a","apiSecret":"b","user":"jack","oldPassword":"c"}`))
+	assert.Equal(t, `{"refresh_token":"***","apiSecret":"***","user":"jack","oldPassword":"***"}`, l.body("application/json", c))
+}
+
+func TestHttpLogger_body(t *testing.T) {
+	config.GddLogRedactFields.Write("pwd")
+	defer os.Unsetenv(config.GddLogRedactFields.String())
+	l := newHttpLogger()
+	capture := func(s string) *bodyCapture {
+		c := &bodyCapture{limit: 100}
+		c.write([]byte(s))
+		return c
+	}
+	assert.Equal(t, "name=jack&pwd=***&token=abc", l.body("application/x-www-form-urlencoded", capture("name=jack&pwd=123&token=abc")))
+	assert.Equal(t, "old_pwd=***&user=jack", l.body("application/x-www-form-urlencoded", capture("old_pwd=123&user=jack")))
+	assert.Equal(t, `{"newPwd":"***"}`, l.body("application/json", capture(`{"newPwd":"123"}`)))
+	assert.Equal(t, `{"pwd":"***","list":[1]}`, l.body("application/json", capture(`{"pwd":"a\"b","list":[1]}`)))
+	assert.Equal(t, `{"pwd":"***"`, l.body("application/json", capture(`{"pwd":"unfinished`)))
+	assert.Equal(t, "hello", l.body("text/plain", capture("hello")))
+	assert.Equal(t, "[image/png body omitted]", l.body("image/png", capture("\x89PNG")))
+	assert.Equal(t, "", l.body("application/json", nil))
+}
@@ -2,19 +2,15 @@ package ddhttp
 
 import (
 	"crypto/subtle"
-	"encoding/json"
 	"fmt"
-	"github.com/ascarter/requestid"
 	"github.com/felixge/httpsnoop"
+	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
 	"github.com/unionj-cloud/go-doudou/stringutils"
 	"github.com/unionj-cloud/go-doudou/svc/config"
 	"net/http"
-	"net/http/httptest"
-	"net/http/httputil"
 	"runtime/debug"
 	"strings"
-	"time"
 )
 
 // Metrics logs some metrics for http request
@@ -33,61 +29,6 @@ func Metrics(inner http.Handler) http.Handler {
 	})
 }
 
-// Logger logs http request body and response body for debugging
-func Logger(inner http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.Contains(r.URL.RequestURI(), "/go-doudou/") {
-			inner.ServeHTTP(w, r)
-			return
-		}
-		start := time.Now()
-		rid, _ := requestid.FromContext(r.Context())
-		x, err := httputil.DumpRequest(r, true)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		rec := httptest.NewRecorder()
-		inner.ServeHTTP(rec, r)
-
-		rawReq := string(x)
-		if len(r.Header["Content-Type"]) > 0 && strings.Contains(r.Header["Content-Type"][0], "multipart/form-data") {
-			if err := r.ParseMultipartForm(32 << 20); err != nil {
-				http.Error(w, err.Error(), http.StatusBadRequest)
-				return
-			}
-			rawReq = r.Form.Encode()
-		}
-
-		hlog := HttpLog{
-			ClientIp:          r.RemoteAddr,
-			HttpMethod:        r.Method,
-			Uri:               r.URL.RequestURI(),
-			Proto:             r.Proto,
-			Host:              r.Host,
-			ReqContentLength:  r.ContentLength,
-			ReqHeader:         r.Header,
-			RequestId:         rid,
-			RawReq:            rawReq,
-			RespBody:          rec.Body.String(),
-			StatusCode:        rec.Result().StatusCode,
-			RespHeader:        rec.Result().Header,
-			RespContentLength: rec.Body.Len(),
-			ElapsedTime:       time.Since(start).String(),
-			Elapsed:           time.Since(start).Milliseconds(),
-		}
-		log, _ := json.MarshalIndent(hlog, "", "    ")
-		logrus.Debugln(string(log))
-
-		header := rec.Result().Header
-		for k, v := range header {
-			w.Header()[k] = v
-		}
-		w.WriteHeader(rec.Result().StatusCode)
-		rec.Body.WriteTo(w)
-	})
-}
-
 // Rest set Content-Type to application/json
 func Rest(inner http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -129,3 +70,29 @@ func Recover(inner http.Handler) http.Handler {
 		inner.ServeHTTP(w, r)
 	})
 }
+
+// routeValues parses environment variable with value like GetUser=10/s,PageUsers=100/m to map from route name to value
+func routeValues(env config.EnvLoader) map[string]string {
+	values := make(map[string]string)
+	raw := env.Load()
+	if stringutils.IsEmpty(raw) {
+		return values
+	}
+	for _, item := range strings.Split(raw, ",") {
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 || stringutils.IsEmpty(strings.TrimSpace(kv[0])) {
+			logrus.Warnf("Parse %s %s failed, ignore it.\n", env, item)
+			continue
+		}
+		values[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return values
+}
+
+// routeName returns name of the route matched by gorilla mux router
+func routeName(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		return route.GetName()
+	}
+	return ""
+}
@@ -8,4 +8,10 @@ type Route struct {
 	Method      string
 	Pattern     string
 	HandlerFunc http.HandlerFunc
+	// Middlewares only wrap HandlerFunc of this route, the first one is the outermost.
+	// They are declared by @middleware annotation on service interface methods in svc.go file
+	Middlewares []func(http.Handler) http.Handler
+	// Roles are required to access this route. They are declared by @role annotation
+	// on service interface methods in svc.go file
+	Roles []string
 }
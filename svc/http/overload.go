@@ -0,0 +1,297 @@
+package ddhttp
+
+import (
+	"context"
+	"github.com/felixge/httpsnoop"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+	"github.com/unionj-cloud/cast"
+	"github.com/unionj-cloud/go-doudou/stringutils"
+	"github.com/unionj-cloud/go-doudou/svc/config"
+	"math/rand"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	timeoutRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_timeout_total",
+		Help: "Number of requests whose context was cancelled by route timeout.",
+	}, []string{"route"})
+	bulkheadInflight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "http_bulkhead_in_flight",
+		Help: "Number of in-flight requests per route limited by bulkhead.",
+	}, []string{"route"})
+	bulkheadRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_bulkhead_rejected_total",
+		Help: "Number of requests rejected by bulkhead.",
+	}, []string{"route"})
+	sheddingInflight = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "http_shedding_in_flight",
+		Help: "Number of in-flight requests watched by load shedding.",
+	})
+	sheddingLatency = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "http_shedding_latency_seconds",
+		Help: "Moving average of request latency watched by load shedding.",
+	})
+	shedRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_shed_total",
+		Help: "Number of requests rejected by load shedding.",
+	}, []string{"reason"})
+)
+
+func parseDuration(env config.EnvLoader, value string) time.Duration {
+	if stringutils.IsEmpty(value) {
+		return 0
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		logrus.Warnf("Parse %s %s as time.Duration failed: %s, ignore it.\n", env, value, err.Error())
+		return 0
+	}
+	return d
+}
+
+type routeTimeout struct {
+	def    time.Duration
+	routes map[string]time.Duration
+}
+
+func newRouteTimeout() *routeTimeout {
+	t := &routeTimeout{
+		def:    parseDuration(config.GddRouteTimeout, config.GddRouteTimeout.Load()),
+		routes: make(map[string]time.Duration),
+	}
+	for route, value := range routeValues(config.GddRouteTimeouts) {
+		t.routes[route] = parseDuration(config.GddRouteTimeouts, value)
+	}
+	return t
+}
+
+func (t *routeTimeout) middleware(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := routeName(r)
+		timeout, ok := t.routes[route]
+		if !ok {
+			timeout = t.def
+		}
+		if timeout <= 0 {
+			inner.ServeHTTP(w, r)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		var written bool
+		ww := httpsnoop.Wrap(w, httpsnoop.Hooks{
+			WriteHeader: func(next httpsnoop.WriteHeaderFunc) httpsnoop.WriteHeaderFunc {
+				return func(code int) {
+					written = true
+					next(code)
+				}
+			},
+			Write: func(next httpsnoop.WriteFunc) httpsnoop.WriteFunc {
+				return func(b []byte) (int, error) {
+					written = true
+					return next(b)
+				}
+			},
+		})
+		inner.ServeHTTP(ww, r.WithContext(ctx))
+		if ctx.Err() == context.DeadlineExceeded {
+			timeoutRequests.WithLabelValues(route).Inc()
+			if !written {
+				http.Error(w, "request timeout", http.StatusServiceUnavailable)
+			}
+		}
+	})
+}
+
+var (
+	timeoutOnce    sync.Once
+	defaultTimeout *routeTimeout
+)
+
+// Timeout cancels context of requests after timeout configured by GDD_ROUTE_TIMEOUT and GDD_ROUTE_TIMEOUTS.
+// Handlers should watch ctx.Done() to stop processing. If nothing has been written to the response
+// when handler returns after timeout, 503 status code will be sent
+func Timeout(inner http.Handler) http.Handler {
+	timeoutOnce.Do(func() {
+		defaultTimeout = newRouteTimeout()
+	})
+	return defaultTimeout.middleware(inner)
+}
+
+type bulkhead struct {
+	def    int
+	limits map[string]int
+	lock   sync.Mutex
+	sems   map[string]chan struct{}
+}
+
+func newBulkhead() *bulkhead {
+	b := &bulkhead{
+		def:    cast.ToInt(config.GddRouteConcurrency.Load()),
+		limits: make(map[string]int),
+		sems:   make(map[string]chan struct{}),
+	}
+	for route, value := range routeValues(config.GddRouteConcurrencies) {
+		b.limits[route] = cast.ToInt(value)
+	}
+	return b
+}
+
+// semaphore returns semaphore of the route, nil means unlimited
+func (b *bulkhead) semaphore(route string) chan struct{} {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	sem, ok := b.sems[route]
+	if !ok {
+		limit, exists := b.limits[route]
+		if !exists {
+			limit = b.def
+		}
+		if limit > 0 {
+			sem = make(chan struct{}, limit)
+		}
+		b.sems[route] = sem
+	}
+	return sem
+}
+
+func (b *bulkhead) middleware(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := routeName(r)
+		sem := b.semaphore(route)
+		if sem == nil {
+			inner.ServeHTTP(w, r)
+			return
+		}
+		select {
+		case sem <- struct{}{}:
+			bulkheadInflight.WithLabelValues(route).Inc()
+			defer func() {
+				<-sem
+				bulkheadInflight.WithLabelValues(route).Dec()
+			}()
+			inner.ServeHTTP(w, r)
+		default:
+			bulkheadRejected.WithLabelValues(route).Inc()
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "too many concurrent requests", http.StatusServiceUnavailable)
+		}
+	})
+}
+
+var (
+	bulkheadOnce    sync.Once
+	defaultBulkhead *bulkhead
+)
+
+// Bulkhead limits concurrent requests per route configured by GDD_ROUTE_CONCURRENCY and GDD_ROUTE_CONCURRENCIES,
+// so that a slow api cannot use up all resources. Requests exceeding the limit are rejected with 503 status code
+func Bulkhead(inner http.Handler) http.Handler {
+	bulkheadOnce.Do(func() {
+		defaultBulkhead = newBulkhead()
+	})
+	return defaultBulkhead.middleware(inner)
+}
+
+// ewmaAlpha is weight of the latest latency in moving average
+const ewmaAlpha = 0.1
+
+// maxShedRatio keeps some requests passing through when latency is high, so moving average can recover
+const maxShedRatio = 0.9
+
+type loadShedder struct {
+	maxInflight int64
+	maxLatency  time.Duration
+	inflight    int64
+	lock        sync.Mutex
+	latency     float64
+}
+
+func (s *loadShedder) observe(elapsed time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.latency == 0 {
+		s.latency = float64(elapsed)
+	} else {
+		s.latency = ewmaAlpha*float64(elapsed) + (1-ewmaAlpha)*s.latency
+	}
+	sheddingLatency.Set(time.Duration(s.latency).Seconds())
+}
+
+// shed counts the request as in-flight and returns empty string if it is admitted, or returns reason
+// if it should be rejected. Counting before comparing keeps concurrent requests from exceeding maxInflight.
+// Admitted requests must call done when finished
+func (s *loadShedder) shed() string {
+	if n := atomic.AddInt64(&s.inflight, 1); s.maxInflight > 0 && n > s.maxInflight {
+		atomic.AddInt64(&s.inflight, -1)
+		return "inflight"
+	}
+	if s.maxLatency > 0 {
+		s.lock.Lock()
+		latency := s.latency
+		s.lock.Unlock()
+		if latency > float64(s.maxLatency) {
+			ratio := 1 - float64(s.maxLatency)/latency
+			if ratio > maxShedRatio {
+				ratio = maxShedRatio
+			}
+			if rand.Float64() < ratio {
+				atomic.AddInt64(&s.inflight, -1)
+				return "latency"
+			}
+		}
+	}
+	return ""
+}
+
+// done removes the request admitted by shed from in-flight requests
+func (s *loadShedder) done() {
+	atomic.AddInt64(&s.inflight, -1)
+}
+
+func newLoadShedder() *loadShedder {
+	return &loadShedder{
+		maxInflight: int64(cast.ToInt(config.GddShedMaxInflight.Load())),
+		maxLatency:  parseDuration(config.GddShedMaxLatency, config.GddShedMaxLatency.Load()),
+	}
+}
+
+func (s *loadShedder) middleware(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if reason := s.shed(); stringutils.IsNotEmpty(reason) {
+			shedRequests.WithLabelValues(reason).Inc()
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "server is overloaded", http.StatusServiceUnavailable)
+			return
+		}
+		sheddingInflight.Inc()
+		start := time.Now()
+		defer func() {
+			s.observe(time.Since(start))
+			s.done()
+			sheddingInflight.Dec()
+		}()
+		inner.ServeHTTP(w, r)
+	})
+}
+
+var (
+	shedderOnce    sync.Once
+	defaultShedder *loadShedder
+)
+
+// LoadShedding rejects requests with 503 status code when in-flight requests exceed GDD_SHED_MAX_INFLIGHT,
+// or rejects part of requests when moving average of request latency exceeds GDD_SHED_MAX_LATENCY.
+// The more latency exceeds, the more requests are rejected
+func LoadShedding(inner http.Handler) http.Handler {
+	shedderOnce.Do(func() {
+		defaultShedder = newLoadShedder()
+	})
+	return defaultShedder.middleware(inner)
+}
@@ -0,0 +1,151 @@
+package ddhttp
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/unionj-cloud/go-doudou/svc/config"
+	"github.com/unionj-cloud/go-doudou/svc/http/model"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newOverloadSrv(mwf func(http.Handler) http.Handler, handler http.HandlerFunc) *DefaultHttpSrv {
+	srv := NewDefaultHttpSrv()
+	srv.AddMiddleware(mwf)
+	srv.AddRoute(model.Route{
+		Name:        "GetUser",
+		Method:      "GET",
+		Pattern:     "/user",
+		HandlerFunc: handler,
+	}, model.Route{
+		Name:    "GetBook",
+		Method:  "GET",
+		Pattern: "/book",
+		HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("book"))
+		},
+	})
+	return srv
+}
+
+func TestTimeout(t *testing.T) {
+	config.GddRouteTimeouts.Write("GetUser=10ms")
+	defer os.Unsetenv(config.GddRouteTimeouts.String())
+	srv := newOverloadSrv(newRouteTimeout().middleware, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+			w.Write([]byte("user"))
+		}
+	})
+
+	rec := httptest.NewRecorder()
+	srv.rootRouter.ServeHTTP(rec, httptest.NewRequest("GET", "/user", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	rec = httptest.NewRecorder()
+	srv.rootRouter.ServeHTTP(rec, httptest.NewRequest("GET", "/book", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "book", rec.Body.String())
+}
+
+func TestBulkhead(t *testing.T) {
+	config.GddRouteConcurrencies.Write("GetUser=1")
+	defer os.Unsetenv(config.GddRouteConcurrencies.String())
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	srv := newOverloadSrv(newBulkhead().middleware, func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-release
+	})
+
+	done := make(chan int)
+	go func() {
+		rec := httptest.NewRecorder()
+		srv.rootRouter.ServeHTTP(rec, httptest.NewRequest("GET", "/user", nil))
+		done <- rec.Code
+	}()
+	<-entered
+
+	rec := httptest.NewRecorder()
+	srv.rootRouter.ServeHTTP(rec, httptest.NewRequest("GET", "/user", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	rec = httptest.NewRecorder()
+	srv.rootRouter.ServeHTTP(rec, httptest.NewRequest("GET", "/book", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	close(release)
+	assert.Equal(t, http.StatusOK, <-done)
+}
+
+func TestLoadShedding(t *testing.T) {
+	config.GddShedMaxInflight.Write("1")
+	defer os.Unsetenv(config.GddShedMaxInflight.String())
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	srv := newOverloadSrv(newLoadShedder().middleware, func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-release
+	})
+
+	done := make(chan int)
+	go func() {
+		rec := httptest.NewRecorder()
+		srv.rootRouter.ServeHTTP(rec, httptest.NewRequest("GET", "/user", nil))
+		done <- rec.Code
+	}()
+	<-entered
+
+	rec := httptest.NewRecorder()
+	srv.rootRouter.ServeHTTP(rec, httptest.NewRequest("GET", "/book", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	close(release)
+	assert.Equal(t, http.StatusOK, <-done)
+}
+
+func Test_loadShedder_shed(t *testing.T) {
+	s := &loadShedder{
+		maxLatency: 100 * time.Millisecond,
+	}
+	s.observe(50 * time.Millisecond)
+	assert.Empty(t, s.shed())
+	s.done()
+	s.latency = float64(10 * time.Second)
+	var shed int
+	for i := 0; i < 1000; i++ {
+		if s.shed() == "latency" {
+			shed++
+		}
+	}
+	assert.True(t, shed > 800 && shed < 1000)
+	assert.Equal(t, int64(1000-shed), s.inflight)
+}
+
+func Test_loadShedder_shedConcurrently(t *testing.T) {
+	s := &loadShedder{
+		maxInflight: 10,
+	}
+	var (
+		wg       sync.WaitGroup
+		admitted int64
+	)
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if s.shed() == "" {
+				atomic.AddInt64(&admitted, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	// admitted requests never finish, so no more than maxInflight are admitted
+	assert.Equal(t, int64(10), admitted)
+	assert.Equal(t, int64(10), s.inflight)
+}
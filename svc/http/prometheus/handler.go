@@ -7,12 +7,13 @@ import (
 
 // Routes return route slice for gorilla mux
 func Routes() []model.Route {
+	registerBuildInfo()
 	return []model.Route{
 		{
-			"Prometheus",
-			"GET",
-			"/go-doudou/prometheus",
-			promhttp.Handler().ServeHTTP,
+			Name:        "Prometheus",
+			Method:      "GET",
+			Pattern:     "/go-doudou/prometheus",
+			HandlerFunc: promhttp.Handler().ServeHTTP,
 		},
 	}
 }
@@ -4,10 +4,19 @@ package prometheus
 // Many thanks to TannerGabriel https://github.com/TannerGabriel
 // Post link https://gabrieltanner.org/blog/collecting-prometheus-metrics-in-golang written by TannerGabriel
 import (
+	"github.com/felixge/httpsnoop"
+	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+	"github.com/unionj-cloud/go-doudou/stringutils"
+	"github.com/unionj-cloud/go-doudou/svc/config"
+	"io"
 	"net/http"
+	"runtime"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 type responseWriter struct {
@@ -26,48 +35,170 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
-var totalRequests = prometheus.NewCounterVec(
-	prometheus.CounterOpts{
-		Name: "http_requests_total",
-		Help: "Number of get requests.",
-	},
-	[]string{"path", "method"},
-)
+// DefaultSizeBuckets are buckets in bytes for request and response size histograms, from 100B to 10MB
+var DefaultSizeBuckets = prometheus.ExponentialBuckets(100, 10, 6)
 
-var responseStatus = prometheus.NewCounterVec(
-	prometheus.CounterOpts{
-		Name: "response_status",
-		Help: "Status of HTTP response",
-	},
-	[]string{"status"},
-)
+// buckets parses comma separated numbers from env, such as 0.05,0.1,0.5,1. def is returned if env is empty or invalid
+func buckets(env config.EnvLoader, def []float64) []float64 {
+	raw := env.Load()
+	if stringutils.IsEmpty(raw) {
+		return def
+	}
+	var result []float64
+	for _, item := range strings.Split(raw, ",") {
+		bucket, err := strconv.ParseFloat(strings.TrimSpace(item), 64)
+		if err != nil {
+			logrus.Warnf("Parse %s %s failed: %s, use default buckets instead.\n", env, raw, err.Error())
+			return def
+		}
+		result = append(result, bucket)
+	}
+	return result
+}
 
-var httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
-	Name: "http_response_time_seconds",
-	Help: "Duration of HTTP requests.",
-}, []string{"path", "method"})
+// DurationBuckets returns buckets in seconds for duration histograms from GDD_PROMETHEUS_DURATION_BUCKETS
+func DurationBuckets() []float64 {
+	return buckets(config.GddPrometheusDurationBuckets, prometheus.DefBuckets)
+}
 
-// PrometheusMiddleware returns http HandlerFunc for prometheus matrix
-func PrometheusMiddleware(next http.Handler) http.Handler {
+// SizeBuckets returns buckets in bytes for size histograms from GDD_PROMETHEUS_SIZE_BUCKETS
+func SizeBuckets() []float64 {
+	return buckets(config.GddPrometheusSizeBuckets, DefaultSizeBuckets)
+}
+
+type metrics struct {
+	totalRequests  *prometheus.CounterVec
+	responseStatus *prometheus.CounterVec
+	httpDuration   *prometheus.HistogramVec
+	inflight       *prometheus.GaugeVec
+	requestSize    *prometheus.HistogramVec
+	responseSize   *prometheus.HistogramVec
+}
+
+func newMetrics(reg prometheus.Registerer) *metrics {
+	m := &metrics{
+		totalRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "Number of requests.",
+		}, []string{"path", "method"}),
+		responseStatus: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "response_status",
+			Help: "Status of HTTP response",
+		}, []string{"path", "method", "status"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_response_time_seconds",
+			Help:    "Duration of HTTP requests.",
+			Buckets: DurationBuckets(),
+		}, []string{"path", "method"}),
+		inflight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "http_requests_in_flight",
+			Help: "Number of requests being served.",
+		}, []string{"path", "method"}),
+		requestSize: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_size_bytes",
+			Help:    "Size of HTTP request bodies.",
+			Buckets: SizeBuckets(),
+		}, []string{"path", "method"}),
+		responseSize: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_response_size_bytes",
+			Help:    "Size of HTTP response bodies.",
+			Buckets: SizeBuckets(),
+		}, []string{"path", "method"}),
+	}
+	reg.MustRegister(m.totalRequests, m.responseStatus, m.httpDuration, m.inflight, m.requestSize, m.responseSize)
+	return m
+}
+
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	atomic.AddInt64(&c.n, int64(n))
+	return n, err
+}
+
+// pathTemplate returns path template of the matched route, such as /usersvc/user/{id},
+// so that path params don't explode cardinality of metrics
+func pathTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if tpl, err := route.GetPathTemplate(); err == nil {
+			return tpl
+		}
+	}
+	return "unmatched"
+}
+
+func (m *metrics) middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		path := r.URL.Path
+		path := pathTemplate(r)
 		method := r.Method
-		timer := prometheus.NewTimer(httpDuration.WithLabelValues(path, method))
+		inflight := m.inflight.WithLabelValues(path, method)
+		inflight.Inc()
+		defer inflight.Dec()
 
-		rw := NewResponseWriter(w)
-		next.ServeHTTP(rw, r)
+		var body *countingReader
+		if r.ContentLength < 0 && r.Body != nil && r.Body != http.NoBody {
+			body = &countingReader{ReadCloser: r.Body}
+			r.Body = body
+		}
+		snoop := httpsnoop.CaptureMetrics(next, w, r)
+		reqSize := r.ContentLength
+		if body != nil {
+			reqSize = atomic.LoadInt64(&body.n)
+		}
+		if reqSize < 0 {
+			reqSize = 0
+		}
 
-		statusCode := rw.statusCode
+		m.responseStatus.WithLabelValues(path, method, strconv.Itoa(snoop.Code)).Inc()
+		m.totalRequests.WithLabelValues(path, method).Inc()
+		m.httpDuration.WithLabelValues(path, method).Observe(snoop.Duration.Seconds())
+		m.requestSize.WithLabelValues(path, method).Observe(float64(reqSize))
+		m.responseSize.WithLabelValues(path, method).Observe(float64(snoop.Written))
+	})
+}
 
-		responseStatus.WithLabelValues(strconv.Itoa(statusCode)).Inc()
-		totalRequests.WithLabelValues(path, method).Inc()
+var (
+	metricsOnce    sync.Once
+	defaultMetrics *metrics
+)
 
-		timer.ObserveDuration()
+// PrometheusMiddleware returns http HandlerFunc for prometheus matrix. Metrics are labeled by path template
+// of the matched route instead of raw path. Metrics are created only once, because gorilla mux wraps handler
+// with middlewares for each request
+func PrometheusMiddleware(next http.Handler) http.Handler {
+	metricsOnce.Do(func() {
+		defaultMetrics = newMetrics(prometheus.DefaultRegisterer)
+	})
+	return defaultMetrics.middleware(next)
+}
+
+// newBuildInfo creates gauge with constant value 1 labeled by go-doudou version, build user, build time, go version and service name
+func newBuildInfo() prometheus.Gauge {
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "go_doudou_build_info",
+		Help: "Build information of the service. Value is always 1.",
+		ConstLabels: prometheus.Labels{
+			"gdd_version": config.GddVer,
+			"build_user":  config.BuildUser,
+			"build_time":  config.BuildTime,
+			"go_version":  runtime.Version(),
+			"service":     config.GddServiceName.Load(),
+		},
 	})
+	gauge.Set(1)
+	return gauge
 }
 
-func init() {
-	prometheus.Register(totalRequests)
-	prometheus.Register(responseStatus)
-	prometheus.Register(httpDuration)
+var buildInfoOnce sync.Once
+
+// registerBuildInfo registers build info metric. Go runtime and process metrics are registered
+// by prometheus client library by default
+func registerBuildInfo() {
+	buildInfoOnce.Do(func() {
+		prometheus.MustRegister(newBuildInfo())
+	})
 }
@@ -0,0 +1,84 @@
+package prometheus
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/unionj-cloud/go-doudou/svc/config"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	m := newMetrics(prometheus.NewRegistry())
+	router := mux.NewRouter()
+	router.Use(m.middleware)
+	router.HandleFunc("/user/{id}", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, float64(1), testutil.ToFloat64(m.inflight.WithLabelValues("/user/{id}", "POST")))
+		body, _ := ioutil.ReadAll(r.Body)
+		if mux.Vars(r)["id"] == "2" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		w.Write(body)
+	}).Methods("POST")
+
+	for _, id := range []string{"1", "2"} {
+		req := httptest.NewRequest("POST", "/user/"+id, strings.NewReader("hello"))
+		if id == "2" {
+			// unknown content length
+			req.ContentLength = -1
+		}
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	assert.Equal(t, float64(2), testutil.ToFloat64(m.totalRequests.WithLabelValues("/user/{id}", "POST")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.responseStatus.WithLabelValues("/user/{id}", "POST", "200")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.responseStatus.WithLabelValues("/user/{id}", "POST", "404")))
+	assert.Equal(t, float64(0), testutil.ToFloat64(m.inflight.WithLabelValues("/user/{id}", "POST")))
+	assert.Equal(t, 1, testutil.CollectAndCount(m.totalRequests))
+	assert.Equal(t, 1, testutil.CollectAndCount(m.requestSize))
+
+	expected := `
+# HELP http_request_size_bytes Size of HTTP request bodies.
+# TYPE http_request_size_bytes histogram
+http_request_size_bytes_bucket{method="POST",path="/user/{id}",le="100"} 2
+http_request_size_bytes_bucket{method="POST",path="/user/{id}",le="1000"} 2
+http_request_size_bytes_bucket{method="POST",path="/user/{id}",le="10000"} 2
+http_request_size_bytes_bucket{method="POST",path="/user/{id}",le="100000"} 2
+http_request_size_bytes_bucket{method="POST",path="/user/{id}",le="1e+06"} 2
+http_request_size_bytes_bucket{method="POST",path="/user/{id}",le="1e+07"} 2
+http_request_size_bytes_bucket{method="POST",path="/user/{id}",le="+Inf"} 2
+http_request_size_bytes_sum{method="POST",path="/user/{id}"} 10
+http_request_size_bytes_count{method="POST",path="/user/{id}"} 2
+`
+	assert.NoError(t, testutil.CollectAndCompare(m.requestSize, strings.NewReader(expected)))
+}
+
+func TestBuckets(t *testing.T) {
+	assert.Equal(t, prometheus.DefBuckets, DurationBuckets())
+	config.GddPrometheusDurationBuckets.Write("0.1, 0.5,1")
+	config.GddPrometheusSizeBuckets.Write("100,abc")
+	defer func() {
+		os.Unsetenv(config.GddPrometheusDurationBuckets.String())
+		os.Unsetenv(config.GddPrometheusSizeBuckets.String())
+	}()
+	assert.Equal(t, []float64{0.1, 0.5, 1}, DurationBuckets())
+	assert.Equal(t, DefaultSizeBuckets, SizeBuckets())
+}
+
+func TestBuildInfo(t *testing.T) {
+	config.GddVer = "v0.8.0"
+	config.GddServiceName.Write("usersvc")
+	defer func() {
+		config.GddVer = ""
+		os.Unsetenv(config.GddServiceName.String())
+	}()
+	gauge := newBuildInfo()
+	assert.Equal(t, float64(1), testutil.ToFloat64(gauge))
+	assert.Contains(t, gauge.Desc().String(), `gdd_version="v0.8.0"`)
+	assert.Contains(t, gauge.Desc().String(), `service="usersvc"`)
+}
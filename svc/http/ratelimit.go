@@ -0,0 +1,302 @@
+package ddhttp
+
+import (
+	"container/list"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+	"github.com/unionj-cloud/cast"
+	"github.com/unionj-cloud/go-doudou/stringutils"
+	"github.com/unionj-cloud/go-doudou/svc/config"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var rateLimitedRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "http_requests_limited_total",
+	Help: "Number of requests rejected by rate limiter.",
+}, []string{"policy", "route"})
+
+// Limit defines a token bucket which is refilled Rate tokens per second and holds at most Burst tokens
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// ParseLimit parses string like 10/s, 100/m:150 or 1000/h to Limit.
+// The number before slash is how many requests allowed per second, minute or hour,
+// the optional number after colon is burst. Default burst is equal to the number of requests.
+func ParseLimit(value string) (Limit, error) {
+	var limit Limit
+	spec := strings.TrimSpace(value)
+	if i := strings.Index(spec, ":"); i >= 0 {
+		burst, err := cast.ToIntE(strings.TrimSpace(spec[i+1:]))
+		if err != nil || burst <= 0 {
+			return limit, errors.Errorf("invalid burst in rate limit %s", value)
+		}
+		limit.Burst = burst
+		spec = spec[:i]
+	}
+	parts := strings.Split(spec, "/")
+	if len(parts) != 2 {
+		return limit, errors.Errorf("invalid rate limit %s", value)
+	}
+	count, err := cast.ToIntE(strings.TrimSpace(parts[0]))
+	if err != nil || count <= 0 {
+		return limit, errors.Errorf("invalid rate limit %s", value)
+	}
+	var period time.Duration
+	switch strings.TrimSpace(parts[1]) {
+	case "s":
+		period = time.Second
+	case "m":
+		period = time.Minute
+	case "h":
+		period = time.Hour
+	default:
+		return limit, errors.Errorf("invalid period in rate limit %s", value)
+	}
+	limit.Rate = float64(count) / period.Seconds()
+	if limit.Burst == 0 {
+		limit.Burst = count
+	}
+	return limit, nil
+}
+
+type bucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+}
+
+// take takes a token from the bucket. If no token left, it returns false and how long to wait for next token
+func (b *bucket) take(limit Limit, now time.Time) (bool, time.Duration) {
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+}
+
+// refund gives back a token taken for a request rejected later
+func (b *bucket) refund(limit Limit) {
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+1)
+}
+
+// KeyFunc extracts rate limiting key from request. Empty key means the request is not limited by the policy
+type KeyFunc func(r *http.Request) string
+
+type ratePolicy struct {
+	name  string
+	key   KeyFunc
+	limit Limit
+	// maxKeys is the max number of buckets held, least recently used buckets are evicted when exceeded
+	maxKeys int
+	lock    sync.Mutex
+	// ll holds buckets from the most recently used to the least
+	ll      *list.List
+	buckets map[string]*list.Element
+}
+
+func newRatePolicy(name string, key KeyFunc, limit Limit) *ratePolicy {
+	return &ratePolicy{
+		name:    name,
+		key:     key,
+		limit:   limit,
+		maxKeys: defaultRateLimitMaxKeys,
+		ll:      list.New(),
+		buckets: make(map[string]*list.Element),
+	}
+}
+
+func (p *ratePolicy) remove(elem *list.Element) {
+	p.ll.Remove(elem)
+	delete(p.buckets, elem.Value.(*bucket).key)
+}
+
+// allow checks whether the request identified by key is allowed
+func (p *ratePolicy) allow(key string, now time.Time) (bool, time.Duration) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	// remove buckets which have been refilled to full, they are equal to new ones
+	full := time.Duration(float64(p.limit.Burst) / p.limit.Rate * float64(time.Second))
+	for oldest := p.ll.Back(); oldest != nil && now.Sub(oldest.Value.(*bucket).last) > full; oldest = p.ll.Back() {
+		p.remove(oldest)
+	}
+	elem, ok := p.buckets[key]
+	if ok {
+		p.ll.MoveToFront(elem)
+	} else {
+		elem = p.ll.PushFront(&bucket{
+			key:    key,
+			tokens: float64(p.limit.Burst),
+			last:   now,
+		})
+		p.buckets[key] = elem
+		for p.maxKeys > 0 && p.ll.Len() > p.maxKeys {
+			p.remove(p.ll.Back())
+		}
+	}
+	return elem.Value.(*bucket).take(p.limit, now)
+}
+
+// refund gives back the token taken by allow for the request identified by key
+func (p *ratePolicy) refund(key string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if elem, ok := p.buckets[key]; ok {
+		elem.Value.(*bucket).refund(p.limit)
+	}
+}
+
+const defaultRateLimitMaxKeys = 10000
+
+// RateLimiter limits requests by token bucket policies. A request must pass all policies
+type RateLimiter struct {
+	policies []*ratePolicy
+	maxKeys  int
+}
+
+// RateLimiterOption sets policies of RateLimiter
+type RateLimiterOption func(*RateLimiter)
+
+// ClientIP returns ip address of the client. Use it with handlers.ProxyHeaders middleware behind trusted proxies only,
+// otherwise clients can spoof forwarded headers to get a new bucket for each request
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// WithRouteLimit limits requests to the route named route
+func WithRouteLimit(route string, limit Limit) RateLimiterOption {
+	return func(rl *RateLimiter) {
+		rl.policies = append(rl.policies, newRatePolicy("route:"+route, func(r *http.Request) string {
+			if name := routeName(r); name == route {
+				return name
+			}
+			return ""
+		}, limit))
+	}
+}
+
+// WithClientIPLimit limits requests from each client ip
+func WithClientIPLimit(limit Limit) RateLimiterOption {
+	return func(rl *RateLimiter) {
+		rl.policies = append(rl.policies, newRatePolicy("ip", ClientIP, limit))
+	}
+}
+
+// WithKeyLimit limits requests for each key extracted by key function, such as user id or api key.
+// Keys should come from trusted sources, such as verified tokens
+func WithKeyLimit(name string, key KeyFunc, limit Limit) RateLimiterOption {
+	return func(rl *RateLimiter) {
+		rl.policies = append(rl.policies, newRatePolicy(name, key, limit))
+	}
+}
+
+// WithMaxKeys sets max number of keys tracked by each policy, default is GDD_RATELIMIT_MAX_KEYS or 10000.
+// Least recently used keys are evicted when exceeded, and requests of evicted keys get full buckets again,
+// so it should be larger than the number of active clients. Zero or negative value means unlimited
+func WithMaxKeys(n int) RateLimiterOption {
+	return func(rl *RateLimiter) {
+		rl.maxKeys = n
+	}
+}
+
+// limitsFromEnv returns options from GDD_RATELIMIT_ROUTES and GDD_RATELIMIT_IP
+func limitsFromEnv() []RateLimiterOption {
+	var opts []RateLimiterOption
+	for route, value := range routeValues(config.GddRateLimitRoutes) {
+		limit, err := ParseLimit(value)
+		if err != nil {
+			logrus.Warnf("Parse %s %s failed: %s, ignore it.\n", config.GddRateLimitRoutes, route, err.Error())
+			continue
+		}
+		opts = append(opts, WithRouteLimit(route, limit))
+	}
+	ip := config.GddRateLimitIp.Load()
+	if stringutils.IsNotEmpty(ip) {
+		limit, err := ParseLimit(ip)
+		if err != nil {
+			logrus.Warnf("Parse %s %s failed: %s, ignore it.\n", config.GddRateLimitIp, ip, err.Error())
+		} else {
+			opts = append(opts, WithClientIPLimit(limit))
+		}
+	}
+	return opts
+}
+
+// NewRateLimiter creates a RateLimiter with policies from environment variables and options
+func NewRateLimiter(opts ...RateLimiterOption) *RateLimiter {
+	rl := &RateLimiter{
+		maxKeys: defaultRateLimitMaxKeys,
+	}
+	if raw := config.GddRateLimitMaxKeys.Load(); stringutils.IsNotEmpty(raw) {
+		maxKeys, err := cast.ToIntE(raw)
+		if err != nil {
+			logrus.Warnf("Parse %s %s failed: %s, use default %d instead.\n", config.GddRateLimitMaxKeys, raw, err.Error(), defaultRateLimitMaxKeys)
+		} else {
+			rl.maxKeys = maxKeys
+		}
+	}
+	for _, opt := range append(limitsFromEnv(), opts...) {
+		opt(rl)
+	}
+	for _, policy := range rl.policies {
+		policy.maxKeys = rl.maxKeys
+	}
+	return rl
+}
+
+// Middleware returns rate limiting middleware. Rejected requests get 429 status code with Retry-After header.
+// Tokens taken by earlier policies are given back if a later policy rejects the request
+func (rl *RateLimiter) Middleware(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+		keys := make([]string, len(rl.policies))
+		for i, policy := range rl.policies {
+			key := policy.key(r)
+			if stringutils.IsEmpty(key) {
+				continue
+			}
+			if ok, wait := policy.allow(key, now); !ok {
+				for j, taken := range keys[:i] {
+					if stringutils.IsNotEmpty(taken) {
+						rl.policies[j].refund(taken)
+					}
+				}
+				rateLimitedRequests.WithLabelValues(policy.name, routeName(r)).Inc()
+				w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(wait.Seconds()))))
+				http.Error(w, "too many requests", http.StatusTooManyRequests)
+				return
+			}
+			keys[i] = key
+		}
+		inner.ServeHTTP(w, r)
+	})
+}
+
+var (
+	rateLimiterOnce    sync.Once
+	defaultRateLimiter *RateLimiter
+)
+
+// RateLimit is rate limiting middleware configured by GDD_RATELIMIT_ROUTES and GDD_RATELIMIT_IP.
+// Limiter is created only once, because gorilla mux wraps handler with middlewares for each request
+func RateLimit(inner http.Handler) http.Handler {
+	rateLimiterOnce.Do(func() {
+		defaultRateLimiter = NewRateLimiter()
+	})
+	return defaultRateLimiter.Middleware(inner)
+}
@@ -0,0 +1,157 @@
+package ddhttp
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/unionj-cloud/go-doudou/svc/config"
+	"github.com/unionj-cloud/go-doudou/svc/http/model"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Limit
+		wantErr bool
+	}{
+		{
+			value: "10/s",
+			want:  Limit{Rate: 10, Burst: 10},
+		},
+		{
+			value: "120/m:30",
+			want:  Limit{Rate: 2, Burst: 30},
+		},
+		{
+			value: "3600/h",
+			want:  Limit{Rate: 1, Burst: 3600},
+		},
+		{
+			value:   "10/d",
+			wantErr: true,
+		},
+		{
+			value:   "abc",
+			wantErr: true,
+		},
+		{
+			value:   "10/s:0",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseLimit(tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_bucket_take(t *testing.T) {
+	limit := Limit{Rate: 1, Burst: 2}
+	now := time.Now()
+	b := &bucket{tokens: 2, last: now}
+	ok, _ := b.take(limit, now)
+	assert.True(t, ok)
+	ok, _ = b.take(limit, now)
+	assert.True(t, ok)
+	ok, wait := b.take(limit, now)
+	assert.False(t, ok)
+	assert.Equal(t, time.Second, wait)
+	ok, _ = b.take(limit, now.Add(time.Second))
+	assert.True(t, ok)
+	b.refund(limit)
+	b.refund(limit)
+	b.refund(limit)
+	assert.Equal(t, float64(2), b.tokens)
+}
+
+func Test_ratePolicy_maxKeys(t *testing.T) {
+	policy := newRatePolicy("ip", ClientIP, Limit{Rate: 0.001, Burst: 1})
+	policy.maxKeys = 2
+	now := time.Now()
+	for _, key := range []string{"a", "b", "a", "c"} {
+		policy.allow(key, now)
+	}
+	// b is the least recently used one
+	assert.Equal(t, 2, policy.ll.Len())
+	assert.Contains(t, policy.buckets, "a")
+	assert.Contains(t, policy.buckets, "c")
+	assert.NotContains(t, policy.buckets, "b")
+
+	// full buckets are removed
+	ok, _ := policy.allow("d", now.Add(time.Hour))
+	assert.True(t, ok)
+	assert.Equal(t, 1, policy.ll.Len())
+	assert.Contains(t, policy.buckets, "d")
+}
+
+func TestNewRateLimiter_maxKeys(t *testing.T) {
+	config.GddRateLimitMaxKeys.Write("5")
+	defer os.Unsetenv(config.GddRateLimitMaxKeys.String())
+	rl := NewRateLimiter(WithClientIPLimit(Limit{Rate: 1, Burst: 1}))
+	assert.Equal(t, 5, rl.policies[0].maxKeys)
+	rl = NewRateLimiter(WithClientIPLimit(Limit{Rate: 1, Burst: 1}), WithMaxKeys(0))
+	assert.Equal(t, 0, rl.policies[0].maxKeys)
+}
+
+func TestRateLimit(t *testing.T) {
+	config.GddRateLimitRoutes.Write("GetUser=1/m")
+	defer os.Unsetenv(config.GddRateLimitRoutes.String())
+	srv := NewDefaultHttpSrv()
+	srv.AddMiddleware(NewRateLimiter(WithKeyLimit("apikey", func(r *http.Request) string {
+		return r.Header.Get("X-Api-Key")
+	}, Limit{Rate: 1, Burst: 1})).Middleware)
+	srv.AddRoute(model.Route{
+		Name:        "GetUser",
+		Method:      "GET",
+		Pattern:     "/user",
+		HandlerFunc: func(w http.ResponseWriter, r *http.Request) {},
+	}, model.Route{
+		Name:        "GetBook",
+		Method:      "GET",
+		Pattern:     "/book",
+		HandlerFunc: func(w http.ResponseWriter, r *http.Request) {},
+	})
+	get := func(path string, apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("X-Api-Key", apiKey)
+		rec := httptest.NewRecorder()
+		srv.rootRouter.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusOK, get("/user", "").Code)
+	rec := get("/user", "")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "60", rec.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusOK, get("/book", "").Code)
+	assert.Equal(t, http.StatusOK, get("/book", "").Code)
+
+	assert.Equal(t, http.StatusOK, get("/book", "key1").Code)
+	assert.Equal(t, http.StatusTooManyRequests, get("/book", "key1").Code)
+	assert.Equal(t, http.StatusOK, get("/book", "key2").Code)
+
+	// GetBook policy gives back its token when apikey policy rejects
+	srv = NewDefaultHttpSrv()
+	srv.AddMiddleware(NewRateLimiter(WithRouteLimit("GetBook", Limit{Rate: 0.001, Burst: 2}), WithKeyLimit("apikey", func(r *http.Request) string {
+		return r.Header.Get("X-Api-Key")
+	}, Limit{Rate: 0.001, Burst: 1})).Middleware)
+	srv.AddRoute(model.Route{
+		Name:        "GetBook",
+		Method:      "GET",
+		Pattern:     "/book",
+		HandlerFunc: func(w http.ResponseWriter, r *http.Request) {},
+	})
+	assert.Equal(t, http.StatusOK, get("/book", "key1").Code)
+	assert.Equal(t, http.StatusTooManyRequests, get("/book", "key1").Code)
+	assert.Equal(t, http.StatusOK, get("/book", "key2").Code)
+}
@@ -27,8 +27,8 @@ func (receiver *RegistryHandlerImpl) GetRegistry(_writer http.ResponseWriter, _r
 		rows  []row
 		ret   []byte
 	)
-	if registry.LocalNode != nil {
-		nodes, _ = registry.LocalNode.Discover("")
+	if registry.Default != nil {
+		nodes, _ = registry.Default.Discover("")
 	}
 	for i, node := range nodes {
 		rows = append(rows, row{
@@ -0,0 +1,29 @@
+package ddhttp
+
+import (
+	"context"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+type rolesCtxKey struct{}
+
+// withRoles puts roles required by the matched route into request context.
+// It is the first middleware of business router, so all other middlewares can get roles
+func (srv *DefaultHttpSrv) withRoles(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if route := mux.CurrentRoute(r); route != nil {
+			if roles, ok := srv.roles[route.GetName()]; ok {
+				r = r.WithContext(context.WithValue(r.Context(), rolesCtxKey{}, roles))
+			}
+		}
+		inner.ServeHTTP(w, r)
+	})
+}
+
+// RolesFromContext returns roles required by the matched route declared by @role annotation in svc.go file.
+// Authorization middlewares can check them against roles of current user
+func RolesFromContext(ctx context.Context) []string {
+	roles, _ := ctx.Value(rolesCtxKey{}).([]string)
+	return roles
+}
@@ -0,0 +1,159 @@
+package ddhttp
+
+import (
+	"context"
+	"github.com/go-resty/resty/v2"
+	"github.com/unionj-cloud/go-doudou/stringutils"
+	"github.com/unionj-cloud/go-doudou/svc/config"
+	"github.com/unionj-cloud/go-doudou/svc/registry"
+	"hash/crc32"
+	"math/rand"
+	"net/http"
+	"sync"
+)
+
+// RouteVersionHeader carries version of nodes which requests should be routed to, such as v2
+const RouteVersionHeader = "X-Route-Version"
+
+type routeVersionCtxKey struct{}
+
+// WithRouteVersion returns a copy of ctx routing calls made with it to nodes tagged by registry.TagVersion
+// of version, falling back to other nodes if none found
+func WithRouteVersion(ctx context.Context, version string) context.Context {
+	return context.WithValue(ctx, routeVersionCtxKey{}, version)
+}
+
+// RouteVersion returns version set by WithRouteVersion
+func RouteVersion(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	version, _ := ctx.Value(routeVersionCtxKey{}).(string)
+	return version
+}
+
+// NewVersionRouting creates VersionRouting middleware accepting X-Route-Version of versions only,
+// other values are ignored. Empty versions accept any value
+func NewVersionRouting(versions ...string) func(http.Handler) http.Handler {
+	allowed := make(map[string]struct{}, len(versions))
+	for _, version := range versions {
+		allowed[version] = struct{}{}
+	}
+	return func(inner http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if version := r.Header.Get(RouteVersionHeader); stringutils.IsNotEmpty(version) {
+				if _, ok := allowed[version]; ok || len(allowed) == 0 {
+					r = r.WithContext(WithRouteVersion(r.Context(), version))
+				}
+			}
+			inner.ServeHTTP(w, r)
+		})
+	}
+}
+
+var (
+	versionRoutingOnce sync.Once
+	versionRouting     func(http.Handler) http.Handler
+)
+
+// VersionRouting puts value of X-Route-Version request header into request context, so that calls to other
+// services made with the context are routed to nodes of the version. Clients created by NewClient pass
+// the header on, so the whole call chain goes to the same version. Any client can pick a version by the header,
+// so only use it behind a gateway which sets or strips the header, or limit versions by GDD_ROUTE_VERSIONS
+func VersionRouting(inner http.Handler) http.Handler {
+	versionRoutingOnce.Do(func() {
+		versionRouting = NewVersionRouting(envList(config.GddRouteVersions, nil)...)
+	})
+	return versionRouting(inner)
+}
+
+// propagateRouteVersion sets X-Route-Version header of outgoing requests from their context
+func propagateRouteVersion(c *resty.Client, req *resty.Request) error {
+	if version := RouteVersion(req.Context()); stringutils.IsNotEmpty(version) && stringutils.IsEmpty(req.Header.Get(RouteVersionHeader)) {
+		req.SetHeader(RouteVersionHeader, version)
+	}
+	return nil
+}
+
+type canary struct {
+	version string
+	percent float64
+}
+
+// WithZone makes MemberlistServiceProvider prefer nodes tagged by registry.TagZone of zone, and fall back to
+// nodes of other zones if none available. Default is zone tag of local node
+func WithZone(zone string) MemberlistProviderOption {
+	return func(provider IServiceProvider) {
+		if p, ok := provider.(*MemberlistServiceProvider); ok {
+			p.zone = zone
+		}
+	}
+}
+
+// WithCanary routes percent of requests, from 0 to 100, to nodes tagged by registry.TagVersion of version,
+// and the others to nodes of other versions. Requests with the same key set by WithHashKey stick to the same side.
+// Requests with version set by WithRouteVersion or VersionRouting middleware ignore the split
+func WithCanary(version string, percent float64) MemberlistProviderOption {
+	return func(provider IServiceProvider) {
+		if p, ok := provider.(*MemberlistServiceProvider); ok {
+			p.canary = &canary{
+				version: version,
+				percent: percent,
+			}
+		}
+	}
+}
+
+func filterNodes(nodes []*registry.Node, match func(node *registry.Node) bool) []*registry.Node {
+	var matched []*registry.Node
+	for _, node := range nodes {
+		if match(node) {
+			matched = append(matched, node)
+		}
+	}
+	return matched
+}
+
+// toCanary decides whether the request of ctx goes to canary nodes
+func (c *canary) toCanary(ctx context.Context) bool {
+	if c.percent <= 0 {
+		return false
+	}
+	if c.percent >= 100 {
+		return true
+	}
+	if key := HashKey(ctx); stringutils.IsNotEmpty(key) {
+		return float64(crc32.ChecksumIEEE([]byte(key))%10000) < c.percent*100
+	}
+	return rand.Float64()*100 < c.percent
+}
+
+// route narrows nodes down by version and zone. It never returns empty result for non-empty nodes
+func (m *MemberlistServiceProvider) route(ctx context.Context, nodes []*registry.Node) []*registry.Node {
+	if version := RouteVersion(ctx); stringutils.IsNotEmpty(version) {
+		if matched := filterNodes(nodes, func(node *registry.Node) bool {
+			return node.Tag(registry.TagVersion) == version
+		}); len(matched) > 0 {
+			nodes = matched
+		}
+	} else if m.canary != nil {
+		toCanary := m.canary.toCanary(ctx)
+		if matched := filterNodes(nodes, func(node *registry.Node) bool {
+			return (node.Tag(registry.TagVersion) == m.canary.version) == toCanary
+		}); len(matched) > 0 {
+			nodes = matched
+		}
+	}
+	zone := m.zone
+	if stringutils.IsEmpty(zone) && registry.LocalNode != nil {
+		zone = registry.LocalNode.Tag(registry.TagZone)
+	}
+	if stringutils.IsNotEmpty(zone) {
+		if matched := filterNodes(nodes, func(node *registry.Node) bool {
+			return node.Tag(registry.TagZone) == zone
+		}); len(matched) > 0 {
+			nodes = matched
+		}
+	}
+	return nodes
+}
@@ -0,0 +1,119 @@
+package ddhttp
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/svc/registry"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newTaggedNode(t *testing.T, host, zone, version string) *registry.Node {
+	node, err := registry.NewRemoteNode("testsvc", "http://"+host, registry.WithTag(registry.TagZone, zone),
+		registry.WithTag(registry.TagVersion, version))
+	require.NoError(t, err)
+	return node
+}
+
+func TestMemberlistServiceProvider_Zone(t *testing.T) {
+	nodes := testRegistry{
+		newTaggedNode(t, "za1:80", "a", "v1"),
+		newTaggedNode(t, "zb1:80", "b", "v1"),
+		newTaggedNode(t, "zb2:80", "b", "v1"),
+	}
+	provider := NewMemberlistServiceProvider("testsvc", nodes, WithZone("a"))
+	for i := 0; i < 3; i++ {
+		url, err := provider.SelectServer()
+		require.NoError(t, err)
+		assert.Equal(t, "http://za1:80", url)
+	}
+	// fall back to other zones
+	provider = NewMemberlistServiceProvider("testsvc", nodes[1:], WithZone("a"))
+	url, err := provider.SelectServer()
+	require.NoError(t, err)
+	assert.Contains(t, []string{"http://zb1:80", "http://zb2:80"}, url)
+}
+
+func TestMemberlistServiceProvider_Canary(t *testing.T) {
+	nodes := testRegistry{
+		newTaggedNode(t, "cv1:80", "a", "v1"),
+		newTaggedNode(t, "cv2:80", "a", "v2"),
+	}
+	provider := NewMemberlistServiceProvider("testsvc", nodes, WithCanary("v2", 20))
+	counts := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		url, err := provider.SelectServer()
+		require.NoError(t, err)
+		counts[url]++
+	}
+	assert.InDelta(t, 200, counts["http://cv2:80"], 80)
+
+	// requests of the same key stick to the same side
+	ctx := WithHashKey(context.Background(), "user1")
+	first, _ := SelectServer(ctx, provider)
+	for i := 0; i < 10; i++ {
+		url, _ := SelectServer(ctx, provider)
+		assert.Equal(t, first, url)
+	}
+
+	// pinned version ignores the split
+	ctx = WithRouteVersion(context.Background(), "v2")
+	for i := 0; i < 10; i++ {
+		url, _ := SelectServer(ctx, provider)
+		assert.Equal(t, "http://cv2:80", url)
+	}
+	// unknown version falls back
+	url, err := SelectServer(WithRouteVersion(context.Background(), "v3"), NewMemberlistServiceProvider("testsvc", nodes))
+	require.NoError(t, err)
+	assert.NotEmpty(t, url)
+
+	provider = NewMemberlistServiceProvider("testsvc", nodes, WithCanary("v2", 100))
+	for i := 0; i < 10; i++ {
+		url, _ := provider.SelectServer()
+		assert.Equal(t, "http://cv2:80", url)
+	}
+}
+
+func TestVersionRouting(t *testing.T) {
+	var received string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get(RouteVersionHeader)
+	}))
+	defer backend.Close()
+	client := NewClient()
+	handler := VersionRouting(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := client.R().SetContext(r.Context()).Get(backend.URL)
+		require.NoError(t, err)
+		fmt.Fprint(w, RouteVersion(r.Context()))
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(RouteVersionHeader, "v2")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, "v2", rec.Body.String())
+	assert.Equal(t, "v2", received)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Empty(t, rec.Body.String())
+	assert.Empty(t, received)
+}
+
+func TestNewVersionRouting(t *testing.T) {
+	handler := NewVersionRouting("v1", "v2")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, RouteVersion(r.Context()))
+	}))
+	route := func(version string) string {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(RouteVersionHeader, version)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Body.String()
+	}
+	assert.Equal(t, "v2", route("v2"))
+	assert.Empty(t, route("internal-debug"))
+}
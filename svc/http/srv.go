@@ -1,24 +1,32 @@
 package ddhttp
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
 	"github.com/olekukonko/tablewriter"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"github.com/unionj-cloud/go-doudou/logutils"
 	"github.com/unionj-cloud/go-doudou/pathutils"
-	"github.com/unionj-cloud/go-doudou/stringutils"
 	"github.com/unionj-cloud/go-doudou/svc/config"
 	"github.com/unionj-cloud/go-doudou/svc/http/model"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 	"io"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"path"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 )
 
 var (
-	logFile *os.File
+	logFile *logutils.RotatingFile
 )
 
 func init() {
@@ -33,6 +41,10 @@ type Srv interface {
 	AddRoute(route ...model.Route)
 	// Use middleware
 	AddMiddleware(mwf ...func(http.Handler) http.Handler)
+	// OnStart registers hooks run in order after http server started and before it becomes ready
+	OnStart(hooks ...func(ctx context.Context) error)
+	// OnShutdown registers hooks run in reverse order after http server stopped
+	OnShutdown(hooks ...func(ctx context.Context) error)
 }
 
 func newServer(router http.Handler) *http.Server {
@@ -64,19 +76,54 @@ func newServer(router http.Handler) *http.Server {
 		ReadTimeout:  read,
 		IdleTimeout:  idle,
 		Handler:      router, // Pass our instance of gorilla/mux in.
+		ConnContext:  withConn,
 	}
 
-	// Run our server in a goroutine so that it doesn't block.
-	go func() {
-		logrus.Infof("Http server is listening on %s\n", server.Addr)
-		if err := server.ListenAndServe(); err != nil {
-			logrus.Println(err)
+	if tlsEnabled() {
+		tlsConfig, err := ServerTLSConfig(config.GddTlsCert.Load(), config.GddTlsKey.Load(), config.GddTlsCa.Load())
+		if err != nil {
+			logrus.Panicln(fmt.Sprintf("%+v", err))
 		}
-	}()
+		if tlsConfig.ClientAuth == tls.RequireAndVerifyClientCert {
+			// kubernetes probes don't send client certificate, health endpoints are exempted by RequireClientCert
+			tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+			server.Handler = RequireClientCert(router)
+		}
+		server.TLSConfig = tlsConfig
+	} else if config.GddH2c.Load() == "true" {
+		server.Handler = h2c.NewHandler(router, &http2.Server{
+			IdleTimeout: idle,
+		})
+	}
 
 	return server
 }
 
+// startServer listens on address of server, and serves in a goroutine so that it doesn't block.
+// Error of listening is sent to the returned channel before it returns, and error of serving is sent later
+func startServer(server *http.Server) <-chan error {
+	errs := make(chan error, 1)
+	ln, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		errs <- errors.Wrapf(err, "listen on %s failed", server.Addr)
+		return errs
+	}
+	go func() {
+		var err error
+		if server.TLSConfig != nil {
+			logrus.Infof("Https server is listening on %s\n", server.Addr)
+			err = server.ServeTLS(ln, "", "")
+		} else {
+			logrus.Infof("Http server is listening on %s\n", server.Addr)
+			err = server.Serve(ln)
+		}
+		if err != nil && err != http.ErrServerClosed {
+			errs <- errors.Wrap(err, "http server stopped")
+		}
+	}()
+	return errs
+}
+
 func configureLogger() {
 	var logptr *string
 	logpath, isSet := os.LookupEnv(config.GddLogPath.String())
@@ -86,12 +133,8 @@ func configureLogger() {
 	var loglevel config.LogLevel
 	(&loglevel).Decode(config.GddLogLevel.Load())
 
-	formatter := new(logrus.TextFormatter)
-	formatter.TimestampFormat = "2006-01-02 15:04:05"
-	formatter.FullTimestamp = true
-
 	logger := logrus.StandardLogger()
-	logger.SetFormatter(formatter)
+	logger.SetFormatter(logutils.NewFormatter())
 	logger.SetLevel(logrus.Level(loglevel))
 
 	if logptr != nil {
@@ -101,21 +144,37 @@ func configureLogger() {
 		if err != nil {
 			logger.Errorln(fmt.Sprintf("%+v\n", err))
 		}
-		if stringutils.IsNotEmpty(logpath) {
-			err = os.MkdirAll(logpath, os.ModePerm)
-			if err != nil {
-				logger.Errorln(err)
-			}
-		}
-		logFile, err = os.OpenFile(filepath.Join(logpath, "app.log"), os.O_APPEND|os.O_CREATE|os.O_RDWR, os.ModePerm)
+		logFile, err = logutils.NewRotatingFile(filepath.Join(logpath, "app.log"), logutils.RotateOptionsFromEnv())
 		if err != nil {
-			logger.Errorf("error opening file: %v\n", err)
+			logger.Errorf("error opening file: %+v\n", err)
+			return
 		}
-		mw := io.MultiWriter(os.Stdout, logFile)
-		logger.SetOutput(mw)
+		logger.SetOutput(io.MultiWriter(os.Stdout, logFile))
+		reopenOnSighup(logFile)
 	}
 }
 
+// closeLogFile is a shutdown hook switching logger back to stdout and closing the log file
+func closeLogFile(ctx context.Context) error {
+	logrus.SetOutput(os.Stdout)
+	return Closer("log file", logFile)(ctx)
+}
+
+// reopenOnSighup reopens log file on SIGHUP, so that it is recreated after moved away by external tools like logrotate
+func reopenOnSighup(file *logutils.RotatingFile) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	go func() {
+		for range c {
+			if err := file.Reopen(); err != nil {
+				logrus.Errorf("reopen log file failed: %+v\n", err)
+				continue
+			}
+			logrus.Infoln("log file reopened")
+		}
+	}()
+}
+
 func printRoutes(routes []model.Route) {
 	logrus.Infoln("================ Registered Routes ================")
 	data := [][]string{}
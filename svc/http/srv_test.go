@@ -0,0 +1,92 @@
+package ddhttp
+
+import (
+	"context"
+	"crypto/tls"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/logutils"
+	"github.com/unionj-cloud/go-doudou/svc/config"
+	"golang.org/x/net/http2"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_newServerH2c(t *testing.T) {
+	config.GddH2c.Write("true")
+	defer os.Unsetenv(config.GddH2c.String())
+	server := newServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	ts := httptest.NewServer(server.Handler)
+	defer ts.Close()
+
+	client := &http.Client{
+		Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+				return net.Dial(network, addr)
+			},
+		},
+	}
+	resp, err := client.Get(ts.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, 2, resp.ProtoMajor)
+
+	resp, err = http.Get(ts.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, 1, resp.ProtoMajor)
+}
+
+func Test_startServer(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	server := &http.Server{Addr: ln.Addr().String(), Handler: http.NotFoundHandler()}
+	select {
+	case err := <-startServer(server):
+		assert.Error(t, err)
+	default:
+		t.Fatal("listen error should be sent before startServer returns")
+	}
+
+	server = &http.Server{Addr: "127.0.0.1:0", Handler: http.NotFoundHandler()}
+	errs := startServer(server)
+	require.NoError(t, server.Close())
+	select {
+	case err := <-errs:
+		t.Fatalf("closed server should not send error, got %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func Test_closeLogFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	file, err := logutils.NewRotatingFile(filename, logutils.RotateOptions{})
+	require.NoError(t, err)
+	logFile = file
+	defer func() {
+		logFile = nil
+	}()
+	logrus.SetOutput(file)
+	defer logrus.SetOutput(os.Stdout)
+
+	srv := NewDefaultHttpSrv()
+	logrus.Infoln("before shutdown")
+	srv.runShutdownHooks(context.Background())
+	assert.Equal(t, os.Stdout, logrus.StandardLogger().Out)
+	logrus.Infoln("after shutdown")
+	data, err := ioutil.ReadFile(filename)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "before shutdown")
+	assert.NotContains(t, string(data), "after shutdown")
+}
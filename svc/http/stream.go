@@ -0,0 +1,169 @@
+package ddhttp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/unionj-cloud/go-doudou/stringutils"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const streamBufferSize = 32 << 10
+
+// EventKeepAlive is interval of comments sent by generated handlers to keep Server-Sent Events connections
+// from being closed by idle timeout of proxies
+var EventKeepAlive = 15 * time.Second
+
+type connCtxKey struct{}
+
+// withConn is ConnContext of http server, which keeps connection in context of its requests
+func withConn(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connCtxKey{}, c)
+}
+
+// ClearWriteDeadline clears write deadline set by GDD_WRITE_TIMEOUT on connection of r, so that long-lived
+// responses such as streams and Server-Sent Events are not cut off. The deadline is set again on the next request
+// of the connection. It only works for HTTP/1.x requests served by ddhttp, because deadlines of HTTP/2 streams
+// are not accessible before go1.20
+func ClearWriteDeadline(r *http.Request) {
+	if r.ProtoMajor != 1 {
+		return
+	}
+	if c, ok := r.Context().Value(connCtxKey{}).(net.Conn); ok {
+		_ = c.SetWriteDeadline(time.Time{})
+	}
+}
+
+// WriteStream copies r to w by chunked transfer encoding, flushing after each read, so that clients receive data
+// as soon as it is produced. Default content type is application/octet-stream. r is closed if it is an io.Closer
+func WriteStream(w http.ResponseWriter, r io.Reader, contentType string) error {
+	if closer, ok := r.(io.Closer); ok {
+		defer closer.Close()
+	}
+	if stringutils.IsEmpty(contentType) {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Del("Content-Length")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	buf := make([]byte, streamBufferSize)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return errors.Wrap(werr, "write stream failed")
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "read stream failed")
+		}
+	}
+}
+
+// EventWriter writes Server-Sent Events. Each event is encoded as json in a data field
+type EventWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+// NewEventWriter sets headers of Server-Sent Events and sends them to client.
+// It returns error if w doesn't support flushing
+func NewEventWriter(w http.ResponseWriter) (*EventWriter, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, errors.New("streaming unsupported")
+	}
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	// disable response buffering of nginx
+	header.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	return &EventWriter{
+		w:       w,
+		flusher: flusher,
+	}, nil
+}
+
+// KeepAlive writes a comment and flushes it to client. Clients ignore comments
+func (e *EventWriter) KeepAlive() error {
+	if _, err := io.WriteString(e.w, ": keepalive\n\n"); err != nil {
+		return errors.Wrap(err, "write keepalive failed")
+	}
+	e.flusher.Flush()
+	return nil
+}
+
+// Send writes data as an event and flushes it to client
+func (e *EventWriter) Send(data interface{}) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return errors.Wrap(err, "marshal event failed")
+	}
+	if _, err = fmt.Fprintf(e.w, "data: %s\n\n", b); err != nil {
+		return errors.Wrap(err, "write event failed")
+	}
+	e.flusher.Flush()
+	return nil
+}
+
+// EventReader reads Server-Sent Events written by EventWriter
+type EventReader struct {
+	r *bufio.Reader
+}
+
+// NewEventReader creates an EventReader reading from r
+func NewEventReader(r io.Reader) *EventReader {
+	return &EventReader{
+		r: bufio.NewReader(r),
+	}
+}
+
+func decodeEvent(data []byte, v interface{}) error {
+	if err := json.Unmarshal(data, v); err != nil {
+		return errors.Wrap(err, "unmarshal event failed")
+	}
+	return nil
+}
+
+// Next reads data of the next event and decodes it into v as json. It returns io.EOF when the stream ends.
+// Comments, events without data and fields other than data are skipped
+func (e *EventReader) Next(v interface{}) error {
+	var data bytes.Buffer
+	for {
+		line, err := e.r.ReadString('\n')
+		if err != nil {
+			// incomplete event at the end of stream is discarded as the spec requires
+			return err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if stringutils.IsEmpty(line) {
+			if data.Len() == 0 {
+				continue
+			}
+			return decodeEvent(data.Bytes(), v)
+		}
+		if strings.HasPrefix(line, "data:") {
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package ddhttp
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteStream(t *testing.T) {
+	rec := httptest.NewRecorder()
+	body := ioutil.NopCloser(strings.NewReader("id,name\n1,jack\n"))
+	require.NoError(t, WriteStream(rec, body, "text/csv"))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/csv", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "id,name\n1,jack\n", rec.Body.String())
+	assert.True(t, rec.Flushed)
+
+	rec = httptest.NewRecorder()
+	require.NoError(t, WriteStream(rec, strings.NewReader(""), ""))
+	assert.Equal(t, "application/octet-stream", rec.Header().Get("Content-Type"))
+}
+
+type event struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestEvents(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ew, err := NewEventWriter(w)
+		require.NoError(t, err)
+		for i := 1; i <= 3; i++ {
+			require.NoError(t, ew.Send(event{Id: i, Name: "jack"}))
+			require.NoError(t, ew.KeepAlive())
+		}
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequestWithContext(context.Background(), "GET", server.URL, nil)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	reader := NewEventReader(resp.Body)
+	var events []event
+	for {
+		var e event
+		if err = reader.Next(&e); err != nil {
+			break
+		}
+		events = append(events, e)
+	}
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, []event{{1, "jack"}, {2, "jack"}, {3, "jack"}}, events)
+}
+
+func TestClearWriteDeadline(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("clear") == "true" {
+			ClearWriteDeadline(r)
+		}
+		time.Sleep(300 * time.Millisecond)
+		w.Write([]byte("done"))
+	}))
+	server.Config.WriteTimeout = 100 * time.Millisecond
+	server.Config.ConnContext = withConn
+	server.Start()
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "?clear=true")
+	require.NoError(t, err)
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "done", string(body))
+
+	// the deadline is set again for the next request
+	_, err = http.Get(server.URL)
+	assert.Error(t, err)
+}
+
+func TestEventReader(t *testing.T) {
+	reader := NewEventReader(strings.NewReader(": comment\r\nevent: update\r\ndata: {\"id\":1,\r\ndata: \"name\":\"jack\"}\r\n\r\n\ndata: 2\n\ndata: {\"id\":3}"))
+	var e event
+	require.NoError(t, reader.Next(&e))
+	assert.Equal(t, event{1, "jack"}, e)
+	assert.Error(t, reader.Next(&e))
+	// incomplete event is discarded
+	assert.Equal(t, io.EOF, reader.Next(&e))
+}
+
+func TestNewStreamClient(t *testing.T) {
+	assert.Equal(t, time.Minute, NewClient().GetClient().Timeout)
+	client := NewStreamClient()
+	assert.Zero(t, client.GetClient().Timeout)
+	require.IsType(t, &http.Transport{}, client.GetClient().Transport)
+	assert.Equal(t, time.Minute, client.GetClient().Transport.(*http.Transport).ResponseHeaderTimeout)
+}
@@ -0,0 +1,102 @@
+package ddhttp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"github.com/go-resty/resty/v2"
+	"github.com/pkg/errors"
+	"github.com/unionj-cloud/go-doudou/stringutils"
+	"github.com/unionj-cloud/go-doudou/svc/config"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// tlsEnabled returns true if both GDD_TLS_CERT and GDD_TLS_KEY are set
+func tlsEnabled() bool {
+	return stringutils.IsNotEmpty(config.GddTlsCert.Load()) && stringutils.IsNotEmpty(config.GddTlsKey.Load())
+}
+
+func loadCertPool(caFile string, pool *x509.CertPool) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read CA file %s failed", caFile)
+	}
+	if pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.Errorf("no valid certificate found in CA file %s", caFile)
+	}
+	return pool, nil
+}
+
+// ServerTLSConfig creates tls config for http server. If caFile is not empty,
+// client certificates signed by it are required and verified (mTLS)
+func ServerTLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "load server certificate failed")
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+	if stringutils.IsNotEmpty(caFile) {
+		if tlsConfig.ClientCAs, err = loadCertPool(caFile, nil); err != nil {
+			return nil, err
+		}
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsConfig, nil
+}
+
+// RequireClientCert rejects requests without verified client certificate except kubernetes probes to
+// /go-doudou/health/, which can't send one. It is used with tls.VerifyClientCertIfGiven, so that
+// probes and other requests share the same port under mTLS
+func RequireClientCert(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if (r.TLS == nil || len(r.TLS.VerifiedChains) == 0) && !strings.HasPrefix(r.URL.Path, gddPathPrefix+"health/") {
+			http.Error(w, "client certificate required", http.StatusUnauthorized)
+			return
+		}
+		inner.ServeHTTP(w, r)
+	})
+}
+
+// ClientTLSConfig creates tls config for http client. If certFile and keyFile are not empty,
+// the certificate is sent to servers requiring client certificates. If caFile is not empty,
+// servers whose certificates are signed by it are trusted besides system CAs
+func ClientTLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+	if stringutils.IsNotEmpty(certFile) && stringutils.IsNotEmpty(keyFile) {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "load client certificate failed")
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if stringutils.IsNotEmpty(caFile) {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = nil
+		}
+		if tlsConfig.RootCAs, err = loadCertPool(caFile, pool); err != nil {
+			return nil, err
+		}
+	}
+	return tlsConfig, nil
+}
+
+// NewTLSClient creates new resty Client instance with client certificate and CA
+func NewTLSClient(certFile, keyFile, caFile string) (*resty.Client, error) {
+	tlsConfig, err := ClientTLSConfig(certFile, keyFile, caFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "NewTLSClient() error")
+	}
+	client := NewClient()
+	client.GetClient().Transport.(*http.Transport).TLSClientConfig = tlsConfig
+	return client, nil
+}
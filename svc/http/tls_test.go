@@ -0,0 +1,135 @@
+package ddhttp
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/svc/config"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// writeCert generates a certificate signed by parent, or a self-signed CA if parent is nil,
+// and writes it to dir as name.crt and name.key
+func writeCert(t *testing.T, dir, name string, parent *testCert, usage x509.ExtKeyUsage) (*testCert, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+	} else {
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{usage}
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+	require.NoError(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), os.ModePerm))
+	require.NoError(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), os.ModePerm))
+	return &testCert{cert: cert, key: key}, certFile, keyFile
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca, caFile, _ := writeCert(t, dir, "ca", nil, 0)
+	_, serverCert, serverKey := writeCert(t, dir, "server", ca, x509.ExtKeyUsageServerAuth)
+	_, clientCert, clientKey := writeCert(t, dir, "client", ca, x509.ExtKeyUsageClientAuth)
+
+	tlsConfig, err := ServerTLSConfig(serverCert, serverKey, caFile)
+	require.NoError(t, err)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	server.TLS = tlsConfig
+	server.StartTLS()
+	defer server.Close()
+
+	client, err := NewTLSClient(clientCert, clientKey, caFile)
+	require.NoError(t, err)
+	resp, err := client.R().Get(server.URL)
+	require.NoError(t, err)
+	assert.Equal(t, "client", resp.String())
+
+	// server requires client certificate
+	client, err = NewTLSClient("", "", caFile)
+	require.NoError(t, err)
+	_, err = client.R().Get(server.URL)
+	assert.Error(t, err)
+
+	// client doesn't trust server certificate
+	_, err = NewClient().R().Get(server.URL)
+	assert.Error(t, err)
+
+	_, err = ServerTLSConfig(serverCert, serverKey, serverKey)
+	assert.Error(t, err)
+}
+
+func Test_newServerMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca, caFile, _ := writeCert(t, dir, "ca", nil, 0)
+	_, serverCert, serverKey := writeCert(t, dir, "server", ca, x509.ExtKeyUsageServerAuth)
+	_, clientCert, clientKey := writeCert(t, dir, "client", ca, x509.ExtKeyUsageClientAuth)
+	config.GddTlsCert.Write(serverCert)
+	config.GddTlsKey.Write(serverKey)
+	config.GddTlsCa.Write(caFile)
+	defer func() {
+		os.Unsetenv(config.GddTlsCert.String())
+		os.Unsetenv(config.GddTlsKey.String())
+		os.Unsetenv(config.GddTlsCa.String())
+	}()
+	server := newServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	ts := httptest.NewUnstartedServer(server.Handler)
+	ts.TLS = server.TLSConfig
+	ts.StartTLS()
+	defer ts.Close()
+
+	// kubernetes probes don't send client certificate
+	probe, err := NewTLSClient("", "", caFile)
+	require.NoError(t, err)
+	resp, err := probe.R().Get(ts.URL + "/go-doudou/health/ready")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+	resp, err = probe.R().Get(ts.URL + "/user")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode())
+
+	client, err := NewTLSClient(clientCert, clientKey, caFile)
+	require.NoError(t, err)
+	resp, err = client.R().Get(ts.URL + "/user")
+	require.NoError(t, err)
+	assert.Equal(t, "ok", resp.String())
+}
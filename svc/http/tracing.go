@@ -0,0 +1,89 @@
+package ddhttp
+
+import (
+	"fmt"
+	"github.com/felixge/httpsnoop"
+	"github.com/go-resty/resty/v2"
+	"github.com/gorilla/mux"
+	"github.com/unionj-cloud/go-doudou/svc/tracing"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"sync"
+)
+
+// Tracing starts an OpenTelemetry server span named by route name for each request. W3C trace context from
+// traceparent and tracestate headers is extracted, so the span joins the trace of the caller. Spans are exported by
+// the tracer provider configured by GDD_TRACING_* environment variables
+func Tracing(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := routeName(r)
+		if name == "" {
+			name = fmt.Sprintf("HTTP %s", r.Method)
+		}
+		var route string
+		if current := mux.CurrentRoute(r); current != nil {
+			route, _ = current.GetPathTemplate()
+		}
+		ctx, span := tracing.Start(tracing.Extract(r.Context(), r.Header), name,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPServerAttributesFromHTTPRequest("", route, r)...))
+		defer span.End()
+		m := httpsnoop.CaptureMetrics(inner, w, r.WithContext(ctx))
+		span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(m.Code)...)
+		if m.Code >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(m.Code))
+		}
+	})
+}
+
+// clientSpans holds client spans of in-flight requests, because resty hooks can only pass data by *resty.Request
+var clientSpans sync.Map
+
+// TraceClient makes client start an OpenTelemetry client span for each request and propagate W3C trace context
+// by traceparent and tracestate headers. Clients created by NewClient are already traced,
+// so it is only needed for clients created in other ways
+func TraceClient(client *resty.Client) *resty.Client {
+	client.OnBeforeRequest(startClientSpan)
+	client.OnAfterResponse(endClientSpan)
+	client.OnError(func(req *resty.Request, err error) {
+		if value, ok := clientSpans.Load(req); ok {
+			clientSpans.Delete(req)
+			span := value.(trace.Span)
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			span.End()
+		}
+	})
+	return client
+}
+
+func startClientSpan(c *resty.Client, req *resty.Request) error {
+	// previous attempt failed before getting response when retrying
+	if value, ok := clientSpans.Load(req); ok {
+		value.(trace.Span).SetStatus(codes.Error, "retried")
+		value.(trace.Span).End()
+	}
+	ctx, span := tracing.Start(req.Context(), fmt.Sprintf("HTTP %s", req.Method),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.HTTPMethodKey.String(req.Method), semconv.HTTPURLKey.String(req.URL)))
+	tracing.Inject(ctx, req.Header)
+	clientSpans.Store(req, span)
+	return nil
+}
+
+func endClientSpan(c *resty.Client, resp *resty.Response) error {
+	value, ok := clientSpans.Load(resp.Request)
+	if !ok {
+		return nil
+	}
+	clientSpans.Delete(resp.Request)
+	span := value.(trace.Span)
+	span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(resp.StatusCode())...)
+	if resp.StatusCode() >= http.StatusBadRequest {
+		span.SetStatus(codes.Error, resp.Status())
+	}
+	span.End()
+	return nil
+}
@@ -0,0 +1,92 @@
+package ddhttp
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/svc/http/model"
+	"github.com/unionj-cloud/go-doudou/svc/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func spanAttributes(span sdktrace.ReadOnlySpan) map[attribute.Key]interface{} {
+	attrs := make(map[attribute.Key]interface{})
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value.AsInterface()
+	}
+	return attrs
+}
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracing.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer tracing.SetTracerProvider(nil)
+
+	var downstream string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downstream = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	srv := NewDefaultHttpSrv()
+	srv.AddMiddleware(Tracing)
+	srv.AddRoute(model.Route{
+		Name:    "GetUser",
+		Method:  "GET",
+		Pattern: "/user/{id}",
+		HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+			_, err := NewClient().R().SetContext(r.Context()).Get(server.URL)
+			require.NoError(t, err)
+			w.WriteHeader(http.StatusInternalServerError)
+		},
+	})
+	req := httptest.NewRequest("GET", "/user/1", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	rec := httptest.NewRecorder()
+	srv.rootRouter.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	client, serverSpan := spans[0], spans[1]
+	assert.Equal(t, "GetUser", serverSpan.Name())
+	assert.Equal(t, trace.SpanKindServer, serverSpan.SpanKind())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", serverSpan.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", serverSpan.Parent().SpanID().String())
+	assert.Equal(t, "/user/{id}", spanAttributes(serverSpan)["http.route"])
+	assert.Equal(t, int64(http.StatusInternalServerError), spanAttributes(serverSpan)["http.status_code"])
+	assert.Equal(t, codes.Error, serverSpan.Status().Code)
+
+	assert.Equal(t, "HTTP GET", client.Name())
+	assert.Equal(t, trace.SpanKindClient, client.SpanKind())
+	assert.Equal(t, serverSpan.SpanContext().TraceID(), client.SpanContext().TraceID())
+	assert.Equal(t, serverSpan.SpanContext().SpanID(), client.Parent().SpanID())
+	assert.Equal(t, int64(http.StatusNotFound), spanAttributes(client)["http.status_code"])
+	assert.Equal(t, codes.Error, client.Status().Code)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+client.SpanContext().SpanID().String()+"-01", downstream)
+}
+
+func TestTraceClient_Error(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracing.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer tracing.SetTracerProvider(nil)
+
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	_, err := NewClient().SetRetryCount(1).R().Get(server.URL)
+	require.Error(t, err)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "retried", spans[0].Status().Description)
+	assert.Contains(t, spans[1].Status().Description, "connection refused")
+	require.Len(t, spans[1].Events(), 1)
+	assert.Equal(t, "exception", spans[1].Events()[0].Name)
+}
@@ -4,26 +4,23 @@ import "net/http"
 
 //go:generate go-doudou name --file $GOFILE -o
 
-// HttpLog wraps properties for logging http request and body
-// Example:
-//  POST /usersvc/pageusers HTTP/1.1
-//  Host: localhost:6060
-//  Content-Length: 80
-//  Content-Type: application/json
-//  User-Agent: go-resty/2.6.0 (https://github.com/go-resty/resty)
-//  X-Request-Id: d1e4dc83-18be-493e-be5b-2e0faaca90ec
-//
-//  {"filter":{"dept":99,"name":"Jack"},"page":{"orders":null,"pageNo":2,"size":10}}
+// HttpLog wraps properties for logging http request and response by Logger middleware.
+// They are logged as fields keyed by json names, so that they can be searched in log collectors when GDD_LOG_FORMAT is json
 type HttpLog struct {
-	ClientIp          string      `json:"clientIp,omitempty"`
-	HttpMethod        string      `json:"httpMethod,omitempty"`
-	Uri               string      `json:"uri,omitempty"`
-	Proto             string      `json:"proto,omitempty"`
-	Host              string      `json:"host,omitempty"`
-	ReqContentLength  int64       `json:"reqContentLength,omitempty"`
-	ReqHeader         http.Header `json:"reqHeader,omitempty"`
-	RequestId         string      `json:"requestId,omitempty"`
+	ClientIp         string      `json:"clientIp,omitempty"`
+	HttpMethod       string      `json:"httpMethod,omitempty"`
+	Uri              string      `json:"uri,omitempty"`
+	Proto            string      `json:"proto,omitempty"`
+	Host             string      `json:"host,omitempty"`
+	ReqContentLength int64       `json:"reqContentLength,omitempty"`
+	ReqHeader        http.Header `json:"reqHeader,omitempty"`
+	RequestId        string      `json:"requestId,omitempty"`
+	// Deprecated: RawReq is no longer set by Logger middleware, use ReqHeader and ReqBody instead
 	RawReq            string      `json:"rawReq,omitempty"`
+	TraceId           string      `json:"traceId,omitempty"`
+	Route             string      `json:"route,omitempty"`
+	User              string      `json:"user,omitempty"`
+	ReqBody           string      `json:"reqBody,omitempty"`
 	RespBody          string      `json:"respBody,omitempty"`
 	StatusCode        int         `json:"statusCode,omitempty"`
 	RespHeader        http.Header `json:"respHeader,omitempty"`
@@ -17,6 +17,7 @@ import (
 // as struct field type in vo package
 // or as parameter type in method signature in svc.go file besides context.Context, multipart.FileHeader, v3.FileModel, os.File
 // when go-doudou command line flag doc is true
+// Support io.Reader, io.ReadCloser and receive channel as result type in method signature in svc.go file
 func ExprStringP(expr ast.Expr) string {
 	switch _expr := expr.(type) {
 	case *ast.Ident:
@@ -46,7 +47,13 @@ func ExprStringP(expr ast.Expr) string {
 	case *ast.FuncType:
 		panic("not support function as struct field type in vo package and as parameter in method signature in svc.go file")
 	case *ast.ChanType:
-		panic("not support channel as struct field type in vo package and as parameter in method signature in svc.go file")
+		if _expr.Dir == ast.SEND {
+			panic("not support send-only channel in svc.go file")
+		}
+		if _expr.Dir == ast.RECV {
+			return "<-chan " + ExprStringP(_expr.Value)
+		}
+		return "chan " + ExprStringP(_expr.Value)
 	default:
 		panic(fmt.Errorf("not support expression as struct field type in vo package and in method signature in svc.go file: %+v", expr))
 	}
@@ -58,7 +65,9 @@ func parseSelectorExpr(expr *ast.SelectorExpr) string {
 		result != "context.Context" &&
 		result != "v3.FileModel" &&
 		result != "multipart.FileHeader" &&
-		result != "os.File" {
+		result != "os.File" &&
+		result != "io.Reader" &&
+		result != "io.ReadCloser" {
 		panic(fmt.Errorf("not support %s in svc.go file and vo package", result))
 	}
 	return result
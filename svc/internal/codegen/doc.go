@@ -54,6 +54,23 @@ func schemasOf(vofile string) []v3.Schema {
 	return ret
 }
 
+// bearerAuth is name of security scheme for apis declaring @role annotation or BearerAuth middleware
+const bearerAuth = "bearerAuth"
+
+// bearerSecured reports whether method requires bearer token by @role annotation,
+// or by @middleware annotation of BearerAuth such as ddhttp.BearerAuth
+func bearerSecured(comments []string) bool {
+	if len(roles(comments)) > 0 {
+		return true
+	}
+	for _, item := range middlewares(comments) {
+		if item == "BearerAuth" || strings.HasSuffix(item, ".BearerAuth") {
+			return true
+		}
+	}
+	return false
+}
+
 const (
 	get    = "GET"
 	post   = "POST"
@@ -65,7 +82,20 @@ func operationOf(method astutils.MethodMeta, httpMethod string) v3.Operation {
 	var ret v3.Operation
 	var params []v3.Parameter
 
-	ret.Description = strings.Join(method.Comments, "\n")
+	var comments []string
+	for _, comment := range method.Comments {
+		if !annotationRe.MatchString(strings.TrimSpace(comment)) {
+			comments = append(comments, comment)
+		}
+	}
+	ret.Description = strings.Join(comments, "\n")
+	if bearerSecured(method.Comments) {
+		ret.Security = []v3.Security{
+			{
+				bearerAuth: []string{},
+			},
+		}
+	}
 
 	// If http method is "POST" and each parameters' type is one of v3.Int, v3.Int64, v3.Bool, v3.String, v3.Float32, v3.Float64,
 	// then we use application/x-www-form-urlencoded as Content-type and we make one ref schema from them as request body.
@@ -136,14 +166,28 @@ func response(method astutils.MethodMeta) *v3.Responses {
 	var respContent v3.Content
 	var hasFile bool
 	var fileDoc string
-	for _, item := range method.Results {
-		if item.Type == "*os.File" {
+	var events *astutils.FieldMeta
+	for i, item := range method.Results {
+		if item.Type == "*os.File" || isReader(item.Type) {
 			hasFile = true
 			fileDoc = strings.Join(item.Comments, "\n")
 			break
 		}
+		if isChan(item.Type) {
+			events = &method.Results[i]
+			break
+		}
 	}
-	if hasFile {
+	if events != nil {
+		// each event carries an element of the channel as json
+		eschema := v3.CopySchema(astutils.FieldMeta{
+			Type: chanElem(events.Type),
+		})
+		eschema.Description = strings.Join(events.Comments, "\n")
+		respContent.EventStream = &v3.MediaType{
+			Schema: &eschema,
+		}
+	} else if hasFile {
 		respContent.Stream = &v3.MediaType{
 			Schema: &v3.Schema{
 				Type:        v3.StringT,
@@ -340,6 +384,18 @@ func GenDoc(dir string, ic astutils.InterfaceCollector, routePatternStrategy int
 			Schemas: v3.Schemas,
 		},
 	}
+	for _, method := range ic.Interfaces[0].Methods {
+		if bearerSecured(method.Comments) {
+			api.Components.SecuritySchemes = map[string]v3.SecurityScheme{
+				bearerAuth: {
+					Type:         v3.HTTPSecurity,
+					Scheme:       "bearer",
+					BearerFormat: "JWT",
+				},
+			}
+			break
+		}
+	}
 	data, err = json.Marshal(api)
 	err = ioutil.WriteFile(docfile, data, os.ModePerm)
 	if err != nil {
@@ -1,6 +1,7 @@
 package codegen
 
 import (
+	"github.com/stretchr/testify/assert"
 	"github.com/unionj-cloud/go-doudou/astutils"
 	v3 "github.com/unionj-cloud/go-doudou/openapi/v3"
 	"github.com/unionj-cloud/go-doudou/pathutils"
@@ -105,3 +106,41 @@ func Test_schemasOf(t *testing.T) {
 		})
 	}
 }
+
+func Test_operationOfSecurity(t *testing.T) {
+	method := astutils.MethodMeta{
+		Name: "GetUser",
+		Params: []astutils.FieldMeta{
+			{
+				Name: "ctx",
+				Type: "context.Context",
+			},
+			{
+				Name: "userId",
+				Type: "string",
+			},
+		},
+		Results: []astutils.FieldMeta{
+			{
+				Name: "data",
+				Type: "string",
+			},
+			{
+				Name: "err",
+				Type: "error",
+			},
+		},
+		Comments: []string{"GetUser returns user", "@role(admin)"},
+	}
+	op := operationOf(method, get)
+	assert.Equal(t, "GetUser returns user", op.Description)
+	assert.Equal(t, []v3.Security{{bearerAuth: []string{}}}, op.Security)
+
+	method.Comments = []string{"GetUser returns user", "@middleware(ddhttp.BearerAuth, RateLimit)"}
+	op = operationOf(method, get)
+	assert.Equal(t, []v3.Security{{bearerAuth: []string{}}}, op.Security)
+
+	method.Comments = []string{"GetUser returns user", "@middleware(BasicAuth)"}
+	op = operationOf(method, get)
+	assert.Empty(t, op.Security)
+}
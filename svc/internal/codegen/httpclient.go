@@ -26,6 +26,7 @@ import (
 	ddhttp "github.com/unionj-cloud/go-doudou/svc/http"
 	v3 "github.com/unionj-cloud/go-doudou/openapi/v3"
 	"io"
+	"io/ioutil"
 	"mime/multipart"
 	"net/url"
 	"os"
@@ -35,8 +36,10 @@ import (
 )
 
 type {{.Meta.Name}}Client struct {
-	provider ddhttp.IServiceProvider
-	client   *resty.Client
+	provider     ddhttp.IServiceProvider
+	client       *resty.Client
+	streamClient *resty.Client
+	tokenSource  ddhttp.TokenSource
 }
 
 func (receiver *{{.Meta.Name}}Client) SetProvider(provider ddhttp.IServiceProvider) {
@@ -47,6 +50,14 @@ func (receiver *{{.Meta.Name}}Client) SetClient(client *resty.Client) {
 	receiver.client = client
 }
 
+func (receiver *{{.Meta.Name}}Client) SetStreamClient(client *resty.Client) {
+	receiver.streamClient = client
+}
+
+func (receiver *{{.Meta.Name}}Client) SetTokenSource(ts ddhttp.TokenSource) {
+	receiver.tokenSource = ts
+}
+
 {{- range $m := .Meta.Methods }}
 	func (receiver *{{$.Meta.Name}}Client) {{$m.Name}}({{- range $i, $p := $m.Params}}
     {{- if $i}},{{end}}
@@ -59,7 +70,8 @@ func (receiver *{{.Meta.Name}}Client) SetClient(client *resty.Client) {
 			_server string
 			_err error
 		)
-		if _server, _err = receiver.provider.SelectServer(); _err != nil {
+		{{- $ctx := ctxParam $m.Params }}
+		if _server, _err = ddhttp.SelectServer({{ if $ctx }}{{ $ctx }}{{ else }}context.Background(){{ end }}, receiver.provider); _err != nil {
 			{{- range $r := $m.Results }}
 				{{- if eq $r.Type "error" }}
 					{{ $r.Name }} = errors.Wrap(_err, "")
@@ -68,7 +80,26 @@ func (receiver *{{.Meta.Name}}Client) SetClient(client *resty.Client) {
 			return
 		}
 		_urlValues := url.Values{}
+		{{- $stream := false }}
+		{{- range $r := $m.Results }}
+			{{- if or (isReader $r.Type) (isChan $r.Type) }}
+				{{- $stream = true }}
+			{{- end }}
+		{{- end }}
+		{{- if $stream }}
+		// response body is streamed, so the request is sent by the client without overall timeout
+		_req := receiver.streamClient.R()
+		{{- else }}
 		_req := receiver.client.R()
+		{{- end }}
+		if _err = ddhttp.SetBearerToken(_req, receiver.tokenSource); _err != nil {
+			{{- range $r := $m.Results }}
+				{{- if eq $r.Type "error" }}
+					{{ $r.Name }} = errors.Wrap(_err, "")
+				{{- end }}
+			{{- end }}
+			return
+		}
 		{{- range $p := $m.Params }}
 		{{- if contains $p.Type "*multipart.FileHeader" }}
 		{{- if contains $p.Type "["}}
@@ -120,6 +151,11 @@ func (receiver *{{.Meta.Name}}Client) SetClient(client *resty.Client) {
 		{{- range $r := $m.Results }}
 			{{- if eq $r.Type "*os.File" }}
 				_req.SetDoNotParseResponse(true)
+			{{- else if isReader $r.Type }}
+				_req.SetDoNotParseResponse(true)
+			{{- else if isChan $r.Type }}
+				_req.SetDoNotParseResponse(true)
+				_req.SetHeader("Accept", "text/event-stream")
 			{{- end }}
 		{{- end }}
 
@@ -149,9 +185,17 @@ func (receiver *{{.Meta.Name}}Client) SetClient(client *resty.Client) {
 			return
 		}
 		if _resp.IsError() {
+			{{- if $stream }}
+			defer _resp.RawBody().Close()
+			_body, _ := ioutil.ReadAll(_resp.RawBody())
+			{{- end }}
 			{{- range $r := $m.Results }}
 				{{- if eq $r.Type "error" }}
+					{{- if $stream }}
+					{{ $r.Name }} = errors.New(string(_body))
+					{{- else }}
 					{{ $r.Name }} = errors.New(_resp.String())
+					{{- end }}
 				{{- end }}
 			{{- end }}
 			return
@@ -197,6 +241,36 @@ func (receiver *{{.Meta.Name}}Client) SetClient(client *resty.Client) {
 				{{ $r.Name }} = _outFile
 				return
 				{{- $done = true }}	
+			{{- else if isReader $r.Type }}
+				{{ $r.Name }} = _resp.RawBody()
+				{{- range $c := $m.Results }}
+					{{- if eq $c.Type "string" }}
+						{{ $c.Name }} = _resp.Header().Get("Content-Type")
+					{{- end }}
+				{{- end }}
+				return
+				{{- $done = true }}
+			{{- else if isChan $r.Type }}
+				_events := make(chan {{ $r.Type | chanElem }})
+				go func() {
+					defer close(_events)
+					defer _resp.RawBody().Close()
+					_reader := ddhttp.NewEventReader(_resp.RawBody())
+					for {
+						var _item {{ $r.Type | chanElem }}
+						if _err := _reader.Next(&_item); _err != nil {
+							return
+						}
+						select {
+						case _events <- _item:
+						case <-_req.Context().Done():
+							return
+						}
+					}
+				}()
+				{{ $r.Name }} = _events
+				return
+				{{- $done = true }}
 			{{- end }}
 		{{- end }}
 		{{- if not $done }}
@@ -239,8 +313,9 @@ func New{{.Meta.Name}}(opts ...ddhttp.DdClientOption) *{{.Meta.Name}}Client {
 	defaultClient := ddhttp.NewClient()
 
 	svcClient := &{{.Meta.Name}}Client{
-		provider: defaultProvider,
-		client:   defaultClient,
+		provider:     defaultProvider,
+		client:       defaultClient,
+		streamClient: ddhttp.NewStreamClient(),
 	}
 
 	for _, opt := range opts {
@@ -316,6 +391,10 @@ func GenGoClient(dir string, ic astutils.InterfaceCollector, env string, routePa
 	funcMap["restyMethod"] = restyMethod
 	funcMap["toUpper"] = strings.ToUpper
 	funcMap["noSplitPattern"] = noSplitPattern
+	funcMap["isReader"] = isReader
+	funcMap["isChan"] = isChan
+	funcMap["chanElem"] = chanElem
+	funcMap["ctxParam"] = ctxParam
 	if tpl, err = template.New("client.go.tmpl").Funcs(funcMap).Parse(tmpl); err != nil {
 		panic(err)
 	}
@@ -336,3 +415,13 @@ func GenGoClient(dir string, ic astutils.InterfaceCollector, env string, routePa
 	source = strings.TrimSpace(sqlBuf.String())
 	astutils.FixImport([]byte(source), clientfile)
 }
+
+// ctxParam returns name of the context.Context parameter, or empty string if not found
+func ctxParam(params []astutils.FieldMeta) string {
+	for _, item := range params {
+		if item.Type == "context.Context" {
+			return item.Name
+		}
+	}
+	return ""
+}
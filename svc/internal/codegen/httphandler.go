@@ -6,6 +6,7 @@ import (
 	"github.com/unionj-cloud/go-doudou/stringutils"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"text/template"
 
@@ -18,6 +19,7 @@ var httpHandlerTmpl = `package httpsrv
 
 import (
 	"github.com/unionj-cloud/go-doudou/svc/config"
+	ddhttp "github.com/unionj-cloud/go-doudou/svc/http"
 	ddmodel "github.com/unionj-cloud/go-doudou/svc/http/model"
 	"net/http"
 	"os"
@@ -33,20 +35,56 @@ func Routes(handler {{.Meta.Name}}Handler) []ddmodel.Route {
 	return []ddmodel.Route{
 		{{- range $m := .Meta.Methods }}
 		{
-			"{{$m.Name | routeName}}",
-			"{{$m.Name | httpMethod}}",
+			Name:   "{{$m.Name | routeName}}",
+			Method: "{{$m.Name | httpMethod}}",
 			{{- if eq $.RoutePatternStrategy 1}}
-			"/{{$.Meta.Name | lower}}/{{$m.Name | noSplitPattern}}",
+			Pattern: "/{{$.Meta.Name | lower}}/{{$m.Name | noSplitPattern}}",
 			{{- else }}
-			"/{{$m.Name | pattern}}",
+			Pattern: "/{{$m.Name | pattern}}",
+			{{- end }}
+			HandlerFunc: handler.{{$m.Name}},
+			{{- with $m.Comments | middlewares }}
+			Middlewares: []func(http.Handler) http.Handler{ {{- join . ", " -}} },
+			{{- end }}
+			{{- with $m.Comments | roles }}
+			Roles: []string{ {{- range $i, $r := . }}{{if $i}}, {{end}}"{{$r}}"{{end -}} },
 			{{- end }}
-			handler.{{$m.Name}},
 		},
 		{{- end }}
 	}
 }
 `
 
+var annotationRe = regexp.MustCompile(`^@(\w+)\((.*)\)$`)
+
+// annotations returns values of annotations named by name from method comments in svc.go file.
+// Example: // @middleware(Auth, RateLimit)
+func annotations(comments []string, name string) []string {
+	var values []string
+	for _, comment := range comments {
+		matches := annotationRe.FindStringSubmatch(strings.TrimSpace(comment))
+		if len(matches) == 0 || matches[1] != name {
+			continue
+		}
+		for _, item := range strings.Split(matches[2], ",") {
+			if item = strings.TrimSpace(item); stringutils.IsNotEmpty(item) {
+				values = append(values, item)
+			}
+		}
+	}
+	return values
+}
+
+// middlewares returns middleware function names declared by @middleware annotations
+func middlewares(comments []string) []string {
+	return annotations(comments, "middleware")
+}
+
+// roles returns roles declared by @role annotations
+func roles(comments []string) []string {
+	return annotations(comments, "role")
+}
+
 func pattern(method string) string {
 	httpMethods := []string{"GET", "POST", "PUT", "DELETE"}
 	snake := strcase.ToSnake(method)
@@ -136,6 +174,9 @@ func GenHttpHandler(dir string, ic astutils.InterfaceCollector, routePatternStra
 	funcMap["pattern"] = pattern
 	funcMap["noSplitPattern"] = noSplitPattern
 	funcMap["lower"] = strings.ToLower
+	funcMap["middlewares"] = middlewares
+	funcMap["roles"] = roles
+	funcMap["join"] = strings.Join
 	if tpl, err = template.New("handler.go.tmpl").Funcs(funcMap).Parse(httpHandlerTmpl); err != nil {
 		panic(err)
 	}
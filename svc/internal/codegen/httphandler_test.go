@@ -3,9 +3,11 @@ package codegen
 import (
 	"fmt"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/unionj-cloud/go-doudou/astutils"
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"testing"
 )
 
@@ -103,10 +105,10 @@ type TestdatahttphandlerHandler interface {
 func Routes(handler TestdatahttphandlerHandler) []ddmodel.Route {
 	return []ddmodel.Route{
 		{
-			"PageUsers",
-			"POST",
-			"/testdatahttphandler/pageusers",
-			handler.PageUsers,
+			Name:        "PageUsers",
+			Method:      "POST",
+			Pattern:     "/testdatahttphandler/pageusers",
+			HandlerFunc: handler.PageUsers,
 		},
 	}
 }
@@ -125,3 +127,109 @@ func Routes(handler TestdatahttphandlerHandler) []ddmodel.Route {
 	}
 	assert.Equal(t, expect, string(content))
 }
+
+func TestGenHttpHandlerQualifiedMiddleware(t *testing.T) {
+	dir := testDir + "httphandlerqualified"
+	InitSvc(dir)
+	defer os.RemoveAll(dir)
+	svcfile := dir + "/svc.go"
+	source := `package service
+
+import (
+	"context"
+	"testdatahttphandlerqualified/vo"
+)
+
+type Testdatahttphandlerqualified interface {
+	// PageUsers pages users
+	// @middleware(ddhttp.BearerAuth)
+	// @role(admin)
+	PageUsers(ctx context.Context, query vo.PageQuery) (code int, data vo.PageRet, err error)
+}
+`
+	require.NoError(t, ioutil.WriteFile(svcfile, []byte(source), os.ModePerm))
+	ic := astutils.BuildInterfaceCollector(svcfile, astutils.ExprString)
+	GenHttpHandler(dir, ic, 0)
+	content, err := ioutil.ReadFile(dir + "/transport/httpsrv/handler.go")
+	require.NoError(t, err)
+	assert.Contains(t, string(content), `ddhttp "github.com/unionj-cloud/go-doudou/svc/http"`)
+	assert.Contains(t, string(content), `Middlewares: []func(http.Handler) http.Handler{ddhttp.BearerAuth},`)
+
+	// generated project requires released go-doudou, so build the handler inside this module instead
+	pkgDir := testDir + "httphandlercompile"
+	require.NoError(t, os.MkdirAll(pkgDir, os.ModePerm))
+	defer os.RemoveAll(pkgDir)
+	require.NoError(t, ioutil.WriteFile(pkgDir+"/handler.go", content, os.ModePerm))
+	cmd := exec.Command("go", "build", ".")
+	cmd.Dir = pkgDir
+	out, err := cmd.CombinedOutput()
+	assert.NoError(t, err, string(out))
+}
+
+func Test_annotations(t *testing.T) {
+	comments := []string{
+		"comment1",
+		"@middleware(Auth, RateLimit)",
+		"@middleware(Cache)",
+		"@role(admin)",
+	}
+	assert.Equal(t, []string{"Auth", "RateLimit", "Cache"}, middlewares(comments))
+	assert.Equal(t, []string{"admin"}, roles(comments))
+	assert.Nil(t, annotations(comments, "unknown"))
+}
+
+func TestGenHttpHandlerWithAnnotations(t *testing.T) {
+	dir := testDir + "httphandlerannotations"
+	InitSvc(dir)
+	defer os.RemoveAll(dir)
+	svcfile := dir + "/svc.go"
+	source := `package service
+
+import (
+	"context"
+	"testdatahttphandlerannotations/vo"
+)
+
+type Testdatahttphandlerannotations interface {
+	// PageUsers pages users
+	// @middleware(Auth, RateLimit)
+	// @role(admin, user)
+	PageUsers(ctx context.Context, query vo.PageQuery) (code int, data vo.PageRet, err error)
+}
+`
+	if err := ioutil.WriteFile(svcfile, []byte(source), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	ic := astutils.BuildInterfaceCollector(svcfile, astutils.ExprString)
+	GenHttpHandler(dir, ic, 0)
+	expect := `package httpsrv
+
+import (
+	"net/http"
+
+	ddmodel "github.com/unionj-cloud/go-doudou/svc/http/model"
+)
+
+type TestdatahttphandlerannotationsHandler interface {
+	PageUsers(w http.ResponseWriter, r *http.Request)
+}
+
+func Routes(handler TestdatahttphandlerannotationsHandler) []ddmodel.Route {
+	return []ddmodel.Route{
+		{
+			Name:        "PageUsers",
+			Method:      "POST",
+			Pattern:     "/page/users",
+			HandlerFunc: handler.PageUsers,
+			Middlewares: []func(http.Handler) http.Handler{Auth, RateLimit},
+			Roles:       []string{"admin", "user"},
+		},
+	}
+}
+`
+	content, err := ioutil.ReadFile(dir + "/transport/httpsrv/handler.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, expect, string(content))
+}
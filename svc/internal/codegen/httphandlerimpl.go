@@ -241,6 +241,17 @@ var appendHttpHandlerImplTmpl = `
 		{{- range $r := $m.Results }}
 			{{- if eq $r.Type "error" }}
 				if {{ $r.Name }} != nil {
+					{{- range $c := $m.Results }}
+					{{- if eq $c.Type "*os.File" }}
+					if {{$c.Name}} != nil {
+						{{$c.Name}}.Close()
+					}
+					{{- else if isReader $c.Type }}
+					if _closer, _ok := {{$c.Name}}.(io.Closer); _ok {
+						_closer.Close()
+					}
+					{{- end }}
+					{{- end }}
 					if errors.Is({{ $r.Name }}, context.Canceled) {
 						http.Error(_writer, {{ $r.Name }}.Error(), http.StatusBadRequest)
 					} else {
@@ -268,6 +279,48 @@ var appendHttpHandlerImplTmpl = `
 				_writer.Header().Set("Content-Length", fmt.Sprintf("%d", _fi.Size()))
 				io.Copy(_writer, {{$r.Name}})
 				{{- $done = true }}	
+			{{- else if isReader $r.Type }}
+				if {{$r.Name}} == nil {
+					http.Error(_writer, "No stream returned", http.StatusInternalServerError)
+					return
+				}
+				ddhttp.ClearWriteDeadline(_req)
+				if _err := ddhttp.WriteStream(_writer, {{$r.Name}}, {{ $m.Results | contentType }}); _err != nil {
+					logrus.Errorln(_err)
+				}
+				{{- $done = true }}
+			{{- else if isChan $r.Type }}
+				ddhttp.ClearWriteDeadline(_req)
+				_events, _err := ddhttp.NewEventWriter(_writer)
+				if _err != nil {
+					http.Error(_writer, _err.Error(), http.StatusInternalServerError)
+					return
+				}
+				if {{$r.Name}} == nil {
+					return
+				}
+				_keepalive := time.NewTicker(ddhttp.EventKeepAlive)
+				defer _keepalive.Stop()
+				for {
+					select {
+					case <-_req.Context().Done():
+						return
+					case <-_keepalive.C:
+						if _err = _events.KeepAlive(); _err != nil {
+							logrus.Errorln(_err)
+							return
+						}
+					case _item, _ok := <-{{$r.Name}}:
+						if !_ok {
+							return
+						}
+						if _err = _events.Send(_item); _err != nil {
+							logrus.Errorln(_err)
+							return
+						}
+					}
+				}
+				{{- $done = true }}
 			{{- end }}
 		{{- end }}
 		{{- if not $done }}
@@ -304,6 +357,7 @@ import (
 	"net/http"
 	"{{.VoPackage}}"
 	"github.com/pkg/errors"
+	ddhttp "github.com/unionj-cloud/go-doudou/svc/http"
 )
 
 type {{.Meta.Name}}HandlerImpl struct{
@@ -347,6 +401,32 @@ func castFunc(t string) string {
 	return castFuncMap[t]
 }
 
+// isReader reports whether t is a result type streamed to client as response body
+func isReader(t string) bool {
+	return t == "io.Reader" || t == "io.ReadCloser"
+}
+
+// isChan reports whether t is a result type sent to client as Server-Sent Events
+func isChan(t string) bool {
+	return strings.HasPrefix(t, "<-chan ") || strings.HasPrefix(t, "chan ")
+}
+
+// chanElem returns element type of channel type t
+func chanElem(t string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(t, "<-chan "), "chan ")
+}
+
+// contentType returns name of the string result as content type of streamed response body,
+// or empty string literal if not found
+func contentType(results []astutils.FieldMeta) string {
+	for _, item := range results {
+		if item.Type == "string" {
+			return item.Name
+		}
+	}
+	return `""`
+}
+
 // GenHttpHandlerImplWithImpl generates http handler implementation
 // Parsed value from query string parameters or application/x-www-form-urlencoded form will be string type.
 // You may need to convert the type by yourself.
@@ -416,6 +496,9 @@ func GenHttpHandlerImplWithImpl(dir string, ic astutils.InterfaceCollector, omit
 	funcMap["isSupport"] = isSupport
 	funcMap["castFunc"] = castFunc
 	funcMap["convertCase"] = caseconvertor
+	funcMap["isReader"] = isReader
+	funcMap["isChan"] = isChan
+	funcMap["contentType"] = contentType
 	if tpl, err = template.New("handlerimpl.go.tmpl").Funcs(funcMap).Parse(tmpl); err != nil {
 		panic(err)
 	}
@@ -2,10 +2,13 @@ package codegen
 
 import (
 	"github.com/iancoleman/strcase"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/unionj-cloud/go-doudou/astutils"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -171,3 +174,36 @@ func TestGenHttpHandlerImplWithImpl2(t *testing.T) {
 		})
 	}
 }
+
+func TestGenHttpHandlerImplWithImplStream(t *testing.T) {
+	dir := testDir + "handlerImplStream"
+	InitSvc(dir)
+	defer os.RemoveAll(dir)
+	svcfile := filepath.Join(dir, "svc.go")
+	source := `package service
+
+import (
+	"context"
+	"io"
+)
+
+type TestdatahandlerImplStream interface {
+	GetExport(ctx context.Context, name string) (file io.ReadCloser, contentType string, err error)
+	GetEvents(ctx context.Context) (events <-chan string, err error)
+}
+`
+	require.NoError(t, ioutil.WriteFile(svcfile, []byte(source), os.ModePerm))
+	ic := astutils.BuildInterfaceCollector(svcfile, astutils.ExprString)
+	GenHttpHandlerImplWithImpl(dir, ic, true, strcase.ToLowerCamel)
+	content, err := ioutil.ReadFile(filepath.Join(dir, "transport/httpsrv/handlerimpl.go"))
+	require.NoError(t, err)
+	code := string(content)
+	// reader returned with error is closed
+	assert.Contains(t, code, `if err != nil {
+		if _closer, _ok := file.(io.Closer); _ok {
+			_closer.Close()
+		}`)
+	assert.Equal(t, 2, strings.Count(code, "ddhttp.ClearWriteDeadline(_req)"))
+	assert.Contains(t, code, "_keepalive := time.NewTicker(ddhttp.EventKeepAlive)")
+	assert.Contains(t, code, "_events.KeepAlive()")
+}
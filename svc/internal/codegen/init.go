@@ -115,6 +115,25 @@ const envTmpl = `GDD_BANNER=on
 GDD_BANNER_TEXT=Go-doudou
 # GddLogLevel accept values are panic, fatal, error, warn, warning, info, debug, trace
 GDD_LOG_LEVEL=info
+# GDD_LOG_PATH if set, logs are also written to app.log under it, which is rotated by the following configs,
+# and reopened on SIGHUP
+# GDD_LOG_MAX_SIZE max megabytes before rotation, 0 disables size based rotation
+GDD_LOG_MAX_SIZE=100
+# GDD_LOG_ROTATE_INTERVAL rotates periodically, such as 24h for every midnight
+GDD_LOG_ROTATE_INTERVAL=
+# GDD_LOG_MAX_BACKUPS max number of rotated files to retain, 0 retains all
+GDD_LOG_MAX_BACKUPS=10
+# GDD_LOG_MAX_AGE max days to retain rotated files, 0 disables removal by age
+GDD_LOG_MAX_AGE=0
+# GDD_LOG_COMPRESS if true, rotated files are compressed by gzip
+GDD_LOG_COMPRESS=false
+# GDD_LOG_FORMAT accept values are text, json
+GDD_LOG_FORMAT=text
+# GDD_LOG_BODY_LIMIT max bytes of request body and response body logged by ddhttp.Logger at debug level
+GDD_LOG_BODY_LIMIT=4096
+# GDD_LOG_REDACT_HEADERS and GDD_LOG_REDACT_FIELDS are masked by ddhttp.Logger
+GDD_LOG_REDACT_HEADERS=Authorization,Proxy-Authorization,Cookie,Set-Cookie
+GDD_LOG_REDACT_FIELDS=password,secret,token
 
 DB_HOST=localhost
 DB_PORT=3306
@@ -124,10 +143,17 @@ DB_SCHEMA=test
 DB_CHARSET=utf8mb4
 DB_DRIVER=mysql
 
+# GDD_GRACE_TIMEOUT deadline of graceful shutdown, including GDD_PRESTOP_DELAY, draining requests and shutdown hooks
 GDD_GRACE_TIMEOUT=15s
+# GDD_PRESTOP_DELAY delay between failing readiness and stopping http server, so that load balancers stop sending requests
+GDD_PRESTOP_DELAY=
+# GDD_START_TIMEOUT timeout for each start hook registered by srv.OnStart
+GDD_START_TIMEOUT=30s
 GDD_WRITE_TIMEOUT=15s
 GDD_READ_TIMEOUT=15s
 GDD_IDLE_TIMEOUT=60s
+# GDD_H2C if true, http server serves HTTP/2 over cleartext tcp (h2c) besides HTTP/1.1, useful for internal traffic behind proxies
+GDD_H2C=false
 
 # GDD_ROUTE_ROOT_PATH add prefix path to all routes
 GDD_ROUTE_ROOT_PATH=
@@ -140,6 +166,36 @@ GDD_MANAGE_ENABLE=true
 GDD_MANAGE_USER=admin
 GDD_MANAGE_PASS=admin
 
+# GDD_CORS_ALLOWED_ORIGINS comma separated origins allowed by ddhttp.Cors middleware, such as https://example.com,https://*.example.com
+# * allows all origins. if empty or not set, cors is disabled
+GDD_CORS_ALLOWED_ORIGINS=
+GDD_CORS_ALLOWED_METHODS=GET,POST,PUT,PATCH,DELETE,HEAD
+# GDD_CORS_ALLOWED_HEADERS * allows all request headers
+GDD_CORS_ALLOWED_HEADERS=Origin,Accept,Content-Type,Authorization,X-Requested-With,X-Request-ID
+GDD_CORS_EXPOSED_HEADERS=
+GDD_CORS_ALLOW_CREDENTIALS=false
+# GDD_CORS_MAX_AGE how long in second browsers can cache preflight results
+GDD_CORS_MAX_AGE=600
+
+# GDD_TLS_CERT and GDD_TLS_KEY if both set, https will be served, and the certificate is sent as client certificate by ddhttp.NewClient
+GDD_TLS_CERT=
+GDD_TLS_KEY=
+# GDD_TLS_CA if set, client certificates signed by it are required (mTLS), and servers signed by it are trusted by ddhttp.NewClient
+GDD_TLS_CA=
+
+# GDD_TRACING_EXPORTER accepts none, stdout, otlp or zipkin. W3C trace context is propagated even if none
+GDD_TRACING_EXPORTER=none
+# GDD_TRACING_ENDPOINT collector url for otlp or zipkin exporter, empty means http://localhost:4318/v1/traces for otlp
+# and http://localhost:9411/api/v2/spans for zipkin
+GDD_TRACING_ENDPOINT=
+# GDD_TRACING_SAMPLE_RATIO ratio between 0 and 1 of traces to be sampled
+GDD_TRACING_SAMPLE_RATIO=1
+
+# GDD_PROMETHEUS_DURATION_BUCKETS comma separated buckets in seconds of duration histograms. prometheus default buckets if empty
+GDD_PROMETHEUS_DURATION_BUCKETS=
+# GDD_PROMETHEUS_SIZE_BUCKETS comma separated buckets in bytes of request and response size histograms
+GDD_PROMETHEUS_SIZE_BUCKETS=
+
 GDD_SERVICE_NAME={{.SvcName}}
 GDD_PORT=6060
 # GDD_MODE accept 'mono' for monolith mode or 'micro' for microservice mode
@@ -148,19 +204,69 @@ GDD_MODE=micro
 # GDD_MEM_PORT if empty or not set, an available port will be chosen randomly. recommend specifying a port
 GDD_MEM_PORT=
 GDD_MEM_SEED=localhost:56199
-# GDD_MEM_DEAD_TIMEOUT dead node will be removed from node map if not received refute messages from it in GDD_MEM_DEAD_TIMEOUT second
-GDD_MEM_DEAD_TIMEOUT=30
-# GDD_MEM_SYNC_INTERVAL local node will synchronize states from other random node every GDD_MEM_SYNC_INTERVAL second
-GDD_MEM_SYNC_INTERVAL=5
-# GDD_MEM_RECLAIM_TIMEOUT dead node will be replaced with new node with the same name but different full address in GDD_MEM_RECLAIM_TIMEOUT second
-GDD_MEM_RECLAIM_TIMEOUT=3
+# GDD_MEM_DEAD_TIMEOUT dead node will be removed from node map if not received refute messages from it in GDD_MEM_DEAD_TIMEOUT second.
+# empty means 30 for wan profile or default of the profile
+GDD_MEM_DEAD_TIMEOUT=
+# GDD_MEM_SYNC_INTERVAL local node will synchronize states from other random node every GDD_MEM_SYNC_INTERVAL second.
+# empty means 5 for wan profile or default of the profile
+GDD_MEM_SYNC_INTERVAL=
+# GDD_MEM_RECLAIM_TIMEOUT dead node will be replaced with new node with the same name but different full address in GDD_MEM_RECLAIM_TIMEOUT second.
+# empty means 3 for wan profile or default of the profile
+GDD_MEM_RECLAIM_TIMEOUT=
+# GDD_MEM_PROFILE default memberlist config, accept lan, wan or local. the following tuning options override it,
+# durations accept seconds or values such as 500ms, empty means default of the profile
+GDD_MEM_PROFILE=wan
+GDD_MEM_PROBE_INTERVAL=
+GDD_MEM_PROBE_TIMEOUT=
+GDD_MEM_SUSPICION_MULT=
+GDD_MEM_GOSSIP_INTERVAL=
+GDD_MEM_GOSSIP_NODES=
+GDD_MEM_RETRANSMIT_MULT=
+GDD_MEM_TCP_TIMEOUT=
+GDD_MEM_INDIRECT_CHECKS=
 # GDD_MEM_NAME unique name of this node in cluster. if not provided, hostname will be used instead
 GDD_MEM_NAME=
 # GDD_MEM_HOST specify AdvertiseAddr attribute of memberlist config struct.
 # if GDD_MEM_HOST starts with dot such as .seed-svc-headless.default.svc.cluster.local,
 # it will be prefixed by hostname such as seed-2.seed-svc-headless.default.svc.cluster.local
 # for supporting k8s stateful service
-GDD_MEM_HOST=`
+GDD_MEM_HOST=
+# GDD_MEM_TAGS tags of the node in format of key=value,key=value, such as zone=us-east-1a,version=v2
+GDD_MEM_TAGS=
+# GDD_MEM_SECRET base64 encoded key of 16, 24 or 32 bytes for gossip encryption, such as output of head -c 32 /dev/urandom | base64
+GDD_MEM_SECRET=
+# GDD_MEM_KEYRING comma separated base64 encoded keys for decrypting gossip messages during key rotation
+GDD_MEM_KEYRING=
+# GDD_MEM_CLUSTER cluster name, nodes of other clusters are rejected
+GDD_MEM_CLUSTER=
+# GDD_MEM_META_CODEC encoding of node meta data, accept json or msgpack. switch to msgpack after all nodes are upgraded
+GDD_MEM_META_CODEC=json
+# GDD_MEM_SUSPECT_TIMEOUT nodes not answering probes of this node within it are skipped by clients, such as 10s.
+# empty means twice the time of probing all nodes, 0 disables it
+GDD_MEM_SUSPECT_TIMEOUT=
+
+# GDD_OUTLIER_ERRORS clients stop sending requests to a node for a while after GDD_OUTLIER_ERRORS consecutive failures. 0 disables it
+GDD_OUTLIER_ERRORS=5
+# GDD_OUTLIER_LATENCY requests slower than it are counted as failures, such as 2s. empty disables it
+GDD_OUTLIER_LATENCY=
+# GDD_OUTLIER_BACKOFF duration of the first ejection of a node, doubled on each ejection in a row up to GDD_OUTLIER_MAX_BACKOFF
+GDD_OUTLIER_BACKOFF=30s
+GDD_OUTLIER_MAX_BACKOFF=5m
+# GDD_ROUTE_VERSIONS comma separated versions accepted from X-Route-Version header by ddhttp.VersionRouting, such as v1,v2.
+# empty accepts any value, so only leave it empty behind a gateway which sets or strips the header
+GDD_ROUTE_VERSIONS=
+
+# GDD_REGISTRY service registry backend, accept memberlist, file or dns
+GDD_REGISTRY=memberlist
+# GDD_REGISTRY_FILE path of yaml file of file registry
+GDD_REGISTRY_FILE=
+# GDD_REGISTRY_REFRESH interval of reloading file registry and resolving dns registry
+GDD_REGISTRY_REFRESH=10s
+# GDD_REGISTRY_DNS_NAME domain name of services for dns registry, {service} is replaced by service name,
+# such as {service}-svc-headless.default.svc.cluster.local
+GDD_REGISTRY_DNS_NAME=
+GDD_REGISTRY_DNS_PORT_NAME=
+GDD_REGISTRY_DNS_PORT=6060`
 
 const dockerfileTmpl = `FROM golang:1.16.6-alpine AS builder
 
@@ -3,7 +3,9 @@ package codegen
 import (
 	"github.com/Jeffail/gabs/v2"
 	"github.com/goccy/go-yaml"
+	"github.com/joho/godotenv"
 	"github.com/sirupsen/logrus"
+	"github.com/unionj-cloud/go-doudou/stringutils"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -33,6 +35,26 @@ spec:
             - name: http-port
               containerPort: 6060
               protocol: TCP
+          livenessProbe:
+            httpGet:
+              path: /go-doudou/health/live
+              port: http-port
+{{- if .Https}}
+              scheme: HTTPS
+{{- end}}
+            initialDelaySeconds: 10
+            periodSeconds: 10
+            failureThreshold: 3
+          readinessProbe:
+            httpGet:
+              path: /go-doudou/health/ready
+              port: http-port
+{{- if .Https}}
+              scheme: HTTPS
+{{- end}}
+            initialDelaySeconds: 5
+            periodSeconds: 5
+            failureThreshold: 2
           resources:
             requests:
               cpu: 100m
@@ -72,9 +94,11 @@ func GenK8sDeployment(dir string, svcname, image string) {
 		if err = tpl.Execute(f, struct {
 			SvcName string
 			Image   string
+			Https   bool
 		}{
 			SvcName: svcname,
 			Image:   image,
+			Https:   tlsEnabled(dir),
 		}); err != nil {
 			panic(err)
 		}
@@ -87,6 +111,16 @@ func GenK8sDeployment(dir string, svcname, image string) {
 	}
 }
 
+// tlsEnabled reports whether GDD_TLS_CERT and GDD_TLS_KEY are set in .env file of the service in dir,
+// so that probes of generated yaml are sent by https
+func tlsEnabled(dir string) bool {
+	env, err := godotenv.Read(filepath.Join(dir, ".env"))
+	if err != nil {
+		return false
+	}
+	return stringutils.IsNotEmpty(env["GDD_TLS_CERT"]) && stringutils.IsNotEmpty(env["GDD_TLS_KEY"])
+}
+
 func modifyVersion(yfile string, image string) []byte {
 	var (
 		f                             *os.File
@@ -2,7 +2,12 @@ package codegen
 
 import (
 	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/unionj-cloud/go-doudou/pathutils"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -77,3 +82,21 @@ func TestGenK8sDeployment(t *testing.T) {
 		})
 	}
 }
+
+func TestGenK8sDeploymentProbes(t *testing.T) {
+	dir := t.TempDir()
+	GenK8sDeployment(dir, "usersvc", "usersvc:v1.0.0")
+	content, err := ioutil.ReadFile(filepath.Join(dir, "usersvc_deployment.yaml"))
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "path: /go-doudou/health/live")
+	assert.Contains(t, string(content), "path: /go-doudou/health/ready")
+	assert.NotContains(t, string(content), "scheme")
+
+	dir = t.TempDir()
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, ".env"), []byte("GDD_TLS_CERT=server.crt\nGDD_TLS_KEY=server.key\n"), os.ModePerm))
+	GenK8sDeployment(dir, "usersvc", "usersvc:v1.0.0")
+	content, err = ioutil.ReadFile(filepath.Join(dir, "usersvc_deployment.yaml"))
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "port: http-port\n              scheme: HTTPS\n            initialDelaySeconds: 10")
+	assert.Contains(t, string(content), "port: http-port\n              scheme: HTTPS\n            initialDelaySeconds: 5")
+}
@@ -32,6 +32,26 @@ spec:
             - name: http-port
               containerPort: 6060
               protocol: TCP
+          livenessProbe:
+            httpGet:
+              path: /go-doudou/health/live
+              port: http-port
+{{- if .Https}}
+              scheme: HTTPS
+{{- end}}
+            initialDelaySeconds: 10
+            periodSeconds: 10
+            failureThreshold: 3
+          readinessProbe:
+            httpGet:
+              path: /go-doudou/health/ready
+              port: http-port
+{{- if .Https}}
+              scheme: HTTPS
+{{- end}}
+            initialDelaySeconds: 5
+            periodSeconds: 5
+            failureThreshold: 2
           resources:
             requests:
               cpu: 100m
@@ -70,9 +90,11 @@ func GenK8sStatefulset(dir string, svcname, image string) {
 		if err = tpl.Execute(f, struct {
 			SvcName string
 			Image   string
+			Https   bool
 		}{
 			SvcName: svcname,
 			Image:   image,
+			Https:   tlsEnabled(dir),
 		}); err != nil {
 			panic(err)
 		}
@@ -1,7 +1,13 @@
 package codegen
 
 import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/unionj-cloud/go-doudou/pathutils"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -30,3 +36,20 @@ func TestGenK8sStatefulset(t *testing.T) {
 		})
 	}
 }
+
+func TestGenK8sStatefulsetProbes(t *testing.T) {
+	dir := t.TempDir()
+	GenK8sStatefulset(dir, "usersvc", "usersvc:v1.0.0")
+	content, err := ioutil.ReadFile(filepath.Join(dir, "usersvc_statefulset.yaml"))
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "livenessProbe")
+	assert.Contains(t, string(content), "readinessProbe")
+	assert.NotContains(t, string(content), "scheme")
+
+	dir = t.TempDir()
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, ".env"), []byte("GDD_TLS_CERT=server.crt\nGDD_TLS_KEY=server.key\n"), os.ModePerm))
+	GenK8sStatefulset(dir, "usersvc", "usersvc:v1.0.0")
+	content, err = ioutil.ReadFile(filepath.Join(dir, "usersvc_statefulset.yaml"))
+	require.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(string(content), "scheme: HTTPS"))
+}
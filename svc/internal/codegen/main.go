@@ -29,35 +29,28 @@ import (
 func main() {
 	ddconfig.InitEnv()
 	conf := config.LoadFromEnv()
+	// register your own resources by srv.OnStart and srv.OnShutdown, srv.Run will manage them
+	srv := ddhttp.NewDefaultHttpSrv()
+
 	conn, err := db.NewDb(conf.DbConf)
 	if err != nil {
 		panic(err)
 	}
-	defer func() {
-		if conn == nil {
-			return
-		}
-		if err := conn.Close(); err == nil {
-			logrus.Infoln("Database connection is closed")
-		} else {
-			logrus.Warnln("Failed to close database connection")
-		}
-	}()
+	srv.OnShutdown(ddhttp.Closer("Database connection", conn))
+	ddhttp.RegisterHealthCheck("db", conn.PingContext)
 
 	if ddconfig.GddMode.Load() == "micro" {
-		node, err := registry.NewNode()
+		reg, err := registry.NewRegistry(registry.WithLifecycle(srv))
 		if err != nil {
 			logrus.Panicln(fmt.Sprintf("%+v", err))
 		}
-		defer node.Shutdown()
-		logrus.Infof("Memberlist created. Local node is %s\n", node)
+		logrus.Infof("Registry created. %s\n", reg)
 	}
 
     svc := {{.ServiceAlias}}.New{{.SvcName}}(conf, conn)
 
 	handler := httpsrv.New{{.SvcName}}Handler(svc)
-	srv := ddhttp.NewDefaultHttpSrv()
-	srv.AddMiddleware(ddhttp.Metrics, requestid.RequestIDHandler, handlers.CompressHandler, handlers.ProxyHeaders, ddhttp.Logger, ddhttp.Rest, ddhttp.Recover)
+	srv.AddMiddleware(ddhttp.Tracing, ddhttp.Metrics, ddhttp.Cors, requestid.RequestIDHandler, handlers.CompressHandler, handlers.ProxyHeaders, ddhttp.Logger, ddhttp.Rest, ddhttp.Recover)
 	srv.AddRoute(httpsrv.Routes(handler)...)
 	srv.Run()
 }
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"mime/multipart"
 	"net/url"
 	"os"
@@ -22,8 +23,10 @@ import (
 )
 
 type UsersvcClient struct {
-	provider ddhttp.IServiceProvider
-	client   *resty.Client
+	provider     ddhttp.IServiceProvider
+	client       *resty.Client
+	streamClient *resty.Client
+	tokenSource  ddhttp.TokenSource
 }
 
 func (receiver *UsersvcClient) SetProvider(provider ddhttp.IServiceProvider) {
@@ -33,17 +36,29 @@ func (receiver *UsersvcClient) SetProvider(provider ddhttp.IServiceProvider) {
 func (receiver *UsersvcClient) SetClient(client *resty.Client) {
 	receiver.client = client
 }
+
+func (receiver *UsersvcClient) SetStreamClient(client *resty.Client) {
+	receiver.streamClient = client
+}
+
+func (receiver *UsersvcClient) SetTokenSource(ts ddhttp.TokenSource) {
+	receiver.tokenSource = ts
+}
 func (receiver *UsersvcClient) PageUsers(ctx context.Context, query vo.PageQuery) (code int, data vo.PageRet, msg error) {
 	var (
 		_server string
 		_err    error
 	)
-	if _server, _err = receiver.provider.SelectServer(); _err != nil {
+	if _server, _err = ddhttp.SelectServer(ctx, receiver.provider); _err != nil {
 		msg = errors.Wrap(_err, "")
 		return
 	}
 	_urlValues := url.Values{}
 	_req := receiver.client.R()
+	if _err = ddhttp.SetBearerToken(_req, receiver.tokenSource); _err != nil {
+		msg = errors.Wrap(_err, "")
+		return
+	}
 	_req.SetContext(ctx)
 	_req.SetBody(query)
 	_path := "/usersvc/pageusers"
@@ -81,12 +96,16 @@ func (receiver *UsersvcClient) GetUser(ctx context.Context, userId string, photo
 		_server string
 		_err    error
 	)
-	if _server, _err = receiver.provider.SelectServer(); _err != nil {
+	if _server, _err = ddhttp.SelectServer(ctx, receiver.provider); _err != nil {
 		msg = errors.Wrap(_err, "")
 		return
 	}
 	_urlValues := url.Values{}
 	_req := receiver.client.R()
+	if _err = ddhttp.SetBearerToken(_req, receiver.tokenSource); _err != nil {
+		msg = errors.Wrap(_err, "")
+		return
+	}
 	_req.SetContext(ctx)
 	_urlValues.Set("userId", fmt.Sprintf("%v", userId))
 	_urlValues.Set("photo", fmt.Sprintf("%v", photo))
@@ -121,12 +140,16 @@ func (receiver *UsersvcClient) SignUp(ctx context.Context, username string, pass
 		_server string
 		_err    error
 	)
-	if _server, _err = receiver.provider.SelectServer(); _err != nil {
+	if _server, _err = ddhttp.SelectServer(ctx, receiver.provider); _err != nil {
 		msg = errors.Wrap(_err, "")
 		return
 	}
 	_urlValues := url.Values{}
 	_req := receiver.client.R()
+	if _err = ddhttp.SetBearerToken(_req, receiver.tokenSource); _err != nil {
+		msg = errors.Wrap(_err, "")
+		return
+	}
 	_req.SetContext(ctx)
 	_urlValues.Set("username", fmt.Sprintf("%v", username))
 	_urlValues.Set("password", fmt.Sprintf("%v", password))
@@ -169,12 +192,16 @@ func (receiver *UsersvcClient) UploadAvatar(pc context.Context, pf []*v3.FileMod
 		_server string
 		_err    error
 	)
-	if _server, _err = receiver.provider.SelectServer(); _err != nil {
+	if _server, _err = ddhttp.SelectServer(pc, receiver.provider); _err != nil {
 		re = errors.Wrap(_err, "")
 		return
 	}
 	_urlValues := url.Values{}
 	_req := receiver.client.R()
+	if _err = ddhttp.SetBearerToken(_req, receiver.tokenSource); _err != nil {
+		re = errors.Wrap(_err, "")
+		return
+	}
 	_req.SetContext(pc)
 	for _, _f := range pf {
 		_req.SetFileReader("pf", _f.Filename, _f.Reader)
@@ -230,12 +257,16 @@ func (receiver *UsersvcClient) DownloadAvatar(ctx context.Context, userId string
 		_server string
 		_err    error
 	)
-	if _server, _err = receiver.provider.SelectServer(); _err != nil {
+	if _server, _err = ddhttp.SelectServer(ctx, receiver.provider); _err != nil {
 		re = errors.Wrap(_err, "")
 		return
 	}
 	_urlValues := url.Values{}
 	_req := receiver.client.R()
+	if _err = ddhttp.SetBearerToken(_req, receiver.tokenSource); _err != nil {
+		re = errors.Wrap(_err, "")
+		return
+	}
 	_req.SetContext(ctx)
 	_urlValues.Set("userId", fmt.Sprintf("%v", userId))
 	_req.SetDoNotParseResponse(true)
@@ -280,14 +311,112 @@ func (receiver *UsersvcClient) DownloadAvatar(ctx context.Context, userId string
 	rf = _outFile
 	return
 }
+func (receiver *UsersvcClient) ExportUsers(ctx context.Context, format string) (data io.ReadCloser, contentType string, err error) {
+	var (
+		_server string
+		_err    error
+	)
+	if _server, _err = ddhttp.SelectServer(ctx, receiver.provider); _err != nil {
+		err = errors.Wrap(_err, "")
+		return
+	}
+	_urlValues := url.Values{}
+	// response body is streamed, so the request is sent by the client without overall timeout
+	_req := receiver.streamClient.R()
+	if _err = ddhttp.SetBearerToken(_req, receiver.tokenSource); _err != nil {
+		err = errors.Wrap(_err, "")
+		return
+	}
+	_req.SetContext(ctx)
+	_urlValues.Set("format", fmt.Sprintf("%v", format))
+	_req.SetDoNotParseResponse(true)
+	_path := "/usersvc/exportusers"
+	if _req.Body != nil {
+		_req.SetQueryParamsFromValues(_urlValues)
+	} else {
+		_req.SetFormDataFromValues(_urlValues)
+	}
+	_resp, _err := _req.Post(_server + _path)
+	if _err != nil {
+		err = errors.Wrap(_err, "")
+		return
+	}
+	if _resp.IsError() {
+		defer _resp.RawBody().Close()
+		_body, _ := ioutil.ReadAll(_resp.RawBody())
+		err = errors.New(string(_body))
+		return
+	}
+	data = _resp.RawBody()
+	contentType = _resp.Header().Get("Content-Type")
+	return
+}
+func (receiver *UsersvcClient) WatchUsers(ctx context.Context, since int64) (ru <-chan vo.UserVo, re error) {
+	var (
+		_server string
+		_err    error
+	)
+	if _server, _err = ddhttp.SelectServer(ctx, receiver.provider); _err != nil {
+		re = errors.Wrap(_err, "")
+		return
+	}
+	_urlValues := url.Values{}
+	// response body is streamed, so the request is sent by the client without overall timeout
+	_req := receiver.streamClient.R()
+	if _err = ddhttp.SetBearerToken(_req, receiver.tokenSource); _err != nil {
+		re = errors.Wrap(_err, "")
+		return
+	}
+	_req.SetContext(ctx)
+	_urlValues.Set("since", fmt.Sprintf("%v", since))
+	_req.SetDoNotParseResponse(true)
+	_req.SetHeader("Accept", "text/event-stream")
+	_path := "/usersvc/watchusers"
+	if _req.Body != nil {
+		_req.SetQueryParamsFromValues(_urlValues)
+	} else {
+		_req.SetFormDataFromValues(_urlValues)
+	}
+	_resp, _err := _req.Post(_server + _path)
+	if _err != nil {
+		re = errors.Wrap(_err, "")
+		return
+	}
+	if _resp.IsError() {
+		defer _resp.RawBody().Close()
+		_body, _ := ioutil.ReadAll(_resp.RawBody())
+		re = errors.New(string(_body))
+		return
+	}
+	_events := make(chan vo.UserVo)
+	go func() {
+		defer close(_events)
+		defer _resp.RawBody().Close()
+		_reader := ddhttp.NewEventReader(_resp.RawBody())
+		for {
+			var _item vo.UserVo
+			if _err := _reader.Next(&_item); _err != nil {
+				return
+			}
+			select {
+			case _events <- _item:
+			case <-_req.Context().Done():
+				return
+			}
+		}
+	}()
+	ru = _events
+	return
+}
 
 func NewUsersvc(opts ...ddhttp.DdClientOption) *UsersvcClient {
 	defaultProvider := ddhttp.NewServiceProvider("USERSVC")
 	defaultClient := ddhttp.NewClient()
 
 	svcClient := &UsersvcClient{
-		provider: defaultProvider,
-		client:   defaultClient,
+		provider:     defaultProvider,
+		client:       defaultClient,
+		streamClient: ddhttp.NewStreamClient(),
 	}
 
 	for _, opt := range opts {
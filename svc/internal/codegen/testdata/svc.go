@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	v3 "github.com/unionj-cloud/go-doudou/openapi/v3"
+	"io"
 	"mime/multipart"
 	"os"
 	"testdata/vo"
@@ -31,4 +32,10 @@ type Usersvc interface {
 
 	// comment5
 	DownloadAvatar(ctx context.Context, userId string) (*os.File, error)
+
+	// comment6
+	ExportUsers(ctx context.Context, format string) (data io.ReadCloser, contentType string, err error)
+
+	// comment7
+	WatchUsers(ctx context.Context, since int64) (<-chan vo.UserVo, error)
 }
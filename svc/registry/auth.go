@@ -0,0 +1,68 @@
+package registry
+
+import (
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/unionj-cloud/memberlist"
+)
+
+// Authorizer decides whether a peer is allowed to join the cluster. Returning a non-nil error rejects it
+type Authorizer func(peer *Node) error
+
+// WithAuthorizer sets Authorizer called for every peer joining the cluster, after cluster name is checked.
+// Peers carry meta data set by themselves, so combine it with gossip encryption in untrusted networks
+func WithAuthorizer(authorizer Authorizer) NodeOption {
+	return func(node *Node) {
+		node.authorizer = authorizer
+	}
+}
+
+// authDelegate rejects peers of other clusters or rejected by Authorizer of local node
+type authDelegate struct {
+	local *Node
+}
+
+func (a *authDelegate) authorize(member *memberlist.Node) error {
+	if a.local.memberConf != nil && member.Name == a.local.memberConf.Name {
+		return nil
+	}
+	mm, err := newMeta(member)
+	if err != nil {
+		return err
+	}
+	if cluster := a.local.meta().Meta.Cluster; mm.Meta.Cluster != cluster {
+		return errors.Errorf("node %s belongs to cluster %q, not %q", member.Name, mm.Meta.Cluster, cluster)
+	}
+	if a.local.authorizer == nil {
+		return nil
+	}
+	peer := &Node{
+		mmeta:      mm,
+		memberNode: member,
+		remote:     true,
+	}
+	if err = a.local.authorizer(peer); err != nil {
+		return errors.Wrapf(err, "node %s is rejected", member.Name)
+	}
+	return nil
+}
+
+// NotifyAlive rejects alive messages of unauthorized peers, so that they are not considered members
+func (a *authDelegate) NotifyAlive(peer *memberlist.Node) error {
+	if err := a.authorize(peer); err != nil {
+		logrus.Warnf("Ignore alive message: %s\n", err)
+		return err
+	}
+	return nil
+}
+
+// NotifyMerge cancels joining or being joined by a cluster containing unauthorized peers
+func (a *authDelegate) NotifyMerge(peers []*memberlist.Node) error {
+	for _, peer := range peers {
+		if err := a.authorize(peer); err != nil {
+			logrus.Warnf("Cancel merge: %s\n", err)
+			return err
+		}
+	}
+	return nil
+}
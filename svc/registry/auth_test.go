@@ -0,0 +1,107 @@
+package registry
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/svc/config"
+	"github.com/unionj-cloud/memberlist"
+	"testing"
+)
+
+func newClusterMember(t *testing.T, name, service, cluster string) *memberlist.Node {
+	meta, err := json.Marshal(mergedMeta{
+		Meta: nodeMeta{
+			Service: service,
+			Port:    6060,
+			Cluster: cluster,
+		},
+	})
+	require.NoError(t, err)
+	return &memberlist.Node{
+		Name: name,
+		Addr: name,
+		Meta: meta,
+	}
+}
+
+func Test_authDelegate(t *testing.T) {
+	local := &Node{
+		mmeta: mergedMeta{
+			Meta: nodeMeta{
+				Service: "ordersvc",
+				Cluster: "prod",
+			},
+		},
+		registry: &registry{
+			memberConf: &memberlist.Config{Name: "local"},
+		},
+		authorizer: func(peer *Node) error {
+			if peer.meta().Meta.Service == "evilsvc" {
+				return errors.New("unknown service")
+			}
+			return nil
+		},
+	}
+	a := &authDelegate{local}
+	assert.NoError(t, a.NotifyAlive(newClusterMember(t, "a", "usersvc", "prod")))
+	assert.Error(t, a.NotifyAlive(newClusterMember(t, "b", "usersvc", "dev")))
+	assert.Error(t, a.NotifyAlive(newClusterMember(t, "c", "usersvc", "")))
+	assert.Error(t, a.NotifyAlive(newClusterMember(t, "d", "evilsvc", "prod")))
+	assert.Error(t, a.NotifyAlive(&memberlist.Node{Name: "e", Meta: []byte("invalid")}))
+	// local node itself is always allowed
+	assert.NoError(t, a.NotifyAlive(&memberlist.Node{Name: "local"}))
+
+	assert.NoError(t, a.NotifyMerge([]*memberlist.Node{newClusterMember(t, "a", "usersvc", "prod")}))
+	assert.Error(t, a.NotifyMerge([]*memberlist.Node{newClusterMember(t, "a", "usersvc", "prod"), newClusterMember(t, "b", "usersvc", "dev")}))
+}
+
+func TestNewNode_Cluster(t *testing.T) {
+	defer config.GddMemCluster.Write("")
+	_ = config.GddMemSeed.Write(seed.memberNode.Address())
+	_ = config.GddServiceName.Write("testsvc_cluster")
+	_ = config.GddMemName.Write("testnode_cluster")
+	_ = config.GddMemHost.Write("")
+	_ = config.GddMemPort.Write("57299")
+	_ = config.GddPort.Write("6060")
+	_ = config.GddMemCluster.Write("other")
+	_, err := NewNode()
+	require.Error(t, err)
+	nodes, _ := seed.Discover("testsvc_cluster")
+	assert.Empty(t, nodes)
+}
+
+func TestNewNode_Encryption(t *testing.T) {
+	defer config.GddMemSecret.Write("")
+	_ = config.GddMemSeed.Write("")
+	_ = config.GddServiceName.Write("testsvc_encrypted")
+	_ = config.GddMemName.Write("testnode_encrypted1")
+	_ = config.GddMemHost.Write("")
+	_ = config.GddMemPort.Write("57399")
+	_ = config.GddPort.Write("6060")
+	_ = config.GddMemSecret.Write(key1)
+	encrypted, err := NewNode()
+	require.NoError(t, err)
+	defer encrypted.memberlist.Shutdown()
+	assert.Equal(t, []string{key1}, encrypted.Keys())
+
+	_ = config.GddMemSeed.Write(encrypted.memberNode.Address())
+	_ = config.GddMemName.Write("testnode_encrypted2")
+	_ = config.GddMemPort.Write("57499")
+	_ = config.GddMemSecret.Write(key2)
+	_, err = NewNode()
+	require.Error(t, err)
+
+	_ = config.GddMemName.Write("testnode_encrypted3")
+	_ = config.GddMemPort.Write("57599")
+	_ = config.GddMemSecret.Write(key1)
+	node, err := NewNode()
+	require.NoError(t, err)
+	defer node.memberlist.Shutdown()
+	assert.Equal(t, 2, node.NumNodes())
+
+	_ = config.GddMemSecret.Write("invalid")
+	_, err = NewNode()
+	require.Error(t, err)
+}
@@ -2,29 +2,36 @@ package registry
 
 import (
 	"encoding/json"
-	"fmt"
 	"github.com/sirupsen/logrus"
+	"github.com/unionj-cloud/go-doudou/stringutils"
 )
 
 type delegate struct {
 	local *Node
 }
 
-// NodeMeta return node meta data
+// NodeMeta return node meta data. Size of meta data is validated by NewNode and UpdateMeta,
+// so it only returns nil if limit is lower than memberlist.MetaMaxSize
 func (d *delegate) NodeMeta(limit int) []byte {
-	raw, _ := json.Marshal(d.local.mmeta)
-	if len(raw) > limit {
-		panic(fmt.Errorf("Node meta data '%v' exceeds length limit of %d bytes", d.local.mmeta, limit))
+	raw, err := checkMetaSize(d.local.meta(), d.local.metaCodec, limit)
+	if err != nil {
+		logrus.Errorf("Node meta data is dropped: %+v\n", err)
+		return nil
 	}
 	return raw
 }
 
 // NotifyMsg callback function when received message from remote node
 func (d *delegate) NotifyMsg(msg []byte) {
-	d.local.lock.Lock()
-	defer d.local.lock.Unlock()
-	// TODO
-	logrus.Info(string(msg))
+	if d.local.registry == nil || d.local.state == nil {
+		return
+	}
+	var entry StateEntry
+	if err := json.Unmarshal(msg, &entry); err != nil || stringutils.IsEmpty(entry.Topic) {
+		logrus.Warnf("Ignore unknown message: %s\n", string(msg))
+		return
+	}
+	d.local.mergeEntry(entry, true)
 }
 
 // GetBroadcasts get a number of broadcasts
@@ -36,17 +43,31 @@ func (d *delegate) GetBroadcasts(overhead, limit int) [][]byte {
 	return msgs
 }
 
-// LocalState return local state
+// LocalState return all entries of cluster state for push/pull state sync
 func (d *delegate) LocalState(join bool) []byte {
-	// TODO
-	//d.local.lock.Lock()
-	//defer d.local.lock.Unlock()
-	return nil
+	if d.local.registry == nil || d.local.state == nil {
+		return nil
+	}
+	raw, err := json.Marshal(d.local.state.snapshot())
+	if err != nil {
+		logrus.Errorf("Marshal local state failed: %v\n", err)
+		return nil
+	}
+	return raw
 }
 
-// MergeRemoteState merge remote state
+// MergeRemoteState merge entries of remote cluster state which are newer than local ones
 func (d *delegate) MergeRemoteState(s []byte, join bool) {
-	// TODO
-	//d.local.lock.Lock()
-	//defer d.local.lock.Unlock()
+	if len(s) == 0 || d.local.registry == nil || d.local.state == nil {
+		return
+	}
+	var entries []StateEntry
+	if err := json.Unmarshal(s, &entries); err != nil {
+		logrus.Warnf("Ignore invalid remote state: %v\n", err)
+		return
+	}
+	for _, entry := range entries {
+		// remote node has the entry, no need to rebroadcast
+		d.local.mergeEntry(entry, false)
+	}
 }
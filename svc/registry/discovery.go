@@ -0,0 +1,310 @@
+package registry
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/unionj-cloud/go-doudou/stringutils"
+	"github.com/unionj-cloud/memberlist"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// EventType is type of ServiceEvent
+type EventType string
+
+const (
+	// EventJoin means a node joined the cluster
+	EventJoin EventType = "join"
+	// EventLeave means a node left the cluster or was considered dead
+	EventLeave EventType = "leave"
+	// EventUpdate means meta data of a node changed
+	EventUpdate EventType = "update"
+)
+
+// watchBufferSize is capacity of channels returned by Watch
+const watchBufferSize = 64
+
+// ServiceEvent notifies changes of nodes supplying a service
+type ServiceEvent struct {
+	Type    EventType
+	Service string
+	// Node is the node joined, left or updated
+	Node *Node
+	// Nodes are all nodes supplying the service after the change
+	Nodes []*Node
+}
+
+type watcher struct {
+	svc  string
+	lock sync.Mutex
+	ch   chan ServiceEvent
+	done bool
+}
+
+// send delivers event without blocking. The oldest event is dropped if the consumer falls behind,
+// which is fine as every event carries all nodes of the service
+func (w *watcher) send(event ServiceEvent) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.done {
+		return
+	}
+	for {
+		select {
+		case w.ch <- event:
+			return
+		default:
+		}
+		select {
+		case <-w.ch:
+			logrus.Warnf("Watcher of service %s falls behind, oldest event dropped\n", w.svc)
+		default:
+		}
+	}
+}
+
+func (w *watcher) stop() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if !w.done {
+		w.done = true
+		close(w.ch)
+	}
+}
+
+// serviceCache indexes nodes by service. It is updated by eventDelegate, so that discovery doesn't need
+// to decode meta data of all members on every call
+type serviceCache struct {
+	lock     sync.RWMutex
+	services map[string]map[string]*Node
+	// owners maps node name to service, for removing nodes whose meta data is unavailable
+	owners    map[string]string
+	watchLock sync.RWMutex
+	watchers  map[*watcher]struct{}
+	// state is cluster state carrying data of nodes too large for meta data
+	state *clusterState
+	// probes records probes of local node, shared by nodes for telling whether they are suspect
+	probes *probeTracker
+}
+
+func newServiceCache() *serviceCache {
+	return &serviceCache{
+		services: make(map[string]map[string]*Node),
+		owners:   make(map[string]string),
+		watchers: make(map[*watcher]struct{}),
+	}
+}
+
+// nodesOf returns nodes of svc sorted by name, caller must hold the lock
+func (c *serviceCache) nodesOf(svc string) []*Node {
+	nodes := make([]*Node, 0, len(c.services[svc]))
+	for _, node := range c.services[svc] {
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].memberNode.Name < nodes[j].memberNode.Name
+	})
+	return nodes
+}
+
+// discover returns nodes of svc, or all nodes if svc is empty
+func (c *serviceCache) discover(svc string) []*Node {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if stringutils.IsNotEmpty(svc) {
+		return c.nodesOf(svc)
+	}
+	services := make([]string, 0, len(c.services))
+	for service := range c.services {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+	var nodes []*Node
+	for _, service := range services {
+		nodes = append(nodes, c.nodesOf(service)...)
+	}
+	return nodes
+}
+
+// known reports whether node of name is in the index
+func (c *serviceCache) known(name string) bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	_, ok := c.owners[name]
+	return ok
+}
+
+// removeLocked removes node by name, caller must hold the lock
+func (c *serviceCache) removeLocked(name string) (*Node, string) {
+	svc, ok := c.owners[name]
+	if !ok {
+		return nil, ""
+	}
+	delete(c.owners, name)
+	node := c.services[svc][name]
+	delete(c.services[svc], name)
+	if len(c.services[svc]) == 0 {
+		delete(c.services, svc)
+	}
+	return node, svc
+}
+
+// upsert stores member as a node. A new Node is created for every change, so that nodes returned by
+// previous discovery stay unchanged
+func (c *serviceCache) upsert(member *memberlist.Node, eventType EventType) {
+	mm, err := newMeta(member)
+	if err != nil {
+		// invalid meta data is logged by eventDelegate
+		c.remove(member)
+		return
+	}
+	node := &Node{
+		mmeta:      mm,
+		memberNode: member,
+		remote:     true,
+		dataState:  c.state,
+		probes:     c.probes,
+	}
+	svc := mm.Meta.Service
+	var events []ServiceEvent
+	c.lock.Lock()
+	if old, ok := c.owners[member.Name]; ok && old != svc {
+		removed, _ := c.removeLocked(member.Name)
+		events = append(events, ServiceEvent{
+			Type:    EventLeave,
+			Service: old,
+			Node:    removed,
+			Nodes:   c.nodesOf(old),
+		})
+	}
+	if _, ok := c.services[svc][member.Name]; !ok {
+		eventType = EventJoin
+	}
+	if c.services[svc] == nil {
+		c.services[svc] = make(map[string]*Node)
+	}
+	c.services[svc][member.Name] = node
+	c.owners[member.Name] = svc
+	events = append(events, ServiceEvent{
+		Type:    eventType,
+		Service: svc,
+		Node:    node,
+		Nodes:   c.nodesOf(svc),
+	})
+	c.lock.Unlock()
+	for _, event := range events {
+		c.notify(event)
+	}
+}
+
+func (c *serviceCache) remove(member *memberlist.Node) {
+	c.lock.Lock()
+	node, svc := c.removeLocked(member.Name)
+	var nodes []*Node
+	if node != nil {
+		nodes = c.nodesOf(svc)
+	}
+	c.lock.Unlock()
+	if node == nil {
+		return
+	}
+	c.notify(ServiceEvent{
+		Type:    EventLeave,
+		Service: svc,
+		Node:    node,
+		Nodes:   nodes,
+	})
+}
+
+// set replaces nodes of svc, for registries which resolve all nodes of a service at once.
+// Nodes are identified by name, and events are sent for nodes joined, left or changed
+func (c *serviceCache) set(svc string, nodes []*Node) {
+	var events []ServiceEvent
+	c.lock.Lock()
+	old := c.services[svc]
+	current := make(map[string]*Node, len(nodes))
+	for _, node := range nodes {
+		current[node.memberNode.Name] = node
+	}
+	if len(current) == 0 {
+		delete(c.services, svc)
+	} else {
+		c.services[svc] = current
+	}
+	for name, node := range old {
+		if _, ok := current[name]; !ok {
+			events = append(events, ServiceEvent{
+				Type:    EventLeave,
+				Service: svc,
+				Node:    node,
+			})
+		}
+	}
+	for name, node := range current {
+		prev, ok := old[name]
+		switch {
+		case !ok:
+			events = append(events, ServiceEvent{
+				Type:    EventJoin,
+				Service: svc,
+				Node:    node,
+			})
+		case !reflect.DeepEqual(prev.meta().Meta, node.meta().Meta):
+			events = append(events, ServiceEvent{
+				Type:    EventUpdate,
+				Service: svc,
+				Node:    node,
+			})
+		default:
+			// keep the node unchanged, so that nodes returned by previous discovery stay the same
+			current[name] = prev
+		}
+	}
+	all := c.nodesOf(svc)
+	c.lock.Unlock()
+	for _, event := range events {
+		event.Nodes = all
+		c.notify(event)
+	}
+}
+
+func (c *serviceCache) notify(event ServiceEvent) {
+	c.watchLock.RLock()
+	defer c.watchLock.RUnlock()
+	for w := range c.watchers {
+		if stringutils.IsEmpty(w.svc) || w.svc == event.Service {
+			w.send(event)
+		}
+	}
+}
+
+func (c *serviceCache) watch(svc string) (<-chan ServiceEvent, func()) {
+	w := &watcher{
+		svc: svc,
+		ch:  make(chan ServiceEvent, watchBufferSize),
+	}
+	c.watchLock.Lock()
+	c.watchers[w] = struct{}{}
+	c.watchLock.Unlock()
+	var once sync.Once
+	return w.ch, func() {
+		once.Do(func() {
+			c.watchLock.Lock()
+			delete(c.watchers, w)
+			c.watchLock.Unlock()
+			w.stop()
+		})
+	}
+}
+
+// Watch returns a channel receiving events when nodes supplying svc join, leave or update, and a function
+// to stop watching which closes the channel. Empty svc watches all services.
+// If the consumer falls behind, the oldest events are dropped
+func (r *registry) Watch(svc string) (<-chan ServiceEvent, func()) {
+	if r.services == nil {
+		ch := make(chan ServiceEvent)
+		close(ch)
+		return ch, func() {}
+	}
+	return r.services.watch(svc)
+}
@@ -0,0 +1,97 @@
+package registry
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/memberlist"
+	"testing"
+)
+
+func newMember(t *testing.T, name, service string, weight int) *memberlist.Node {
+	meta, err := json.Marshal(mergedMeta{
+		Meta: nodeMeta{
+			Service: service,
+			Port:    6060,
+			Weight:  weight,
+		},
+	})
+	require.NoError(t, err)
+	return &memberlist.Node{
+		Name: name,
+		Addr: name,
+		Meta: meta,
+	}
+}
+
+func TestServiceCache(t *testing.T) {
+	local := &Node{
+		registry: &registry{
+			memberlist: &memberlist.Memberlist{},
+			services:   newServiceCache(),
+		},
+	}
+	e := eventDelegate{local}
+	var _ IWatcher = local
+	events, stop := local.Watch("usersvc")
+	all, stopAll := local.Watch("")
+	defer stopAll()
+
+	e.NotifyJoin(newMember(t, "b", "usersvc", 0))
+	e.NotifyJoin(newMember(t, "a", "usersvc", 0))
+	e.NotifyJoin(newMember(t, "c", "ordersvc", 0))
+	nodes, err := local.Discover("usersvc")
+	require.NoError(t, err)
+	require.Len(t, nodes, 2)
+	assert.Equal(t, "http://a:6060", nodes[0].BaseUrl())
+	nodes, _ = local.Discover("")
+	assert.Len(t, nodes, 3)
+
+	event := <-events
+	assert.Equal(t, EventJoin, event.Type)
+	assert.Equal(t, "http://b:6060", event.Node.BaseUrl())
+	event = <-events
+	assert.Len(t, event.Nodes, 2)
+
+	e.NotifyUpdate(newMember(t, "a", "usersvc", 3))
+	event = <-events
+	assert.Equal(t, EventUpdate, event.Type)
+	assert.Equal(t, 3, event.Node.Weight())
+	// nodes discovered before are not changed
+	assert.Equal(t, DefaultWeight, nodes[1].Weight())
+
+	// service of node c changed
+	e.NotifyUpdate(newMember(t, "c", "usersvc", 0))
+	event = <-events
+	assert.Equal(t, EventJoin, event.Type)
+	assert.Len(t, event.Nodes, 3)
+	nodes, _ = local.Discover("ordersvc")
+	assert.Empty(t, nodes)
+
+	e.NotifyLeave(newMember(t, "b", "usersvc", 0))
+	event = <-events
+	assert.Equal(t, EventLeave, event.Type)
+	assert.Len(t, event.Nodes, 2)
+	// invalid meta data removes the node
+	e.NotifyUpdate(&memberlist.Node{Name: "c", Meta: []byte("invalid")})
+	event = <-events
+	assert.Equal(t, EventLeave, event.Type)
+	assert.Len(t, event.Nodes, 1)
+
+	stop()
+	stop()
+	_, ok := <-events
+	assert.False(t, ok)
+
+	// slow consumers receive the latest events
+	assert.Len(t, all, 8)
+	for i := 0; i < watchBufferSize; i++ {
+		e.NotifyUpdate(newMember(t, "a", "usersvc", i+1))
+	}
+	assert.Len(t, all, watchBufferSize)
+	for i := 0; i < watchBufferSize-1; i++ {
+		<-all
+	}
+	event = <-all
+	assert.Equal(t, watchBufferSize, event.Node.Weight())
+}
@@ -0,0 +1,180 @@
+package registry
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/unionj-cloud/cast"
+	"github.com/unionj-cloud/go-doudou/stringutils"
+	"github.com/unionj-cloud/go-doudou/svc/config"
+	"net"
+	"strings"
+	"sync"
+)
+
+const (
+	defaultDnsName = "{service}"
+	defaultDnsPort = 6060
+)
+
+// DnsRegistry resolves nodes of services from DNS, such as headless services of kubernetes.
+// SRV records are looked up first, then A records with port GDD_REGISTRY_DNS_PORT if none found.
+// Services are resolved on first discovery and refreshed every GDD_REGISTRY_REFRESH
+type DnsRegistry struct {
+	refresher
+	// name is domain name template, {service} is replaced by service name
+	name     string
+	portName string
+	port     int
+	scheme   string
+	services *serviceCache
+	// lock guards tracked only, DNS lookups run without it
+	lock    sync.RWMutex
+	tracked map[string]bool
+
+	lookupSRV  func(service, proto, name string) (string, []*net.SRV, error)
+	lookupHost func(host string) ([]string, error)
+}
+
+// NewDnsRegistry creates DnsRegistry resolving domain name built from name, in which {service} is replaced
+// by service name, such as {service}-svc-headless.default.svc.cluster.local. Empty name means {service}
+func NewDnsRegistry(name string) (*DnsRegistry, error) {
+	if stringutils.IsEmpty(name) {
+		name = defaultDnsName
+	}
+	if !strings.Contains(name, "{service}") {
+		return nil, errors.Errorf("dns name %s should contain {service} placeholder", name)
+	}
+	r := &DnsRegistry{
+		name:       name,
+		portName:   config.GddRegistryDnsPortName.Load(),
+		port:       defaultDnsPort,
+		scheme:     scheme(),
+		services:   newServiceCache(),
+		tracked:    make(map[string]bool),
+		lookupSRV:  net.LookupSRV,
+		lookupHost: net.LookupHost,
+	}
+	if port := config.GddRegistryDnsPort.Load(); stringutils.IsNotEmpty(port) {
+		r.port = cast.ToInt(port)
+	}
+	r.start(refreshInterval(), r.refresh)
+	return r, nil
+}
+
+// resolve looks up nodes of svc
+func (r *DnsRegistry) resolve(svc string) ([]*Node, error) {
+	name := strings.ReplaceAll(r.name, "{service}", svc)
+	var proto string
+	if stringutils.IsNotEmpty(r.portName) {
+		proto = "tcp"
+	}
+	var nodes []*Node
+	if _, srvs, err := r.lookupSRV(r.portName, proto, name); err == nil && len(srvs) > 0 {
+		for _, srv := range srvs {
+			node, err := NewRemoteNode(svc, fmt.Sprintf("%s://%s", r.scheme, net.JoinHostPort(strings.TrimSuffix(srv.Target, "."), fmt.Sprint(srv.Port))),
+				WithWeight(int(srv.Weight)))
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, node)
+		}
+		return nodes, nil
+	}
+	addrs, err := r.lookupHost(name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "resolve %s failed", name)
+	}
+	for _, addr := range addrs {
+		node, err := NewRemoteNode(svc, fmt.Sprintf("%s://%s", r.scheme, net.JoinHostPort(addr, fmt.Sprint(r.port))))
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+// track resolves svc at the first time it is discovered or watched
+func (r *DnsRegistry) track(svc string) error {
+	r.lock.RLock()
+	tracked := r.tracked[svc]
+	r.lock.RUnlock()
+	if tracked {
+		return nil
+	}
+	nodes, err := r.resolve(svc)
+	if err != nil {
+		return err
+	}
+	r.services.set(svc, nodes)
+	r.lock.Lock()
+	r.tracked[svc] = true
+	r.lock.Unlock()
+	return nil
+}
+
+// notFound reports whether err is caused by a name which doesn't exist, such as a deleted service
+func notFound(err error) bool {
+	dnsErr, ok := errors.Cause(err).(*net.DNSError)
+	return ok && dnsErr.IsNotFound
+}
+
+// refresh resolves all tracked services. Nodes of a service are removed if its name doesn't exist any more,
+// and nodes resolved last time are kept if resolving fails temporarily
+func (r *DnsRegistry) refresh() {
+	r.lock.RLock()
+	services := make([]string, 0, len(r.tracked))
+	for svc := range r.tracked {
+		services = append(services, svc)
+	}
+	r.lock.RUnlock()
+	for _, svc := range services {
+		nodes, err := r.resolve(svc)
+		if err != nil {
+			if notFound(err) {
+				logrus.Warnf("Service %s is not found, remove its nodes: %s\n", svc, err)
+				r.services.set(svc, nil)
+				continue
+			}
+			logrus.Warnf("Refresh nodes of service %s failed: %+v\n", svc, err)
+			continue
+		}
+		r.services.set(svc, nodes)
+	}
+}
+
+// Register does nothing, nodes are registered by DNS server such as kubernetes
+func (r *DnsRegistry) Register() error {
+	return nil
+}
+
+// Discover returns nodes of svc resolved from DNS. Empty svc returns nodes of all services discovered before
+func (r *DnsRegistry) Discover(svc string) ([]*Node, error) {
+	if stringutils.IsNotEmpty(svc) {
+		if err := r.track(svc); err != nil {
+			return nil, errors.Wrap(err, "Discover() error")
+		}
+	}
+	return r.services.discover(svc), nil
+}
+
+// Watch returns a channel receiving events when nodes of svc change in DNS, and a function to stop watching.
+// Empty svc watches services discovered
+func (r *DnsRegistry) Watch(svc string) (<-chan ServiceEvent, func()) {
+	if stringutils.IsNotEmpty(svc) {
+		if err := r.track(svc); err != nil {
+			logrus.Warnf("Resolve nodes of service %s failed: %+v\n", svc, err)
+			// retry on refresh
+			r.lock.Lock()
+			r.tracked[svc] = true
+			r.lock.Unlock()
+		}
+	}
+	return r.services.watch(svc)
+}
+
+// String return string representation
+func (r *DnsRegistry) String() string {
+	return fmt.Sprintf("DNS registry resolving %s", r.name)
+}
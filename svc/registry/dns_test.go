@@ -0,0 +1,128 @@
+package registry
+
+import (
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestDnsRegistry(t *testing.T) {
+	r, err := NewDnsRegistry("{service}-svc-headless.default.svc.cluster.local")
+	require.NoError(t, err)
+	defer r.Shutdown()
+	addrs := []string{"10.0.0.1", "10.0.0.2"}
+	r.lookupSRV = func(service, proto, name string) (string, []*net.SRV, error) {
+		if name == "ordersvc-svc-headless.default.svc.cluster.local" {
+			return "", []*net.SRV{{Target: "ordersvc-0.ordersvc-svc-headless.default.svc.cluster.local.", Port: 8080, Weight: 3}}, nil
+		}
+		return "", nil, errors.New("no such host")
+	}
+	r.lookupHost = func(host string) ([]string, error) {
+		if host != "usersvc-svc-headless.default.svc.cluster.local" {
+			return nil, errors.New("no such host")
+		}
+		return addrs, nil
+	}
+
+	nodes, err := r.Discover("usersvc")
+	require.NoError(t, err)
+	require.Len(t, nodes, 2)
+	assert.Equal(t, "http://10.0.0.1:6060", nodes[0].BaseUrl())
+	assert.Equal(t, "10.0.0.2:6060", nodes[1].Address())
+
+	nodes, err = r.Discover("ordersvc")
+	require.NoError(t, err)
+	require.Len(t, nodes, 1)
+	assert.Equal(t, "http://ordersvc-0.ordersvc-svc-headless.default.svc.cluster.local:8080", nodes[0].BaseUrl())
+	assert.Equal(t, 3, nodes[0].Weight())
+
+	_, err = r.Discover("unknown")
+	assert.Error(t, err)
+
+	events, stop := r.Watch("usersvc")
+	defer stop()
+	addrs = []string{"10.0.0.2"}
+	r.refresh()
+	event := <-events
+	assert.Equal(t, EventLeave, event.Type)
+	assert.Equal(t, "http://10.0.0.1:6060", event.Node.BaseUrl())
+	assert.Len(t, event.Nodes, 1)
+
+	_, err = NewDnsRegistry("usersvc.default.svc.cluster.local")
+	assert.Error(t, err)
+}
+
+func TestDnsRegistry_SlowRefresh(t *testing.T) {
+	r, err := NewDnsRegistry("")
+	require.NoError(t, err)
+	defer r.Shutdown()
+	r.lookupSRV = func(service, proto, name string) (string, []*net.SRV, error) {
+		return "", nil, errors.New("no such host")
+	}
+	r.lookupHost = func(host string) ([]string, error) {
+		return []string{"10.0.0.1"}, nil
+	}
+	_, err = r.Discover("usersvc")
+	require.NoError(t, err)
+
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	r.lookupHost = func(host string) ([]string, error) {
+		close(entered)
+		<-release
+		return []string{"10.0.0.1"}, nil
+	}
+	go r.refresh()
+	<-entered
+	discovered := make(chan struct{})
+	go func() {
+		r.Discover("usersvc")
+		close(discovered)
+	}()
+	select {
+	case <-discovered:
+	case <-time.After(5 * time.Second):
+		t.Error("discovery is blocked by refresh")
+	}
+	close(release)
+}
+
+func TestDnsRegistry_NotFound(t *testing.T) {
+	r, err := NewDnsRegistry("")
+	require.NoError(t, err)
+	defer r.Shutdown()
+	r.lookupSRV = func(service, proto, name string) (string, []*net.SRV, error) {
+		return "", nil, errors.New("no such host")
+	}
+	r.lookupHost = func(host string) ([]string, error) {
+		return []string{"10.0.0.1"}, nil
+	}
+	nodes, err := r.Discover("usersvc")
+	require.NoError(t, err)
+	require.Len(t, nodes, 1)
+
+	// nodes are kept on temporary failures
+	r.lookupHost = func(host string) ([]string, error) {
+		return nil, &net.DNSError{Err: "server misbehaving", Name: host, IsTemporary: true}
+	}
+	r.refresh()
+	nodes, err = r.Discover("usersvc")
+	require.NoError(t, err)
+	assert.Len(t, nodes, 1)
+
+	// nodes are removed on NXDOMAIN, such as the service is deleted
+	r.lookupHost = func(host string) ([]string, error) {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	events, stop := r.Watch("usersvc")
+	defer stop()
+	r.refresh()
+	event := <-events
+	assert.Equal(t, EventLeave, event.Type)
+	assert.Empty(t, event.Nodes)
+	nodes, _ = r.Discover("usersvc")
+	assert.Empty(t, nodes)
+}
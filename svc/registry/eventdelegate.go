@@ -10,8 +10,24 @@ type eventDelegate struct {
 	local *Node
 }
 
+// indexed reports whether local node maintains service index
+func (e eventDelegate) indexed() bool {
+	return e.local != nil && e.local.registry != nil && e.local.services != nil
+}
+
+// probed reports whether local node tracks probes of other nodes
+func (e eventDelegate) probed() bool {
+	return e.local != nil && e.local.probes != nil && e.local.registry != nil && e.local.memberConf != nil
+}
+
 // NotifyJoin callback function when node joined
 func (e eventDelegate) NotifyJoin(node *memberlist.Node) {
+	if e.probed() && node.Name != e.local.memberConf.Name {
+		e.local.probes.seen(node.Name)
+	}
+	if e.indexed() {
+		e.local.services.upsert(node, EventJoin)
+	}
 	var (
 		mm  mergedMeta
 		err error
@@ -25,6 +41,15 @@ func (e eventDelegate) NotifyJoin(node *memberlist.Node) {
 
 // NotifyLeave callback function when node leave
 func (e eventDelegate) NotifyLeave(node *memberlist.Node) {
+	if e.probed() {
+		e.local.probes.forget(node.Name)
+	}
+	if e.indexed() {
+		e.local.services.remove(node)
+	}
+	if e.local != nil && e.local.registry != nil && e.local.state != nil {
+		e.local.state.remove(dataTopic(node.Name))
+	}
 	var (
 		mm  mergedMeta
 		err error
@@ -38,6 +63,9 @@ func (e eventDelegate) NotifyLeave(node *memberlist.Node) {
 
 // NotifyUpdate callback function when node updated
 func (e eventDelegate) NotifyUpdate(node *memberlist.Node) {
+	if e.indexed() {
+		e.local.services.upsert(node, EventUpdate)
+	}
 	var (
 		mm  mergedMeta
 		err error
@@ -46,5 +74,6 @@ func (e eventDelegate) NotifyUpdate(node *memberlist.Node) {
 		logrus.Errorln(fmt.Sprintf("%+v", err))
 		return
 	}
-	logrus.Infof("Node %s updated, supplying %s service", node.FullAddress(), mm.Meta.Service)
+	logrus.Infof("Node %s updated, supplying %s service, status: %s, weight: %d, tags: %v", node.FullAddress(),
+		mm.Meta.Service, mm.Meta.Status, mm.Meta.Weight, mm.Meta.Tags)
 }
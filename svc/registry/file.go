@@ -0,0 +1,138 @@
+package registry
+
+import (
+	"fmt"
+	"github.com/goccy/go-yaml"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// fileNode is a node in yaml file of FileRegistry, either a base url or an object with url, weight, status and tags
+type fileNode struct {
+	Url    string            `yaml:"url"`
+	Weight int               `yaml:"weight"`
+	Status string            `yaml:"status"`
+	Tags   map[string]string `yaml:"tags"`
+}
+
+// UnmarshalYAML accepts base url as a shorthand
+func (f *fileNode) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var baseUrl string
+	if err := unmarshal(&baseUrl); err == nil {
+		f.Url = baseUrl
+		return nil
+	}
+	type plain fileNode
+	return unmarshal((*plain)(f))
+}
+
+// FileRegistry is a static registry reading nodes of services from a yaml file, such as
+//
+//	usersvc:
+//	  - http://10.0.0.1:6060
+//	  - url: http://10.0.0.2:6060
+//	    weight: 2
+//	    tags:
+//	      zone: us-east-1a
+//
+// The file is reloaded on change. If it becomes invalid, nodes loaded last time are kept
+type FileRegistry struct {
+	refresher
+	file     string
+	services *serviceCache
+	lock     sync.Mutex
+	modTime  time.Time
+	size     int64
+	loaded   map[string]bool
+}
+
+// NewFileRegistry creates FileRegistry from file, which is reloaded every GDD_REGISTRY_REFRESH
+func NewFileRegistry(file string) (*FileRegistry, error) {
+	r := &FileRegistry{
+		file:     file,
+		services: newServiceCache(),
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	r.start(refreshInterval(), func() {
+		if err := r.load(); err != nil {
+			logrus.Errorf("Reload registry file failed: %+v\n", err)
+		}
+	})
+	return r, nil
+}
+
+// load reads the file if it changed since last load
+func (r *FileRegistry) load() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	info, err := os.Stat(r.file)
+	if err != nil {
+		return errors.Wrapf(err, "stat registry file %s failed", r.file)
+	}
+	if r.loaded != nil && info.ModTime().Equal(r.modTime) && info.Size() == r.size {
+		return nil
+	}
+	content, err := ioutil.ReadFile(r.file)
+	if err != nil {
+		return errors.Wrapf(err, "read registry file %s failed", r.file)
+	}
+	var services map[string][]fileNode
+	if err = yaml.Unmarshal(content, &services); err != nil {
+		return errors.Wrapf(err, "parse registry file %s failed", r.file)
+	}
+	all := make(map[string][]*Node, len(services))
+	for svc, fnodes := range services {
+		for _, fnode := range fnodes {
+			opts := []MetaOption{WithWeight(fnode.Weight), WithStatus(fnode.Status)}
+			for k, v := range fnode.Tags {
+				opts = append(opts, WithTag(k, v))
+			}
+			node, err := NewRemoteNode(svc, fnode.Url, opts...)
+			if err != nil {
+				return errors.Wrapf(err, "invalid node of service %s in registry file %s", svc, r.file)
+			}
+			all[svc] = append(all[svc], node)
+		}
+	}
+	for svc := range r.loaded {
+		if _, ok := all[svc]; !ok {
+			r.services.set(svc, nil)
+		}
+	}
+	loaded := make(map[string]bool, len(all))
+	for svc, nodes := range all {
+		r.services.set(svc, nodes)
+		loaded[svc] = true
+	}
+	r.loaded = loaded
+	r.modTime = info.ModTime()
+	r.size = info.Size()
+	logrus.Debugf("Registry file %s loaded\n", r.file)
+	return nil
+}
+
+// Register does nothing, nodes are registered by editing the file
+func (r *FileRegistry) Register() error {
+	return nil
+}
+
+// Discover returns nodes of svc in the file. Empty svc returns nodes of all services
+func (r *FileRegistry) Discover(svc string) ([]*Node, error) {
+	return r.services.discover(svc), nil
+}
+
+// Watch returns a channel receiving events when nodes of svc change in the file, and a function to stop watching
+func (r *FileRegistry) Watch(svc string) (<-chan ServiceEvent, func()) {
+	return r.services.watch(svc)
+}
+
+// String return string representation
+func (r *FileRegistry) String() string {
+	return fmt.Sprintf("File registry reading %s", r.file)
+}
@@ -0,0 +1,73 @@
+package registry
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileRegistry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "registry")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "registry.yaml")
+	require.NoError(t, ioutil.WriteFile(file, []byte(`
+usersvc:
+  - http://10.0.0.1:6060
+  - url: http://10.0.0.2:6060/v1
+    weight: 2
+    tags:
+      zone: a
+ordersvc:
+  - http://10.0.0.3:6060
+`), 0644))
+	r, err := NewFileRegistry(file)
+	require.NoError(t, err)
+	defer r.Shutdown()
+	var _ IWatcher = r
+
+	nodes, err := r.Discover("usersvc")
+	require.NoError(t, err)
+	require.Len(t, nodes, 2)
+	assert.Equal(t, "http://10.0.0.1:6060", nodes[0].BaseUrl())
+	assert.Equal(t, "http://10.0.0.2:6060/v1", nodes[1].BaseUrl())
+	assert.Equal(t, 2, nodes[1].Weight())
+	assert.Equal(t, "a", nodes[1].Tag(TagZone))
+	all, _ := r.Discover("")
+	assert.Len(t, all, 3)
+
+	events, stop := r.Watch("usersvc")
+	defer stop()
+	require.NoError(t, ioutil.WriteFile(file, []byte(`
+usersvc:
+  - http://10.0.0.1:6060
+  - url: http://10.0.0.4:6060
+    status: draining
+`), 0644))
+	require.NoError(t, r.load())
+	got := map[EventType]string{}
+	for i := 0; i < 2; i++ {
+		event := <-events
+		got[event.Type] = event.Node.BaseUrl()
+		assert.Len(t, event.Nodes, 2)
+	}
+	assert.Equal(t, map[EventType]string{EventLeave: "http://10.0.0.2:6060/v1", EventJoin: "http://10.0.0.4:6060"}, got)
+	// unchanged nodes stay the same
+	nodes2, _ := r.Discover("usersvc")
+	assert.Same(t, nodes[0], nodes2[0])
+	assert.Equal(t, StatusDraining, nodes2[1].Status())
+	ordersvc, _ := r.Discover("ordersvc")
+	assert.Empty(t, ordersvc)
+
+	// invalid file keeps nodes loaded last time
+	require.NoError(t, ioutil.WriteFile(file, []byte("usersvc:\n  - 10.0.0.5\n"), 0644))
+	assert.Error(t, r.load())
+	nodes, _ = r.Discover("usersvc")
+	assert.Len(t, nodes, 2)
+
+	_, err = NewFileRegistry(filepath.Join(dir, "notexist.yaml"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,126 @@
+package registry
+
+import (
+	"encoding/base64"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/unionj-cloud/go-doudou/stringutils"
+	"github.com/unionj-cloud/go-doudou/svc/config"
+	"github.com/unionj-cloud/memberlist"
+	"strings"
+)
+
+// decodeKey decodes base64 encoded key of 16, 24 or 32 bytes for AES-128, AES-192 or AES-256
+func decodeKey(key string) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(key))
+	if err != nil {
+		return nil, errors.Wrap(err, "key should be base64 encoded")
+	}
+	if err = memberlist.ValidateKey(raw); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return raw, nil
+}
+
+// parseKeys returns gossip encryption keys from GDD_MEM_SECRET and GDD_MEM_KEYRING. The first key is primary,
+// which is GDD_MEM_SECRET if set, otherwise the first key of GDD_MEM_KEYRING
+func parseKeys(secret, keyring string) ([][]byte, error) {
+	var keys [][]byte
+	if stringutils.IsNotEmpty(secret) {
+		key, err := decodeKey(secret)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid %s", config.GddMemSecret)
+		}
+		keys = append(keys, key)
+	}
+	for _, item := range strings.Split(keyring, ",") {
+		if stringutils.IsEmpty(strings.TrimSpace(item)) {
+			continue
+		}
+		key, err := decodeKey(item)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid key in %s", config.GddMemKeyring)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// setKeyring enables gossip encryption of mconf if any key is configured
+func setKeyring(mconf *memberlist.Config) error {
+	keys, err := parseKeys(config.GddMemSecret.Load(), config.GddMemKeyring.Load())
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		logrus.Warnf("Gossip encryption is disabled, set %s or %s to enable it\n", config.GddMemSecret, config.GddMemKeyring)
+		return nil
+	}
+	keyring, err := memberlist.NewKeyring(keys, keys[0])
+	if err != nil {
+		return errors.Wrap(err, "create keyring failed")
+	}
+	mconf.Keyring = keyring
+	logrus.Infof("Gossip encryption is enabled with %d keys\n", len(keyring.GetKeys()))
+	return nil
+}
+
+func (n *Node) keyring() (*memberlist.Keyring, error) {
+	if n.remote || n.registry == nil || n.memberConf == nil || n.memberConf.Keyring == nil {
+		return nil, errors.New("gossip encryption is not enabled on local node")
+	}
+	return n.memberConf.Keyring, nil
+}
+
+// InstallKey adds base64 encoded key to keyring of local node for decrypting messages. To rotate the key of
+// a cluster, install the new key on all nodes, then call UseKey on all nodes, and remove the old key at last
+func (n *Node) InstallKey(key string) error {
+	keyring, err := n.keyring()
+	if err != nil {
+		return err
+	}
+	raw, err := decodeKey(key)
+	if err != nil {
+		return err
+	}
+	return errors.WithStack(keyring.AddKey(raw))
+}
+
+// UseKey makes installed key primary, which is used for encrypting messages
+func (n *Node) UseKey(key string) error {
+	keyring, err := n.keyring()
+	if err != nil {
+		return err
+	}
+	raw, err := decodeKey(key)
+	if err != nil {
+		return err
+	}
+	return errors.WithStack(keyring.UseKey(raw))
+}
+
+// RemoveKey removes key from keyring of local node. Primary key can't be removed
+func (n *Node) RemoveKey(key string) error {
+	keyring, err := n.keyring()
+	if err != nil {
+		return err
+	}
+	raw, err := decodeKey(key)
+	if err != nil {
+		return err
+	}
+	return errors.WithStack(keyring.RemoveKey(raw))
+}
+
+// Keys returns base64 encoded keys in keyring of local node, the first one is primary
+func (n *Node) Keys() []string {
+	keyring, err := n.keyring()
+	if err != nil {
+		return nil
+	}
+	var keys []string
+	for _, key := range keyring.GetKeys() {
+		keys = append(keys, base64.StdEncoding.EncodeToString(key))
+	}
+	return keys
+}
@@ -0,0 +1,59 @@
+package registry
+
+import (
+	"encoding/base64"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/svc/config"
+	"github.com/unionj-cloud/memberlist"
+	"strings"
+	"testing"
+)
+
+var (
+	key1 = base64.StdEncoding.EncodeToString([]byte(strings.Repeat("1", 32)))
+	key2 = base64.StdEncoding.EncodeToString([]byte(strings.Repeat("2", 16)))
+)
+
+func Test_parseKeys(t *testing.T) {
+	keys, err := parseKeys(key1, " "+key2+", "+key1+",")
+	require.NoError(t, err)
+	require.Len(t, keys, 3)
+	assert.Len(t, keys[0], 32)
+	assert.Len(t, keys[1], 16)
+
+	keys, err = parseKeys("", "")
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+
+	_, err = parseKeys("not base64", "")
+	assert.Error(t, err)
+	_, err = parseKeys("", base64.StdEncoding.EncodeToString([]byte("short")))
+	assert.Error(t, err)
+}
+
+func TestNode_InstallKey(t *testing.T) {
+	defer config.GddMemKeyring.Write("")
+	config.GddMemKeyring.Write(key1)
+	mconf := memberlist.DefaultLANConfig()
+	require.NoError(t, setKeyring(mconf))
+	node := &Node{
+		registry: &registry{
+			memberConf: mconf,
+		},
+	}
+	assert.Equal(t, []string{key1}, node.Keys())
+
+	// rotate key1 to key2
+	require.Error(t, node.UseKey(key2))
+	require.NoError(t, node.InstallKey(key2))
+	assert.Equal(t, []string{key1, key2}, node.Keys())
+	require.NoError(t, node.UseKey(key2))
+	require.Error(t, node.RemoveKey(key2))
+	require.NoError(t, node.RemoveKey(key1))
+	assert.Equal(t, []string{key2}, node.Keys())
+
+	require.Error(t, node.InstallKey("invalid"))
+	require.Error(t, (&Node{registry: &registry{memberConf: memberlist.DefaultLANConfig()}}).InstallKey(key1))
+	assert.Empty(t, (&Node{remote: true}).Keys())
+}
@@ -0,0 +1,198 @@
+package registry
+
+import (
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/unionj-cloud/go-doudou/stringutils"
+	"github.com/unionj-cloud/go-doudou/svc/config"
+	"github.com/unionj-cloud/memberlist"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// StatusUp means the node accepts requests
+	StatusUp = "up"
+	// StatusDraining means the node is going to stop, so clients should not send new requests to it
+	StatusDraining = "draining"
+)
+
+const (
+	// TagZone is tag key of zone, such as availability zone of cloud providers
+	TagZone = "zone"
+	// TagVersion is tag key of version of the service, such as v2
+	TagVersion = "version"
+)
+
+// DefaultWeight is weight of nodes which didn't set it
+const DefaultWeight = 1
+
+// updateMetaTimeout is the max time waiting for meta data update message to be sent
+const updateMetaTimeout = 10 * time.Second
+
+// MetaOption changes meta data of local node
+type MetaOption func(*nodeMeta)
+
+// WithWeight sets weight for weighted load balancers. Weight must not be negative, zero means DefaultWeight
+func WithWeight(weight int) MetaOption {
+	return func(meta *nodeMeta) {
+		meta.Weight = weight
+	}
+}
+
+// WithStatus sets status such as StatusUp and StatusDraining. Clients only send requests to nodes of StatusUp
+func WithStatus(status string) MetaOption {
+	return func(meta *nodeMeta) {
+		meta.Status = status
+	}
+}
+
+// WithTag sets tag key to value, such as version, zone or canary. Empty value removes the tag
+func WithTag(key, value string) MetaOption {
+	return func(meta *nodeMeta) {
+		if stringutils.IsEmpty(value) {
+			delete(meta.Tags, key)
+			return
+		}
+		if meta.Tags == nil {
+			meta.Tags = make(map[string]string)
+		}
+		meta.Tags[key] = value
+	}
+}
+
+// NewRemoteNode creates a node supplying service at baseUrl which is not a member of memberlist cluster,
+// such as nodes returned by custom IRegistry implementations
+func NewRemoteNode(service, baseUrl string, opts ...MetaOption) (*Node, error) {
+	u, err := url.Parse(baseUrl)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid base url %s", baseUrl)
+	}
+	if stringutils.IsEmpty(u.Scheme) || stringutils.IsEmpty(u.Hostname()) {
+		return nil, errors.Errorf("invalid base url %s, scheme and host are required", baseUrl)
+	}
+	port := 80
+	if u.Scheme == "https" {
+		port = 443
+	}
+	if stringutils.IsNotEmpty(u.Port()) {
+		if port, err = strconv.Atoi(u.Port()); err != nil {
+			return nil, errors.Wrapf(err, "invalid port of base url %s", baseUrl)
+		}
+	}
+	meta := nodeMeta{
+		Service:       service,
+		RouteRootPath: strings.TrimSuffix(u.Path, "/"),
+		Port:          port,
+		Scheme:        u.Scheme,
+	}
+	for _, opt := range opts {
+		opt(&meta)
+	}
+	if meta.Weight < 0 {
+		return nil, errors.Errorf("weight should not be negative, got %d", meta.Weight)
+	}
+	return &Node{
+		mmeta: mergedMeta{
+			Meta: meta,
+		},
+		memberNode: &memberlist.Node{
+			Name: u.Host,
+			Addr: u.Hostname(),
+			Port: uint16(port),
+		},
+		remote: true,
+	}, nil
+}
+
+// parseTags parses tags in format of key=value,key=value. Invalid items are ignored
+func parseTags(value string) map[string]string {
+	var tags map[string]string
+	for _, item := range strings.Split(value, ",") {
+		kv := strings.SplitN(strings.TrimSpace(item), "=", 2)
+		if len(kv) != 2 || stringutils.IsEmpty(kv[0]) || stringutils.IsEmpty(kv[1]) {
+			if stringutils.IsNotEmpty(item) {
+				logrus.Warnf("Ignore invalid tag %s in %s\n", item, config.GddMemTags)
+			}
+			continue
+		}
+		if tags == nil {
+			tags = make(map[string]string)
+		}
+		tags[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return tags
+}
+
+// meta returns a copy of meta data which is safe to read while it is being updated
+func (n *Node) meta() mergedMeta {
+	n.metaLock.RLock()
+	defer n.metaLock.RUnlock()
+	return n.mmeta
+}
+
+// UpdateMeta changes meta data of local node and spreads it to other nodes in the cluster
+func (n *Node) UpdateMeta(opts ...MetaOption) error {
+	if n.remote || n.registry == nil || n.memberlist == nil {
+		return errors.New("only meta data of local node can be updated")
+	}
+	n.metaLock.Lock()
+	mmeta := n.mmeta
+	// tags are copied, so that readers holding the old map are not affected
+	mmeta.Meta.Tags = make(map[string]string, len(n.mmeta.Meta.Tags))
+	for k, v := range n.mmeta.Meta.Tags {
+		mmeta.Meta.Tags[k] = v
+	}
+	for _, opt := range opts {
+		opt(&mmeta.Meta)
+	}
+	if len(mmeta.Meta.Tags) == 0 {
+		mmeta.Meta.Tags = nil
+	}
+	if mmeta.Meta.Weight < 0 {
+		n.metaLock.Unlock()
+		return errors.Errorf("weight should not be negative, got %d", mmeta.Meta.Weight)
+	}
+	if _, err := checkMetaSize(mmeta, n.metaCodec, memberlist.MetaMaxSize); err != nil {
+		n.metaLock.Unlock()
+		return err
+	}
+	n.mmeta = mmeta
+	n.metaLock.Unlock()
+	if err := n.memberlist.UpdateNode(updateMetaTimeout); err != nil {
+		return errors.Wrap(err, "update node failed")
+	}
+	return nil
+}
+
+// Weight returns weight of the node for weighted load balancers
+func (n *Node) Weight() int {
+	if weight := n.meta().Meta.Weight; weight > 0 {
+		return weight
+	}
+	return DefaultWeight
+}
+
+// Status returns status of the node, StatusUp if not set
+func (n *Node) Status() string {
+	if status := n.meta().Meta.Status; stringutils.IsNotEmpty(status) {
+		return status
+	}
+	return StatusUp
+}
+
+// Tags returns a copy of tags of the node
+func (n *Node) Tags() map[string]string {
+	tags := make(map[string]string)
+	for k, v := range n.meta().Meta.Tags {
+		tags[k] = v
+	}
+	return tags
+}
+
+// Tag returns value of tag key
+func (n *Node) Tag(key string) string {
+	return n.meta().Meta.Tags[key]
+}
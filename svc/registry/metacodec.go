@@ -0,0 +1,180 @@
+package registry
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/json"
+	"github.com/hashicorp/go-msgpack/codec"
+	"github.com/pkg/errors"
+	"github.com/unionj-cloud/go-doudou/svc/config"
+	"io/ioutil"
+	"strings"
+)
+
+// Meta data is encoded as msgpack, compressed by deflate if it gets smaller, with a leading format byte.
+// Meta data starting with { is json encoded by nodes of older versions or nodes using MetaCodecJson
+const (
+	metaFormatMsgpack byte = 1
+	metaFormatDeflate byte = 2
+)
+
+const (
+	// MetaCodecJson encodes meta data as json, which is readable by nodes of all versions
+	MetaCodecJson = "json"
+	// MetaCodecMsgpack encodes meta data compactly, which is only readable by nodes supporting GDD_MEM_META_CODEC
+	MetaCodecMsgpack = "msgpack"
+)
+
+// parseMetaCodec validates value of GDD_MEM_META_CODEC, empty value means MetaCodecJson
+func parseMetaCodec(metaCodec string) (string, error) {
+	switch strings.ToLower(metaCodec) {
+	case "", MetaCodecJson:
+		return MetaCodecJson, nil
+	case MetaCodecMsgpack:
+		return MetaCodecMsgpack, nil
+	default:
+		return "", errors.Errorf("invalid %s %s, should be %s or %s", config.GddMemMetaCodec, metaCodec,
+			MetaCodecJson, MetaCodecMsgpack)
+	}
+}
+
+// dataTopicPrefix prefixes topics of cluster state carrying data of nodes which is too large for meta data
+const dataTopicPrefix = "_gdd/data/"
+
+var msgpackHandle = &codec.MsgpackHandle{}
+
+// wireMeta is mergedMeta on the wire, user data is json encoded, so that it is decoded as is
+type wireMeta struct {
+	Meta nodeMeta `codec:"m"`
+	Data []byte   `codec:"d,omitempty"`
+}
+
+func dataTopic(name string) string {
+	return dataTopicPrefix + name
+}
+
+// encodeMeta encodes mm by metaCodec, as json if metaCodec is empty
+func encodeMeta(mm mergedMeta, metaCodec string) ([]byte, error) {
+	if metaCodec != MetaCodecMsgpack {
+		raw, err := json.Marshal(mm)
+		if err != nil {
+			return nil, errors.Wrap(err, "marshal node meta data failed")
+		}
+		return raw, nil
+	}
+	wire := wireMeta{
+		Meta: mm.Meta,
+	}
+	if mm.Data != nil {
+		data, err := json.Marshal(mm.Data)
+		if err != nil {
+			return nil, errors.Wrap(err, "marshal node data failed")
+		}
+		wire.Data = data
+	}
+	var buf bytes.Buffer
+	buf.WriteByte(metaFormatMsgpack)
+	if err := codec.NewEncoder(&buf, msgpackHandle).Encode(wire); err != nil {
+		return nil, errors.Wrap(err, "encode node meta data failed")
+	}
+	raw := buf.Bytes()
+	var compressed bytes.Buffer
+	compressed.WriteByte(metaFormatDeflate)
+	w, _ := flate.NewWriter(&compressed, flate.BestCompression)
+	if _, err := w.Write(raw[1:]); err != nil {
+		return nil, errors.Wrap(err, "compress node meta data failed")
+	}
+	if err := w.Close(); err != nil {
+		return nil, errors.Wrap(err, "compress node meta data failed")
+	}
+	if compressed.Len() < len(raw) {
+		return compressed.Bytes(), nil
+	}
+	return raw, nil
+}
+
+// decodeMeta decodes meta data encoded by encodeMeta with any codec, or json encoded by nodes of older versions
+func decodeMeta(raw []byte) (mergedMeta, error) {
+	var mm mergedMeta
+	if len(raw) == 0 {
+		return mm, nil
+	}
+	payload := raw[1:]
+	switch raw[0] {
+	case '{':
+		if err := json.Unmarshal(raw, &mm); err != nil {
+			return mm, errors.Wrap(err, "Unmarshal node meta failed, not a valid json")
+		}
+		return mm, nil
+	case metaFormatDeflate:
+		decompressed, err := ioutil.ReadAll(flate.NewReader(bytes.NewReader(payload)))
+		if err != nil {
+			return mm, errors.Wrap(err, "decompress node meta data failed")
+		}
+		payload = decompressed
+	case metaFormatMsgpack:
+	default:
+		return mm, errors.Errorf("unknown format %d of node meta data", raw[0])
+	}
+	var wire wireMeta
+	if err := codec.NewDecoderBytes(payload, msgpackHandle).Decode(&wire); err != nil {
+		return mm, errors.Wrap(err, "decode node meta data failed")
+	}
+	mm.Meta = wire.Meta
+	if len(wire.Data) > 0 {
+		mm.Data = json.RawMessage(wire.Data)
+	}
+	return mm, nil
+}
+
+// checkMetaSize returns mm encoded by metaCodec if it fits in limit
+func checkMetaSize(mm mergedMeta, metaCodec string, limit int) ([]byte, error) {
+	raw, err := encodeMeta(mm, metaCodec)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) > limit {
+		return nil, errors.Errorf("node meta data exceeds length limit of %d bytes, got %d bytes", limit, len(raw))
+	}
+	return raw, nil
+}
+
+// fitMeta moves data of local node into cluster state if meta data exceeds limit with it. Remote nodes get
+// the data by push/pull state sync. It fails if meta data exceeds limit even without data, such as too many tags
+func (n *Node) fitMeta(limit int) error {
+	if _, err := checkMetaSize(n.mmeta, n.metaCodec, limit); err == nil || n.mmeta.Data == nil {
+		return err
+	}
+	data, err := json.Marshal(n.mmeta.Data)
+	if err != nil {
+		return errors.Wrap(err, "marshal node data failed")
+	}
+	mm := mergedMeta{
+		Meta: n.mmeta.Meta,
+	}
+	mm.Meta.DataInState = true
+	if _, err = checkMetaSize(mm, n.metaCodec, limit); err != nil {
+		return err
+	}
+	n.mmeta = mm
+	// start time of the entry makes data of a restarted node with the same name win over the stale one
+	n.state.next(dataTopic(n.memberConf.Name), n.memberConf.Name, data)
+	return nil
+}
+
+// data returns json encoded data of the node, either carried by meta data or cluster state
+func (n *Node) data() string {
+	mmeta := n.meta()
+	if mmeta.Data != nil {
+		if b, err := json.Marshal(mmeta.Data); err == nil {
+			return string(b)
+		}
+		return ""
+	}
+	if mmeta.Meta.DataInState && n.dataState != nil {
+		if entry, ok := n.dataState.get(dataTopic(n.memberNode.Name)); ok {
+			return string(entry.Payload)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,128 @@
+package registry
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/svc/config"
+	"github.com/unionj-cloud/memberlist"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+// incompressible returns random hex string which is still n bytes after compression
+func incompressible(n int) string {
+	buf := make([]byte, n)
+	rand.New(rand.NewSource(int64(n))).Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+func Test_encodeMeta(t *testing.T) {
+	now := time.Now().UTC()
+	mm := mergedMeta{
+		Meta: nodeMeta{
+			Service:    "usersvc",
+			Port:       6060,
+			RegisterAt: &now,
+			GoVer:      "go1.15.8",
+			Tags:       map[string]string{"zone": "a"},
+		},
+		Data: map[string]interface{}{"message": strings.Repeat("hello", 20)},
+	}
+	raw, err := encodeMeta(mm, MetaCodecMsgpack)
+	require.NoError(t, err)
+	legacy, err := json.Marshal(mm)
+	require.NoError(t, err)
+	// readable by nodes of older versions
+	jsonRaw, err := encodeMeta(mm, MetaCodecJson)
+	require.NoError(t, err)
+	assert.Equal(t, legacy, jsonRaw)
+	assert.Less(t, len(raw), len(legacy))
+	assert.Equal(t, metaFormatDeflate, raw[0])
+
+	decoded, err := decodeMeta(raw)
+	require.NoError(t, err)
+	assert.Equal(t, "usersvc", decoded.Meta.Service)
+	assert.True(t, now.Equal(*decoded.Meta.RegisterAt))
+	assert.Equal(t, mm.Meta.Tags, decoded.Meta.Tags)
+	data, _ := json.Marshal(decoded.Data)
+	assert.JSONEq(t, `{"message":"`+strings.Repeat("hello", 20)+`"}`, string(data))
+
+	// small meta data is not compressed
+	raw, err = encodeMeta(mergedMeta{Meta: nodeMeta{Service: "a"}}, MetaCodecMsgpack)
+	require.NoError(t, err)
+	assert.Equal(t, metaFormatMsgpack, raw[0])
+	decoded, err = decodeMeta(raw)
+	require.NoError(t, err)
+	assert.Equal(t, "a", decoded.Meta.Service)
+	assert.Nil(t, decoded.Data)
+
+	// json from nodes of older versions
+	decoded, err = decodeMeta(legacy)
+	require.NoError(t, err)
+	assert.Equal(t, "usersvc", decoded.Meta.Service)
+
+	_, err = decodeMeta([]byte{9, 1, 2})
+	assert.Error(t, err)
+	_, err = decodeMeta([]byte{metaFormatDeflate, 1, 2})
+	assert.Error(t, err)
+}
+
+func Test_parseMetaCodec(t *testing.T) {
+	metaCodec, err := parseMetaCodec("")
+	require.NoError(t, err)
+	assert.Equal(t, MetaCodecJson, metaCodec)
+	metaCodec, err = parseMetaCodec("MSGPACK")
+	require.NoError(t, err)
+	assert.Equal(t, MetaCodecMsgpack, metaCodec)
+	_, err = parseMetaCodec("gob")
+	assert.Error(t, err)
+}
+
+func Test_delegate_NodeMetaLimit(t *testing.T) {
+	d := &delegate{
+		local: &Node{
+			mmeta: mergedMeta{
+				Meta: nodeMeta{Service: "usersvc", Tags: map[string]string{"big": incompressible(100)}},
+			},
+		},
+	}
+	assert.NotPanics(t, func() {
+		assert.Nil(t, d.NodeMeta(10))
+	})
+	assert.NotEmpty(t, d.NodeMeta(memberlist.MetaMaxSize))
+}
+
+func TestNewNode_LargeData(t *testing.T) {
+	_ = config.GddMemSeed.Write(seed.memberNode.Address())
+	_ = config.GddServiceName.Write("testsvc_largedata")
+	_ = config.GddMemName.Write("testnode_largedata")
+	_ = config.GddMemHost.Write("")
+	_ = config.GddMemPort.Write("57699")
+	_ = config.GddPort.Write("6060")
+	// seed uses json, so the cluster mixes both codecs
+	defer config.GddMemMetaCodec.Write("")
+	_ = config.GddMemMetaCodec.Write(MetaCodecMsgpack)
+	data := incompressible(2 * memberlist.MetaMaxSize)
+	node, err := NewNode(WithData(data))
+	require.NoError(t, err)
+	defer node.memberlist.Shutdown()
+	// leave, so that seed doesn't gossip to it after shutdown
+	defer node.Leave(time.Second)
+	assert.Equal(t, `"`+data+`"`, node.Info().Data)
+
+	require.Eventually(t, func() bool {
+		nodes, _ := seed.Discover("testsvc_largedata")
+		return len(nodes) == 1 && nodes[0].Info().Data == `"`+data+`"`
+	}, 15*time.Second, 100*time.Millisecond)
+
+	defer config.GddMemTags.Write("")
+	_ = config.GddMemTags.Write("big=" + incompressible(memberlist.MetaMaxSize))
+	_ = config.GddMemName.Write("testnode_largetags")
+	_ = config.GddMemPort.Write("57799")
+	_, err = NewNode()
+	assert.Error(t, err)
+}
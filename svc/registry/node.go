@@ -1,7 +1,7 @@
 package registry
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"github.com/hako/durafmt"
 	"github.com/hashicorp/logutils"
@@ -10,13 +10,19 @@ import (
 	"github.com/unionj-cloud/cast"
 	"github.com/unionj-cloud/go-doudou/stringutils"
 	"github.com/unionj-cloud/go-doudou/svc/config"
+	"github.com/unionj-cloud/go-doudou/svc/http/health"
+	"github.com/unionj-cloud/go-doudou/svc/tracing"
 	"github.com/unionj-cloud/memberlist"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"net"
 	"os"
 	"runtime"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -26,6 +32,11 @@ type IRegistry interface {
 	Discover(svc string) ([]*Node, error)
 }
 
+// IWatcher is implemented by registries which notify changes of nodes
+type IWatcher interface {
+	Watch(svc string) (<-chan ServiceEvent, func())
+}
+
 type registry struct {
 	memberConf *memberlist.Config
 	broadcasts *memberlist.TransmitLimitedQueue
@@ -33,6 +44,8 @@ type registry struct {
 	lock       sync.Mutex
 	memberLock sync.RWMutex
 	members    []*memberlist.Node
+	state      *clusterState
+	services   *serviceCache
 }
 
 func seeds(seedstr string) []string {
@@ -58,56 +71,51 @@ func (r *registry) Register() error {
 		logrus.Warnln("No seed found")
 		return nil
 	}
+	_, span := tracing.Start(context.Background(), "registry.Register", trace.WithAttributes(attribute.StringSlice("registry.seeds", seeds)))
+	defer span.End()
 	_, err := r.memberlist.Join(seeds)
 	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 		return errors.Wrap(err, "Failed to join cluster")
 	}
 	logrus.Infof("Node %s joined cluster successfully", r.memberlist.LocalNode().FullAddress())
 	return nil
 }
 
-// Discover finds nodes which supplying specified service
+// Discover finds nodes which supplying specified service from the index maintained by membership events.
+// Empty svc returns nodes of all services
 func (r *registry) Discover(svc string) ([]*Node, error) {
 	if r.memberlist == nil {
 		return nil, errors.New("Memberlist is nil")
 	}
-	var nodes []*Node
-	for _, member := range r.memberlist.Members() {
-		logrus.Debugf("Member: %s %s\n", member.Name, member.Addr)
-		var mmeta mergedMeta
-		if err := json.Unmarshal(member.Meta, &mmeta); err != nil {
-			return nil, errors.Wrap(err, "")
-		}
-		if stringutils.IsEmpty(svc) || mmeta.Meta.Service == svc {
-			nodes = append(nodes, &Node{
-				mmeta:      mmeta,
-				memberNode: member,
-				remote:     true,
-			})
-		}
-	}
-	return nodes, nil
+	return r.services.discover(svc), nil
 }
 
+// nodeMeta is meta data of a node. Short codec keys keep encoded meta data compact
 type nodeMeta struct {
-	Service       string     `json:"service"`
-	RouteRootPath string     `json:"routeRootPath"`
-	Port          int        `json:"port"`
-	RegisterAt    *time.Time `json:"registerAt"`
-	GoVer         string     `json:"goVer"`
-	GddVer        string     `json:"gddVer"`
-	BuildUser     string     `json:"buildUser"`
-	BuildTime     string     `json:"buildTime"`
+	Service       string     `json:"service" codec:"s"`
+	RouteRootPath string     `json:"routeRootPath" codec:"r,omitempty"`
+	Port          int        `json:"port" codec:"p"`
+	Scheme        string     `json:"scheme,omitempty" codec:"sc,omitempty"`
+	RegisterAt    *time.Time `json:"registerAt" codec:"ra,omitempty"`
+	GoVer         string     `json:"goVer" codec:"gv,omitempty"`
+	GddVer        string     `json:"gddVer" codec:"dv,omitempty"`
+	BuildUser     string     `json:"buildUser" codec:"bu,omitempty"`
+	BuildTime     string     `json:"buildTime" codec:"bt,omitempty"`
+	// Weight is used by weighted load balancers, zero means DefaultWeight
+	Weight int               `json:"weight,omitempty" codec:"w,omitempty"`
+	Tags   map[string]string `json:"tags,omitempty" codec:"tg,omitempty"`
+	// Status is StatusUp if empty
+	Status string `json:"status,omitempty" codec:"st,omitempty"`
+	// Cluster is name of the cluster, nodes of other clusters are rejected
+	Cluster string `json:"cluster,omitempty" codec:"c,omitempty"`
+	// DataInState is true if data of the node is too large for meta data and carried by cluster state
+	DataInState bool `json:"dataInState,omitempty" codec:"ds,omitempty"`
 }
 
 func newMeta(mnode *memberlist.Node) (mergedMeta, error) {
-	var mm mergedMeta
-	if len(mnode.Meta) > 0 {
-		if err := json.Unmarshal(mnode.Meta, &mm); err != nil {
-			return mm, errors.Wrap(err, "Unmarshal node meta failed, not a valid json")
-		}
-	}
-	return mm, nil
+	return decodeMeta(mnode.Meta)
 }
 
 type mergedMeta struct {
@@ -118,15 +126,41 @@ type mergedMeta struct {
 // Node represents go-doudou node
 type Node struct {
 	mmeta      mergedMeta
+	metaLock   sync.RWMutex
 	memberNode *memberlist.Node
 	*registry
 	// check the node is a local node or remote node
-	remote bool
+	remote     bool
+	lifecycle  Lifecycle
+	authorizer Authorizer
+	// dataState is cluster state of local node, which carries data of nodes too large for meta data
+	dataState *clusterState
+	// localState is one of localAlive, localLeft and localShutdown, accessed atomically
+	localState int32
+	// metaCodec is MetaCodecJson or MetaCodecMsgpack for encoding meta data of local node
+	metaCodec string
+	// probes records probes of local node for telling whether the node is suspect
+	probes *probeTracker
 }
 
+// states of local node, memberlist doesn't expose them because State field of memberlist.Node is never updated
+const (
+	localAlive int32 = iota
+	localLeft
+	localShutdown
+)
+
 // LocalNode store local node globally
 var LocalNode *Node
 
+// scheme returns https if http server is configured to serve over tls
+func scheme() string {
+	if stringutils.IsNotEmpty(config.GddTlsCert.Load()) && stringutils.IsNotEmpty(config.GddTlsKey.Load()) {
+		return "https"
+	}
+	return "http"
+}
+
 // NodeOption sets node properties
 type NodeOption func(*Node)
 
@@ -139,6 +173,19 @@ func WithData(data interface{}) NodeOption {
 	}
 }
 
+// Lifecycle is implemented by ddhttp.Srv for registering shutdown hooks
+type Lifecycle interface {
+	OnShutdown(hooks ...func(ctx context.Context) error)
+}
+
+// WithLifecycle registers node shutdown as a shutdown hook of the http server,
+// so that the node leaves the cluster after the server stopped
+func WithLifecycle(lifecycle Lifecycle) NodeOption {
+	return func(node *Node) {
+		node.lifecycle = lifecycle
+	}
+}
+
 // getFreePort Borrow source code from https://github.com/phayes/freeport/blob/master/freeport.go
 // GetFreePort asks the kernel for a free open port that is ready to use.
 func getFreePort() (int, error) {
@@ -155,8 +202,111 @@ func getFreePort() (int, error) {
 	return l.Addr().(*net.TCPAddr).Port, nil
 }
 
-func newConf() *memberlist.Config {
-	mconf := memberlist.DefaultWANConfig()
+// memDuration parses duration of env, plain number means seconds. It returns def if env is not set
+func memDuration(env config.EnvLoader, def time.Duration) (time.Duration, error) {
+	value := strings.TrimSpace(env.Load())
+	if stringutils.IsEmpty(value) {
+		return def, nil
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, errors.Errorf("invalid %s %s, should be a duration such as 500ms or seconds", env, value)
+	}
+	return d, nil
+}
+
+// memInt parses int of env. It returns def if env is not set
+func memInt(env config.EnvLoader, def int) (int, error) {
+	value := strings.TrimSpace(env.Load())
+	if stringutils.IsEmpty(value) {
+		return def, nil
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, errors.Errorf("invalid %s %s, should be an integer", env, value)
+	}
+	return i, nil
+}
+
+// baseConf returns default memberlist config of GDD_MEM_PROFILE, wan if not set
+func baseConf() (*memberlist.Config, string, error) {
+	profile := strings.ToLower(strings.TrimSpace(config.GddMemProfile.Load()))
+	switch profile {
+	case "", "wan":
+		return memberlist.DefaultWANConfig(), "wan", nil
+	case "lan":
+		return memberlist.DefaultLANConfig(), profile, nil
+	case "local":
+		return memberlist.DefaultLocalConfig(), profile, nil
+	default:
+		return nil, "", errors.Errorf("invalid %s %s, should be one of lan, wan and local", config.GddMemProfile, profile)
+	}
+}
+
+// tuneConf overrides properties of mconf created by profile with env variables and validates them
+func tuneConf(mconf *memberlist.Config, profile string) error {
+	var err error
+	deadTimeout, syncInterval, reclaimTime := mconf.GossipToTheDeadTime, mconf.PushPullInterval, mconf.DeadNodeReclaimTime
+	// defaults of go-doudou for wan profile, lan and local profiles keep defaults of memberlist
+	if profile == "wan" {
+		deadTimeout, syncInterval, reclaimTime = 30*time.Second, 5*time.Second, 3*time.Second
+	}
+	durations := []struct {
+		env   config.EnvLoader
+		value *time.Duration
+		def   time.Duration
+		// zero disables the feature
+		zero bool
+	}{
+		{config.GddMemDeadTimeout, &mconf.GossipToTheDeadTime, deadTimeout, true},
+		{config.GddMemSyncInterval, &mconf.PushPullInterval, syncInterval, true},
+		{config.GddMemReclaimTimeout, &mconf.DeadNodeReclaimTime, reclaimTime, true},
+		{config.GddMemProbeInterval, &mconf.ProbeInterval, mconf.ProbeInterval, false},
+		{config.GddMemProbeTimeout, &mconf.ProbeTimeout, mconf.ProbeTimeout, false},
+		{config.GddMemGossipInterval, &mconf.GossipInterval, mconf.GossipInterval, true},
+		{config.GddMemTCPTimeout, &mconf.TCPTimeout, mconf.TCPTimeout, false},
+	}
+	for _, d := range durations {
+		if *d.value, err = memDuration(d.env, d.def); err != nil {
+			return err
+		}
+		if *d.value < 0 || (*d.value == 0 && !d.zero) {
+			return errors.Errorf("%s should be positive, got %s", d.env, *d.value)
+		}
+	}
+	ints := []struct {
+		env   config.EnvLoader
+		value *int
+		min   int
+	}{
+		{config.GddMemSuspicionMult, &mconf.SuspicionMult, 1},
+		{config.GddMemGossipNodes, &mconf.GossipNodes, 1},
+		{config.GddMemRetransmitMult, &mconf.RetransmitMult, 1},
+		{config.GddMemIndirectChecks, &mconf.IndirectChecks, 0},
+	}
+	for _, i := range ints {
+		if *i.value, err = memInt(i.env, *i.value); err != nil {
+			return err
+		}
+		if *i.value < i.min {
+			return errors.Errorf("%s should not be less than %d, got %d", i.env, i.min, *i.value)
+		}
+	}
+	if mconf.ProbeTimeout > mconf.ProbeInterval {
+		return errors.Errorf("%s %s should not be greater than %s %s", config.GddMemProbeTimeout, mconf.ProbeTimeout,
+			config.GddMemProbeInterval, mconf.ProbeInterval)
+	}
+	return nil
+}
+
+func newConf() (*memberlist.Config, error) {
+	mconf, profile, err := baseConf()
+	if err != nil {
+		return nil, err
+	}
 	minLevel := strings.ToUpper(config.GddLogLevel.Load())
 	if minLevel == "ERROR" {
 		minLevel = "ERR"
@@ -168,27 +318,14 @@ func newConf() *memberlist.Config {
 		MinLevel: logutils.LogLevel(minLevel),
 		Writer:   logrus.StandardLogger().Writer(),
 	}
-	mconf.GossipToTheDeadTime = 30 * time.Second
-	deadTimeoutStr := config.GddMemDeadTimeout.Load()
-	if stringutils.IsNotEmpty(deadTimeoutStr) {
-		if deadTimeout, err := strconv.Atoi(deadTimeoutStr); err == nil {
-			mconf.GossipToTheDeadTime = time.Duration(deadTimeout) * time.Second
-		}
-	}
-	mconf.PushPullInterval = 5 * time.Second
-	syncIntervalStr := config.GddMemSyncInterval.Load()
-	if stringutils.IsNotEmpty(syncIntervalStr) {
-		if syncInterval, err := strconv.Atoi(syncIntervalStr); err == nil {
-			mconf.PushPullInterval = time.Duration(syncInterval) * time.Second
-		}
-	}
-	mconf.DeadNodeReclaimTime = 3 * time.Second
-	reclaimTimeoutStr := config.GddMemReclaimTimeout.Load()
-	if stringutils.IsNotEmpty(reclaimTimeoutStr) {
-		if reclaimTimeout, err := strconv.Atoi(reclaimTimeoutStr); err == nil {
-			mconf.DeadNodeReclaimTime = time.Duration(reclaimTimeout) * time.Second
-		}
+	if err = tuneConf(mconf, profile); err != nil {
+		return nil, err
 	}
+	logrus.Infof("Memberlist config: profile=%s probeInterval=%s probeTimeout=%s suspicionMult=%d gossipInterval=%s "+
+		"gossipNodes=%d retransmitMult=%d tcpTimeout=%s indirectChecks=%d pushPullInterval=%s gossipToTheDeadTime=%s "+
+		"deadNodeReclaimTime=%s\n", profile, mconf.ProbeInterval, mconf.ProbeTimeout, mconf.SuspicionMult, mconf.GossipInterval,
+		mconf.GossipNodes, mconf.RetransmitMult, mconf.TCPTimeout, mconf.IndirectChecks, mconf.PushPullInterval,
+		mconf.GossipToTheDeadTime, mconf.DeadNodeReclaimTime)
 	nodename := config.GddMemName.Load()
 	if stringutils.IsNotEmpty(nodename) {
 		mconf.Name = nodename
@@ -210,21 +347,44 @@ func newConf() *memberlist.Config {
 			mconf.AdvertiseAddr = memhost
 		}
 	}
-	return mconf
+	return mconf, nil
 }
 
 // NewNode creates new go-doudou node
 func NewNode(opts ...NodeOption) (*Node, error) {
-	mconf := newConf()
+	mconf, err := newConf()
+	if err != nil {
+		return nil, errors.Wrap(err, "NewNode() error: invalid memberlist config")
+	}
+	if err = setKeyring(mconf); err != nil {
+		return nil, errors.Wrap(err, "NewNode() error")
+	}
 	service := config.GddServiceName.Load()
 	if stringutils.IsEmpty(service) {
 		return nil, errors.New(fmt.Sprintf("NewNode() error: No env variable %s found", config.GddServiceName))
 	}
+	metaCodec, err := parseMetaCodec(config.GddMemMetaCodec.Load())
+	if err != nil {
+		return nil, errors.Wrap(err, "NewNode() error")
+	}
+	timeout, err := suspectTimeout()
+	if err != nil {
+		return nil, errors.Wrap(err, "NewNode() error")
+	}
+	state := newClusterState()
+	services := newServiceCache()
+	services.state = state
 	node := &Node{
 		registry: &registry{
 			memberConf: mconf,
+			state:      state,
+			services:   services,
 		},
+		dataState: state,
+		metaCodec: metaCodec,
 	}
+	node.probes = newProbeTracker(timeout, mconf.ProbeInterval, node.NumNodes)
+	services.probes = node.probes
 	for _, opt := range opts {
 		opt(node)
 	}
@@ -238,14 +398,23 @@ func NewNode(opts ...NodeOption) (*Node, error) {
 		Service:       service,
 		RouteRootPath: config.GddRouteRootPath.Load(),
 		Port:          port,
+		Scheme:        scheme(),
 		RegisterAt:    &now,
 		GoVer:         runtime.Version(),
 		GddVer:        config.GddVer,
 		BuildUser:     config.BuildUser,
 		BuildTime:     config.BuildTime,
+		Tags:          parseTags(config.GddMemTags.Load()),
+		Cluster:       config.GddMemCluster.Load(),
+	}
+	if err = node.fitMeta(memberlist.MetaMaxSize); err != nil {
+		return nil, errors.Wrap(err, "NewNode() error: invalid node meta data")
 	}
 	mconf.Delegate = &delegate{node}
 	mconf.Events = &eventDelegate{node}
+	mconf.Alive = &authDelegate{node}
+	mconf.Merge = &authDelegate{node}
+	mconf.Ping = node.probes
 	list, err := memberlist.Create(mconf)
 	if err != nil {
 		return nil, errors.Wrap(err, "NewNode() error: Failed to create memberlist")
@@ -261,6 +430,14 @@ func NewNode(opts ...NodeOption) (*Node, error) {
 	}
 	node.memberNode = list.LocalNode()
 	LocalNode = node
+	Default = node
+	health.RegisterHealthCheck("memberlist", node.HealthCheck)
+	if node.lifecycle != nil {
+		node.lifecycle.OnShutdown(func(ctx context.Context) error {
+			node.Shutdown()
+			return nil
+		})
+	}
 	return node, nil
 }
 
@@ -275,66 +452,98 @@ func (n *Node) NumNodes() (numNodes int) {
 
 // Shutdown stops all connections and communications with other nodes in the cluster
 func (n *Node) Shutdown() {
+	atomic.StoreInt32(&n.localState, localShutdown)
 	if err := n.memberlist.Shutdown(); err != nil {
 		logrus.Errorf("memberlist shutdown fail: %+v\n", err)
 	}
 	return
 }
 
+// Leave broadcasts leave message to other nodes in the cluster and waits at most timeout,
+// so that they stop discovering this node before it shuts down
+func (n *Node) Leave(timeout time.Duration) {
+	atomic.CompareAndSwapInt32(&n.localState, localAlive, localLeft)
+	if err := n.memberlist.Leave(timeout); err != nil {
+		logrus.Errorf("memberlist leave fail: %+v\n", err)
+	}
+}
+
+// HealthCheck fails if local node is not alive in memberlist cluster, such as after it left or shut down
+func (n *Node) HealthCheck(ctx context.Context) error {
+	switch atomic.LoadInt32(&n.localState) {
+	case localLeft:
+		return errors.Errorf("local node %s has left the cluster", n.memberNode.Name)
+	case localShutdown:
+		return errors.Errorf("local node %s has shut down", n.memberNode.Name)
+	}
+	return nil
+}
+
 // NodeInfo wraps node information
 type NodeInfo struct {
-	SvcName   string `json:"svcName"`
-	Hostname  string `json:"hostname"`
-	BaseUrl   string `json:"baseUrl"`
-	Status    string `json:"status"`
-	Uptime    string `json:"uptime"`
-	GoVer     string `json:"goVer"`
-	GddVer    string `json:"gddVer"`
-	BuildUser string `json:"buildUser"`
-	BuildTime string `json:"buildTime"`
-	Data      string `json:"data"`
+	SvcName   string            `json:"svcName"`
+	Hostname  string            `json:"hostname"`
+	BaseUrl   string            `json:"baseUrl"`
+	Status    string            `json:"status"`
+	Uptime    string            `json:"uptime"`
+	GoVer     string            `json:"goVer"`
+	GddVer    string            `json:"gddVer"`
+	BuildUser string            `json:"buildUser"`
+	BuildTime string            `json:"buildTime"`
+	Weight    int               `json:"weight"`
+	Tags      map[string]string `json:"tags,omitempty"`
+	// Ejected is true if the node is ejected for consecutive failures of requests sent by local node
+	Ejected bool   `json:"ejected"`
+	Data    string `json:"data"`
 }
 
 // Info return node info
 func (n *Node) Info() NodeInfo {
-	status := "up"
-	if n.memberNode.State == memberlist.StateSuspect {
+	mmeta := n.meta()
+	status := n.Status()
+	ejected := n.Ejected()
+	if n.Suspect() {
 		status = "suspect"
+	} else if ejected {
+		status = "ejected"
 	}
-	var data string
-	if n.mmeta.Data != nil {
-		if b, err := json.Marshal(n.mmeta.Data); err == nil {
-			data = string(b)
-		}
-	}
+	data := n.data()
 	var uptime string
-	if n.mmeta.Meta.RegisterAt != nil {
-		uptime = time.Since(*n.mmeta.Meta.RegisterAt).String()
+	if mmeta.Meta.RegisterAt != nil {
+		uptime = time.Since(*mmeta.Meta.RegisterAt).String()
 		if duration, err := durafmt.ParseString(uptime); err == nil {
 			uptime = duration.LimitFirstN(2).String()
 		}
 	}
 	return NodeInfo{
-		SvcName:   n.mmeta.Meta.Service,
+		SvcName:   mmeta.Meta.Service,
 		Hostname:  n.memberNode.Name,
 		BaseUrl:   n.BaseUrl(),
 		Status:    status,
 		Uptime:    uptime,
-		GoVer:     n.mmeta.Meta.GoVer,
-		GddVer:    n.mmeta.Meta.GddVer,
-		BuildUser: n.mmeta.Meta.BuildUser,
-		BuildTime: n.mmeta.Meta.BuildTime,
+		GoVer:     mmeta.Meta.GoVer,
+		GddVer:    mmeta.Meta.GddVer,
+		BuildUser: mmeta.Meta.BuildUser,
+		BuildTime: mmeta.Meta.BuildTime,
+		Weight:    n.Weight(),
+		Tags:      mmeta.Meta.Tags,
+		Ejected:   ejected,
 		Data:      data,
 	}
 }
 
 // BaseUrl return base url for restful service
 func (n *Node) BaseUrl() string {
-	return fmt.Sprintf("http://%s:%d%s", n.memberNode.Addr, n.mmeta.Meta.Port, n.mmeta.Meta.RouteRootPath)
+	meta := n.meta().Meta
+	scheme := meta.Scheme
+	if stringutils.IsEmpty(scheme) {
+		scheme = "http"
+	}
+	return fmt.Sprintf("%s://%s:%d%s", scheme, n.memberNode.Addr, meta.Port, meta.RouteRootPath)
 }
 
 // String return string representation
 func (n *Node) String() string {
 	return fmt.Sprintf("Node %s, providing %s service at %s, memberlist port %s",
-		n.memberNode.Name, n.mmeta.Meta.Service, n.BaseUrl(), fmt.Sprint(n.memberNode.Port))
+		n.memberNode.Name, n.meta().Meta.Service, n.BaseUrl(), fmt.Sprint(n.memberNode.Port))
 }
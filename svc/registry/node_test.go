@@ -1,17 +1,21 @@
 package registry
 
 import (
+	"context"
 	"github.com/stretchr/testify/require"
 	"github.com/unionj-cloud/go-doudou/svc/config"
 	"github.com/unionj-cloud/memberlist"
 	"os"
 	"reflect"
 	"testing"
+	"time"
 )
 
 var seed *Node
 
 func TestMain(m *testing.M) {
+	// nodes of tests are shut down without leaving, local profile detects them dead quickly
+	_ = config.GddMemProfile.Write("local")
 	_ = config.GddMemSeed.Write("")
 	_ = config.GddServiceName.Write("seed")
 	_ = config.GddMemName.Write("seed")
@@ -132,3 +136,154 @@ func Test_registry_Discover2(t *testing.T) {
 	nodes, _ := node.Discover("testsvc_discover1")
 	require.NotEmpty(t, nodes)
 }
+
+func TestNode_BaseUrl(t *testing.T) {
+	node := &Node{
+		memberNode: &memberlist.Node{
+			Addr: "127.0.0.1",
+		},
+	}
+	node.mmeta.Meta = nodeMeta{
+		Port:          6060,
+		RouteRootPath: "/api",
+	}
+	require.Equal(t, "http://127.0.0.1:6060/api", node.BaseUrl())
+	node.mmeta.Meta.Scheme = "https"
+	require.Equal(t, "https://127.0.0.1:6060/api", node.BaseUrl())
+}
+
+func TestNode_HealthCheck(t *testing.T) {
+	require.NoError(t, seed.HealthCheck(context.Background()))
+
+	_ = config.GddMemSeed.Write(seed.memberNode.Address())
+	_ = config.GddServiceName.Write("testsvc_health")
+	_ = config.GddMemName.Write("testnode_health")
+	_ = config.GddMemHost.Write("")
+	_ = config.GddMemPort.Write("57899")
+	_ = config.GddPort.Write("6060")
+	node, err := NewNode()
+	require.NoError(t, err)
+	require.NoError(t, node.HealthCheck(context.Background()))
+	node.Leave(time.Second)
+	require.Error(t, node.HealthCheck(context.Background()))
+	node.Shutdown()
+	require.Error(t, node.HealthCheck(context.Background()))
+}
+
+func TestNode_UpdateMeta(t *testing.T) {
+	_ = config.GddMemSeed.Write(seed.memberNode.Address())
+	_ = config.GddServiceName.Write("testsvc_updatemeta")
+	_ = config.GddMemName.Write("testnode_updatemeta")
+	_ = config.GddMemHost.Write("")
+	_ = config.GddMemPort.Write("57199")
+	_ = config.GddPort.Write("6060")
+	node, err := NewNode()
+	require.NoError(t, err)
+	defer node.memberlist.Shutdown()
+	require.Equal(t, StatusUp, node.Status())
+	require.Equal(t, DefaultWeight, node.Weight())
+
+	require.NoError(t, node.UpdateMeta(WithWeight(5), WithStatus(StatusDraining), WithTag("zone", "a"), WithTag("canary", "true")))
+	require.NoError(t, node.UpdateMeta(WithTag("canary", "")))
+	require.Equal(t, map[string]string{"zone": "a"}, node.Tags())
+	require.Error(t, node.UpdateMeta(WithWeight(-1)))
+	require.Error(t, node.UpdateMeta(WithTag("big", incompressible(memberlist.MetaMaxSize))))
+	require.Equal(t, 5, node.Weight())
+
+	// nodes of former tests are shut down without leaving, and stay alive in member list until suspicion times out,
+	// so gossip may miss seed. Push/pull state to seed directly
+	_, err = node.memberlist.Join([]string{seed.memberNode.Address()})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		nodes, _ := seed.Discover("testsvc_updatemeta")
+		if len(nodes) != 1 {
+			return false
+		}
+		info := nodes[0].Info()
+		return info.Status == StatusDraining && info.Weight == 5 && info.Tags["zone"] == "a" && nodes[0].Tag("canary") == ""
+	}, 15*time.Second, 100*time.Millisecond)
+
+	require.Error(t, (&Node{remote: true}).UpdateMeta(WithWeight(1)))
+}
+
+func TestNewRemoteNode(t *testing.T) {
+	node, err := NewRemoteNode("usersvc", "https://usersvc.default.svc.cluster.local/api/", WithWeight(3), WithTag("zone", "a"))
+	require.NoError(t, err)
+	require.Equal(t, "https://usersvc.default.svc.cluster.local:443/api", node.BaseUrl())
+	require.Equal(t, 3, node.Weight())
+	require.Equal(t, "a", node.Tag("zone"))
+	require.Equal(t, StatusUp, node.Info().Status)
+	require.Error(t, node.UpdateMeta(WithWeight(1)))
+
+	_, err = NewRemoteNode("usersvc", "usersvc:6060")
+	require.Error(t, err)
+	_, err = NewRemoteNode("usersvc", "http://usersvc:6060", WithWeight(-1))
+	require.Error(t, err)
+}
+
+func Test_parseTags(t *testing.T) {
+	require.Equal(t, map[string]string{"zone": "a", "version": "v2"}, parseTags(" zone=a, version=v2,invalid,=x"))
+	require.Nil(t, parseTags(""))
+}
+
+func Test_newConf(t *testing.T) {
+	profile := config.GddMemProfile.Load()
+	_ = config.GddMemProfile.Write("")
+	defer func() {
+		for _, env := range []interface{ Write(string) error }{config.GddMemProbeInterval, config.GddMemSuspicionMult,
+			config.GddMemSyncInterval, config.GddMemIndirectChecks} {
+			_ = env.Write("")
+		}
+		_ = config.GddMemProfile.Write(profile)
+	}()
+	mconf, err := newConf()
+	require.NoError(t, err)
+	require.Equal(t, memberlist.DefaultWANConfig().ProbeInterval, mconf.ProbeInterval)
+	require.Equal(t, 5*time.Second, mconf.PushPullInterval)
+	require.Equal(t, 30*time.Second, mconf.GossipToTheDeadTime)
+	require.Equal(t, 3*time.Second, mconf.DeadNodeReclaimTime)
+
+	// defaults of go-doudou only apply to wan profile
+	_ = config.GddMemProfile.Write("local")
+	mconf, err = newConf()
+	require.NoError(t, err)
+	local := memberlist.DefaultLocalConfig()
+	require.Equal(t, local.PushPullInterval, mconf.PushPullInterval)
+	require.Equal(t, local.GossipToTheDeadTime, mconf.GossipToTheDeadTime)
+	require.Equal(t, local.DeadNodeReclaimTime, mconf.DeadNodeReclaimTime)
+
+	_ = config.GddMemProfile.Write("LAN")
+	_ = config.GddMemProbeInterval.Write("2s")
+	_ = config.GddMemSuspicionMult.Write("6")
+	_ = config.GddMemSyncInterval.Write("10")
+	_ = config.GddMemIndirectChecks.Write("0")
+	mconf, err = newConf()
+	require.NoError(t, err)
+	lan := memberlist.DefaultLANConfig()
+	require.Equal(t, 2*time.Second, mconf.ProbeInterval)
+	require.Equal(t, lan.ProbeTimeout, mconf.ProbeTimeout)
+	require.Equal(t, lan.GossipNodes, mconf.GossipNodes)
+	require.Equal(t, 6, mconf.SuspicionMult)
+	require.Equal(t, 10*time.Second, mconf.PushPullInterval)
+	require.Equal(t, lan.GossipToTheDeadTime, mconf.GossipToTheDeadTime)
+	require.Equal(t, lan.DeadNodeReclaimTime, mconf.DeadNodeReclaimTime)
+	require.Equal(t, 0, mconf.IndirectChecks)
+
+	invalid := []struct {
+		env   interface{ Write(string) error }
+		value string
+	}{
+		{config.GddMemProfile, "moon"},
+		{config.GddMemProbeInterval, "fast"},
+		{config.GddMemProbeTimeout, "10s"},
+		{config.GddMemSuspicionMult, "0"},
+		{config.GddMemGossipNodes, "many"},
+		{config.GddMemSyncInterval, "-1"},
+	}
+	for _, item := range invalid {
+		_ = item.env.Write(item.value)
+		_, err = newConf()
+		require.Error(t, err, item.value)
+		_ = item.env.Write("")
+	}
+}
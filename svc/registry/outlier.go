@@ -0,0 +1,190 @@
+package registry
+
+import (
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+	"github.com/unionj-cloud/cast"
+	"github.com/unionj-cloud/go-doudou/stringutils"
+	"github.com/unionj-cloud/go-doudou/svc/config"
+	"sync"
+	"time"
+)
+
+var (
+	ejectionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_client_host_ejections_total",
+		Help: "Number of ejections of the host from load balancing.",
+	}, []string{"host"})
+	ejectedDesc = prometheus.NewDesc("http_client_host_ejected",
+		"Whether the host is ejected from load balancing for consecutive failures, 1 if ejected.", []string{"host"}, nil)
+)
+
+const (
+	defaultOutlierErrors     = 5
+	defaultOutlierBackoff    = 30 * time.Second
+	defaultOutlierMaxBackoff = 5 * time.Minute
+)
+
+type hostHealth struct {
+	// failures is the number of consecutive failures
+	failures int
+	// ejections is the number of ejections in a row, reset by a success after ejection
+	ejections    int
+	ejectedUntil time.Time
+}
+
+// outlierDetector tracks results of requests sent by clients by host, and ejects hosts with consecutive
+// failures from load balancing for a backoff period
+type outlierDetector struct {
+	errors     int
+	latency    time.Duration
+	backoff    time.Duration
+	maxBackoff time.Duration
+	lock       sync.Mutex
+	hosts      map[string]*hostHealth
+	now        func() time.Time
+}
+
+func parseDuration(env string, value string, def time.Duration) time.Duration {
+	if stringutils.IsEmpty(value) {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		logrus.Warnf("Parse %s %s as time.Duration failed: %s, use default %s instead.\n", env, value, err.Error(), def)
+		return def
+	}
+	return d
+}
+
+func newOutlierDetector() *outlierDetector {
+	d := &outlierDetector{
+		errors:     defaultOutlierErrors,
+		latency:    parseDuration(config.GddOutlierLatency.String(), config.GddOutlierLatency.Load(), 0),
+		backoff:    parseDuration(config.GddOutlierBackoff.String(), config.GddOutlierBackoff.Load(), defaultOutlierBackoff),
+		maxBackoff: parseDuration(config.GddOutlierMaxBackoff.String(), config.GddOutlierMaxBackoff.Load(), defaultOutlierMaxBackoff),
+		hosts:      make(map[string]*hostHealth),
+		now:        time.Now,
+	}
+	if errors := config.GddOutlierErrors.Load(); stringutils.IsNotEmpty(errors) {
+		d.errors = cast.ToInt(errors)
+	}
+	if d.maxBackoff < d.backoff {
+		d.maxBackoff = d.backoff
+	}
+	return d
+}
+
+// observe records result of a request sent to host
+func (d *outlierDetector) observe(host string, failed bool, latency time.Duration) {
+	if d.errors <= 0 {
+		return
+	}
+	if d.latency > 0 && latency > d.latency {
+		failed = true
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	h, ok := d.hosts[host]
+	if !ok {
+		if !failed {
+			return
+		}
+		h = &hostHealth{}
+		d.hosts[host] = h
+	}
+	now := d.now()
+	if !failed {
+		h.failures = 0
+		if !now.Before(h.ejectedUntil) {
+			// the host recovered, forget it
+			delete(d.hosts, host)
+		}
+		return
+	}
+	h.failures++
+	if h.failures < d.errors || now.Before(h.ejectedUntil) {
+		return
+	}
+	backoff := d.backoff << uint(h.ejections)
+	if backoff > d.maxBackoff || backoff <= 0 {
+		backoff = d.maxBackoff
+	}
+	h.ejections++
+	h.failures = 0
+	h.ejectedUntil = now.Add(backoff)
+	ejectionsTotal.WithLabelValues(host).Inc()
+	logrus.Warnf("Host %s is ejected for %s after %d consecutive failures\n", host, backoff, d.errors)
+}
+
+// ejectedUntil returns end time of ejection of host, zero if it is not ejected
+func (d *outlierDetector) ejectedUntil(host string) time.Time {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	h, ok := d.hosts[host]
+	if !ok || !d.now().Before(h.ejectedUntil) {
+		return time.Time{}
+	}
+	return h.ejectedUntil
+}
+
+// Describe implements prometheus.Collector
+func (d *outlierDetector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- ejectedDesc
+}
+
+// Collect implements prometheus.Collector. Hosts ever ejected are reported until they recovered
+func (d *outlierDetector) Collect(ch chan<- prometheus.Metric) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	now := d.now()
+	for host, h := range d.hosts {
+		if h.ejections == 0 {
+			continue
+		}
+		var value float64
+		if now.Before(h.ejectedUntil) {
+			value = 1
+		}
+		ch <- prometheus.MustNewConstMetric(ejectedDesc, prometheus.GaugeValue, value, host)
+	}
+}
+
+var (
+	outlierOnce     sync.Once
+	defaultDetector *outlierDetector
+)
+
+func outliers() *outlierDetector {
+	outlierOnce.Do(func() {
+		defaultDetector = newOutlierDetector()
+		prometheus.MustRegister(defaultDetector)
+	})
+	return defaultDetector
+}
+
+// ObserveResult records result of a request sent to host as address:port for passive health checking.
+// Requests failed without response, with 5xx status code or slower than GDD_OUTLIER_LATENCY are failures.
+// Hosts with GDD_OUTLIER_ERRORS consecutive failures are ejected from load balancing for a backoff period.
+// It is called by clients created by ddhttp.NewClient
+func ObserveResult(host string, failed bool, latency time.Duration) {
+	outliers().observe(host, failed, latency)
+}
+
+// Ejected reports whether the node is ejected for consecutive failures of requests sent by this process
+func (n *Node) Ejected() bool {
+	return !outliers().ejectedUntil(n.Address()).IsZero()
+}
+
+// Suspect reports whether the node hasn't answered probes of local node within GDD_MEM_SUSPECT_TIMEOUT,
+// so that it is likely to be suspected to be dead by memberlist
+func (n *Node) Suspect() bool {
+	return n.probes != nil && n.memberNode != nil && n.probes.suspect(n.memberNode.Name)
+}
+
+// Address returns address:port of the http server of the node
+func (n *Node) Address() string {
+	return fmt.Sprintf("%s:%d", n.memberNode.Addr, n.meta().Meta.Port)
+}
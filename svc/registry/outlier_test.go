@@ -0,0 +1,81 @@
+package registry
+
+import (
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/unionj-cloud/go-doudou/svc/config"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOutlierDetector(t *testing.T) {
+	_ = config.GddOutlierErrors.Write("3")
+	_ = config.GddOutlierLatency.Write("1s")
+	_ = config.GddOutlierBackoff.Write("10s")
+	_ = config.GddOutlierMaxBackoff.Write("15s")
+	defer func() {
+		for _, env := range []string{config.GddOutlierErrors.String(), config.GddOutlierLatency.String(),
+			config.GddOutlierBackoff.String(), config.GddOutlierMaxBackoff.String()} {
+			os.Unsetenv(env)
+		}
+	}()
+	d := newOutlierDetector()
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	d.now = func() time.Time { return now }
+
+	d.observe("a:80", false, time.Millisecond)
+	assert.Empty(t, d.hosts)
+	d.observe("a:80", true, time.Millisecond)
+	d.observe("a:80", true, time.Millisecond)
+	d.observe("a:80", false, time.Millisecond)
+	d.observe("a:80", true, time.Millisecond)
+	d.observe("a:80", true, time.Millisecond)
+	assert.True(t, d.ejectedUntil("a:80").IsZero())
+	// slow response counts as failure
+	d.observe("a:80", false, 2*time.Second)
+	assert.Equal(t, now.Add(10*time.Second), d.ejectedUntil("a:80"))
+	assert.NoError(t, testutil.CollectAndCompare(d, strings.NewReader(`
+# HELP http_client_host_ejected Whether the host is ejected from load balancing for consecutive failures, 1 if ejected.
+# TYPE http_client_host_ejected gauge
+http_client_host_ejected{host="a:80"} 1
+`)))
+
+	now = now.Add(10 * time.Second)
+	assert.True(t, d.ejectedUntil("a:80").IsZero())
+	assert.NoError(t, testutil.CollectAndCompare(d, strings.NewReader(`
+# HELP http_client_host_ejected Whether the host is ejected from load balancing for consecutive failures, 1 if ejected.
+# TYPE http_client_host_ejected gauge
+http_client_host_ejected{host="a:80"} 0
+`)))
+	// ejected again in a row, backoff doubled but limited by max backoff
+	for i := 0; i < 3; i++ {
+		d.observe("a:80", true, time.Millisecond)
+	}
+	assert.Equal(t, now.Add(15*time.Second), d.ejectedUntil("a:80"))
+
+	// recovered after ejection
+	now = now.Add(15 * time.Second)
+	d.observe("a:80", false, time.Millisecond)
+	assert.Empty(t, d.hosts)
+
+	d.errors = 0
+	for i := 0; i < 3; i++ {
+		d.observe("b:80", true, time.Millisecond)
+	}
+	assert.Empty(t, d.hosts)
+}
+
+func TestNode_Ejected(t *testing.T) {
+	node, err := NewRemoteNode("testsvc", "http://ejected:6060")
+	assert.NoError(t, err)
+	assert.Equal(t, "ejected:6060", node.Address())
+	for i := 0; i < defaultOutlierErrors; i++ {
+		ObserveResult(node.Address(), true, time.Millisecond)
+	}
+	assert.True(t, node.Ejected())
+	info := node.Info()
+	assert.True(t, info.Ejected)
+	assert.Equal(t, "ejected", info.Status)
+}
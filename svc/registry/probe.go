@@ -0,0 +1,105 @@
+package registry
+
+import (
+	"github.com/pkg/errors"
+	"github.com/unionj-cloud/go-doudou/stringutils"
+	"github.com/unionj-cloud/go-doudou/svc/config"
+	"github.com/unionj-cloud/memberlist"
+	"strings"
+	"sync"
+	"time"
+)
+
+// suspectTimeout parses GDD_MEM_SUSPECT_TIMEOUT. Empty value returns zero for computing timeout by cluster size,
+// and 0 returns negative value for disabling suspicion
+func suspectTimeout() (time.Duration, error) {
+	if stringutils.IsEmpty(strings.TrimSpace(config.GddMemSuspectTimeout.Load())) {
+		return 0, nil
+	}
+	timeout, err := memDuration(config.GddMemSuspectTimeout, 0)
+	if err != nil {
+		return 0, err
+	}
+	if timeout < 0 {
+		return 0, errors.Errorf("%s should not be negative, got %s", config.GddMemSuspectTimeout, timeout)
+	}
+	if timeout == 0 {
+		return -1, nil
+	}
+	return timeout, nil
+}
+
+// probeTracker records the last time each node answered a direct probe of local node. memberlist doesn't
+// expose suspicion of nodes, so a node without successful probe for a while is regarded as suspect
+type probeTracker struct {
+	lock sync.RWMutex
+	last map[string]time.Time
+	// timeout is GDD_MEM_SUSPECT_TIMEOUT, negative disables suspicion, zero means computed by cluster size
+	timeout  time.Duration
+	interval time.Duration
+	numNodes func() int
+	now      func() time.Time
+}
+
+func newProbeTracker(timeout, interval time.Duration, numNodes func() int) *probeTracker {
+	return &probeTracker{
+		last:     make(map[string]time.Time),
+		timeout:  timeout,
+		interval: interval,
+		numNodes: numNodes,
+		now:      time.Now,
+	}
+}
+
+// seen records node of name is alive. Joined nodes are seen as well, so that they are not suspected before
+// they are probed at the first time
+func (p *probeTracker) seen(name string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.last[name] = p.now()
+}
+
+func (p *probeTracker) forget(name string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	delete(p.last, name)
+}
+
+// suspectTimeout returns the configured timeout, or twice the time local node takes to probe all nodes
+// in a round-robin manner
+func (p *probeTracker) suspectTimeout() time.Duration {
+	if p.timeout != 0 {
+		return p.timeout
+	}
+	n := 1
+	if p.numNodes != nil {
+		if n = p.numNodes(); n < 1 {
+			n = 1
+		}
+	}
+	return 2 * time.Duration(n) * p.interval
+}
+
+// suspect reports whether node of name hasn't answered probes within the suspect timeout.
+// Unknown nodes such as local node are never suspected
+func (p *probeTracker) suspect(name string) bool {
+	timeout := p.suspectTimeout()
+	if timeout <= 0 {
+		return false
+	}
+	p.lock.RLock()
+	last, ok := p.last[name]
+	p.lock.RUnlock()
+	return ok && p.now().Sub(last) > timeout
+}
+
+// AckPayload implements memberlist.PingDelegate, no payload is attached to acks
+func (p *probeTracker) AckPayload() []byte {
+	return nil
+}
+
+// NotifyPingComplete implements memberlist.PingDelegate. It is called on acks of direct probes only,
+// nodes answering indirect probes only are regarded as suspect as well
+func (p *probeTracker) NotifyPingComplete(other *memberlist.Node, rtt time.Duration, payload []byte) {
+	p.seen(other.Name)
+}
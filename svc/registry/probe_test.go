@@ -0,0 +1,86 @@
+package registry
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/svc/config"
+	"github.com/unionj-cloud/memberlist"
+	"os"
+	"testing"
+	"time"
+)
+
+func Test_suspectTimeout(t *testing.T) {
+	defer os.Unsetenv(config.GddMemSuspectTimeout.String())
+	for value, want := range map[string]time.Duration{"": 0, "0": -1, "10": 10 * time.Second, "500ms": 500 * time.Millisecond} {
+		_ = config.GddMemSuspectTimeout.Write(value)
+		timeout, err := suspectTimeout()
+		require.NoError(t, err)
+		assert.Equal(t, want, timeout)
+	}
+	for _, value := range []string{"-1s", "abc"} {
+		_ = config.GddMemSuspectTimeout.Write(value)
+		_, err := suspectTimeout()
+		assert.Error(t, err)
+	}
+}
+
+func TestNode_Suspect(t *testing.T) {
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	probes := newProbeTracker(0, time.Second, func() int { return 3 })
+	probes.now = func() time.Time { return now }
+	local := &Node{
+		registry: &registry{
+			memberConf: &memberlist.Config{Name: "local"},
+			services:   newServiceCache(),
+		},
+		probes: probes,
+	}
+	local.services.probes = probes
+	e := eventDelegate{local}
+	meta, _ := json.Marshal(mergedMeta{Meta: nodeMeta{Service: "probesvc", Port: 6060}})
+	for _, name := range []string{"local", "probe1", "probe2"} {
+		e.NotifyJoin(&memberlist.Node{Name: name, Addr: "127.0.0.1", Meta: meta})
+	}
+	find := func(name string) *Node {
+		for _, node := range local.services.discover("probesvc") {
+			if node.memberNode.Name == name {
+				return node
+			}
+		}
+		t.Fatalf("node %s not found", name)
+		return nil
+	}
+
+	// joined nodes are not suspected before probed
+	now = now.Add(6 * time.Second)
+	assert.False(t, find("probe1").Suspect())
+	probes.NotifyPingComplete(&memberlist.Node{Name: "probe1"}, time.Millisecond, nil)
+	now = now.Add(time.Millisecond)
+	assert.False(t, find("probe1").Suspect())
+	assert.True(t, find("probe2").Suspect())
+	assert.Equal(t, "suspect", find("probe2").Info().Status)
+	// local node is never probed
+	assert.False(t, find("local").Suspect())
+
+	// answering probes again clears suspicion
+	probes.NotifyPingComplete(&memberlist.Node{Name: "probe2"}, time.Millisecond, nil)
+	assert.False(t, find("probe2").Suspect())
+
+	// timeout grows with the cluster
+	now = now.Add(7 * time.Second)
+	probes.numNodes = func() int { return 4 }
+	assert.False(t, find("probe1").Suspect())
+	probes.timeout = 5 * time.Second
+	assert.True(t, find("probe1").Suspect())
+	probes.timeout = -1
+	assert.False(t, find("probe1").Suspect())
+
+	e.NotifyLeave(&memberlist.Node{Name: "probe1", Meta: meta})
+	assert.NotContains(t, probes.last, "probe1")
+
+	node, err := NewRemoteNode("probesvc", "http://probe3:6060")
+	require.NoError(t, err)
+	assert.False(t, node.Suspect())
+}
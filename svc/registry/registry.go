@@ -0,0 +1,121 @@
+package registry
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/unionj-cloud/go-doudou/stringutils"
+	"github.com/unionj-cloud/go-doudou/svc/config"
+	"github.com/unionj-cloud/go-doudou/svc/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// BackendMemberlist is the default registry backend, nodes discover each other by gossip protocol
+	BackendMemberlist = "memberlist"
+	// BackendFile reads nodes of services from a yaml file, which is reloaded on change
+	BackendFile = "file"
+	// BackendDns resolves nodes of services from DNS SRV or A records, such as headless services of kubernetes
+	BackendDns = "dns"
+)
+
+const defaultRefreshInterval = 10 * time.Second
+
+// Default is the registry created by NewRegistry or NewNode
+var Default IRegistry
+
+// NewRegistry creates registry of backend selected by GDD_REGISTRY. NodeOption is only applied to memberlist backend,
+// except WithLifecycle, which stops refreshing of file and dns backends on shutdown as well
+func NewRegistry(opts ...NodeOption) (IRegistry, error) {
+	var (
+		reg IRegistry
+		err error
+	)
+	switch backend := strings.ToLower(config.GddRegistry.Load()); backend {
+	case "", BackendMemberlist:
+		return NewNode(opts...)
+	case BackendFile:
+		file := config.GddRegistryFile.Load()
+		if stringutils.IsEmpty(file) {
+			file = "registry.yaml"
+		}
+		reg, err = NewFileRegistry(file)
+	case BackendDns:
+		reg, err = NewDnsRegistry(config.GddRegistryDnsName.Load())
+	default:
+		return nil, errors.Errorf("NewRegistry() error: unknown %s %s, should be one of %s, %s and %s",
+			config.GddRegistry, backend, BackendMemberlist, BackendFile, BackendDns)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "NewRegistry() error")
+	}
+	node := &Node{}
+	for _, opt := range opts {
+		opt(node)
+	}
+	if s, ok := reg.(interface{ Shutdown() }); ok && node.lifecycle != nil {
+		node.lifecycle.OnShutdown(func(ctx context.Context) error {
+			s.Shutdown()
+			return nil
+		})
+	}
+	Default = reg
+	return reg, nil
+}
+
+// Discover calls reg.Discover in a span as child of the span in ctx, so that slow discovery such as resolving DNS
+// shows up in the trace of the request
+func Discover(ctx context.Context, reg IRegistry, svc string) ([]*Node, error) {
+	_, span := tracing.Start(ctx, "registry.Discover", trace.WithAttributes(attribute.String("registry.service", svc)))
+	defer span.End()
+	nodes, err := reg.Discover(svc)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("registry.nodes", len(nodes)))
+	return nodes, nil
+}
+
+func refreshInterval() time.Duration {
+	return parseDuration(config.GddRegistryRefresh.String(), config.GddRegistryRefresh.Load(), defaultRefreshInterval)
+}
+
+// refresher calls refresh periodically until it is stopped
+type refresher struct {
+	once sync.Once
+	done chan struct{}
+}
+
+func (r *refresher) start(interval time.Duration, refresh func()) {
+	r.done = make(chan struct{})
+	if interval <= 0 {
+		logrus.Warnf("%s should be positive, got %s, registry will not be refreshed\n", config.GddRegistryRefresh, interval)
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				refresh()
+			case <-r.done:
+				return
+			}
+		}
+	}()
+}
+
+// Shutdown stops refreshing the registry
+func (r *refresher) Shutdown() {
+	r.once.Do(func() {
+		close(r.done)
+	})
+}
@@ -0,0 +1,95 @@
+package registry
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/svc/config"
+	"github.com/unionj-cloud/go-doudou/svc/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type fakeLifecycle struct {
+	hooks []func(ctx context.Context) error
+}
+
+func (l *fakeLifecycle) OnShutdown(hooks ...func(ctx context.Context) error) {
+	l.hooks = append(l.hooks, hooks...)
+}
+
+func TestNewRegistry(t *testing.T) {
+	defer config.GddRegistry.Write("")
+	defer config.GddRegistryFile.Write("")
+	dir, err := ioutil.TempDir("", "registry")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "registry.yaml")
+	require.NoError(t, ioutil.WriteFile(file, []byte("usersvc:\n  - http://10.0.0.1:6060\n"), 0644))
+
+	config.GddRegistry.Write("file")
+	config.GddRegistryFile.Write(file)
+	reg, err := NewRegistry()
+	require.NoError(t, err)
+	defer reg.(*FileRegistry).Shutdown()
+	assert.Equal(t, reg, Default)
+	nodes, err := reg.Discover("usersvc")
+	require.NoError(t, err)
+	assert.Len(t, nodes, 1)
+
+	config.GddRegistry.Write("DNS")
+	lifecycle := &fakeLifecycle{}
+	reg, err = NewRegistry(WithLifecycle(lifecycle))
+	require.NoError(t, err)
+	require.Len(t, lifecycle.hooks, 1)
+	require.NoError(t, lifecycle.hooks[0](context.Background()))
+	select {
+	case <-reg.(*DnsRegistry).done:
+	default:
+		t.Error("refresher is not stopped on shutdown")
+	}
+
+	config.GddRegistry.Write("consul")
+	_, err = NewRegistry()
+	assert.Error(t, err)
+}
+
+func TestDiscover(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracing.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer tracing.SetTracerProvider(nil)
+
+	r, err := NewDnsRegistry("")
+	require.NoError(t, err)
+	defer r.Shutdown()
+	r.lookupSRV = func(service, proto, name string) (string, []*net.SRV, error) {
+		return "", nil, assert.AnError
+	}
+	r.lookupHost = func(host string) ([]string, error) {
+		if host == "usersvc" {
+			return []string{"10.0.0.1"}, nil
+		}
+		return nil, assert.AnError
+	}
+	ctx, parent := tracing.Start(context.Background(), "GetUser")
+	nodes, err := Discover(ctx, r, "usersvc")
+	require.NoError(t, err)
+	assert.Len(t, nodes, 1)
+	_, err = Discover(ctx, r, "ordersvc")
+	assert.Error(t, err)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "registry.Discover", spans[0].Name())
+	assert.Equal(t, parent.SpanContext().SpanID(), spans[0].Parent().SpanID())
+	assert.Contains(t, spans[0].Attributes(), attribute.Int("registry.nodes", 1))
+	assert.Contains(t, spans[1].Attributes(), attribute.String("registry.service", "ordersvc"))
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+}
@@ -0,0 +1,259 @@
+package registry
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/unionj-cloud/go-doudou/stringutils"
+	"github.com/unionj-cloud/memberlist"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxStateMessageSize limits size of an encoded state entry, so that it fits in a single gossip udp packet
+const maxStateMessageSize = 1024
+
+// StateEntry is a versioned value of a topic in cluster state
+type StateEntry struct {
+	Topic   string `json:"topic"`
+	Payload []byte `json:"payload"`
+	// Version is a lamport clock value. Entry with greater version wins
+	Version uint64 `json:"version"`
+	// Node is name of the node which broadcast the entry, used for breaking tie of versions
+	Node string `json:"node"`
+	// Start is start time in unix nanoseconds of the node which broadcast the entry. Clock of a restarted node
+	// starts over, so its entries win over those of its previous run by it rather than by version
+	Start int64 `json:"start,omitempty"`
+}
+
+// newer reports whether e should replace other
+func (e StateEntry) newer(other StateEntry) bool {
+	if e.Node == other.Node && e.Start != other.Start {
+		return e.Start > other.Start
+	}
+	if e.Version != other.Version {
+		return e.Version > other.Version
+	}
+	if e.Start != other.Start {
+		return e.Start > other.Start
+	}
+	return e.Node > other.Node
+}
+
+// Subscriber is called with the new entry when value of the subscribed topic changed
+type Subscriber func(entry StateEntry)
+
+type stateBroadcast struct {
+	topic string
+	msg   []byte
+}
+
+// Invalidates drops queued broadcast of the same topic, as it has been outdated
+func (b *stateBroadcast) Invalidates(other memberlist.Broadcast) bool {
+	if ob, ok := other.(*stateBroadcast); ok {
+		return b.topic == ob.topic
+	}
+	return false
+}
+
+// Message returns encoded state entry
+func (b *stateBroadcast) Message() []byte {
+	return b.msg
+}
+
+// Finished is called when the broadcast is no longer queued
+func (b *stateBroadcast) Finished() {
+}
+
+// clusterState is a key/value store replicated by gossip broadcasts and push/pull state sync of memberlist
+type clusterState struct {
+	lock  sync.RWMutex
+	clock uint64
+	// start is start time of local node, set to Start of local entries
+	start       int64
+	entries     map[string]StateEntry
+	subLock     sync.RWMutex
+	subscribers map[string][]Subscriber
+}
+
+func newClusterState() *clusterState {
+	return &clusterState{
+		start:       time.Now().UnixNano(),
+		entries:     make(map[string]StateEntry),
+		subscribers: make(map[string][]Subscriber),
+	}
+}
+
+// next returns version for a new local entry
+func (s *clusterState) next(topic, node string, payload []byte) StateEntry {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.clock++
+	entry := StateEntry{
+		Topic:   topic,
+		Payload: payload,
+		Version: s.clock,
+		Node:    node,
+		Start:   s.start,
+	}
+	s.entries[topic] = entry
+	return entry
+}
+
+// apply stores entry if it is newer than the stored one and reports whether it is stored
+func (s *clusterState) apply(entry StateEntry) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if entry.Version > s.clock {
+		s.clock = entry.Version
+	}
+	if old, ok := s.entries[entry.Topic]; ok && !entry.newer(old) {
+		return false
+	}
+	s.entries[entry.Topic] = entry
+	return true
+}
+
+// remove deletes entry of topic
+func (s *clusterState) remove(topic string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.entries, topic)
+}
+
+func (s *clusterState) get(topic string) (StateEntry, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	entry, ok := s.entries[topic]
+	return entry, ok
+}
+
+// snapshot returns all entries sorted by topic
+func (s *clusterState) snapshot() []StateEntry {
+	s.lock.RLock()
+	entries := make([]StateEntry, 0, len(s.entries))
+	for _, entry := range s.entries {
+		entries = append(entries, entry)
+	}
+	s.lock.RUnlock()
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Topic < entries[j].Topic
+	})
+	return entries
+}
+
+func (s *clusterState) subscribe(topic string, fn Subscriber) {
+	s.subLock.Lock()
+	defer s.subLock.Unlock()
+	s.subscribers[topic] = append(s.subscribers[topic], fn)
+}
+
+// notify calls subscribers of the topic. Panics of subscribers are recovered,
+// so that they cannot break gossip goroutines of memberlist
+func (s *clusterState) notify(entry StateEntry) {
+	s.subLock.RLock()
+	subscribers := append([]Subscriber(nil), s.subscribers[entry.Topic]...)
+	s.subLock.RUnlock()
+	for _, fn := range subscribers {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					logrus.Errorf("Subscriber of topic %s panicked: %v\n", entry.Topic, r)
+				}
+			}()
+			fn(entry)
+		}()
+	}
+}
+
+func encodeEntry(entry StateEntry) ([]byte, error) {
+	msg, err := json.Marshal(entry)
+	if err != nil {
+		return nil, errors.Wrap(err, "encode state entry failed")
+	}
+	return msg, nil
+}
+
+// Broadcast sets payload as value of topic and spreads it to all nodes in the cluster. Nodes missing the broadcast
+// will receive it by periodical state sync. Payload should be small, such as config flags and feature toggles
+func (n *Node) Broadcast(topic string, payload []byte) error {
+	if stringutils.IsEmpty(topic) {
+		return errors.New("topic should not be empty")
+	}
+	if strings.HasPrefix(topic, dataTopicPrefix) {
+		return errors.Errorf("topic prefix %s is reserved for data of nodes", dataTopicPrefix)
+	}
+	if n.registry == nil || n.state == nil || n.broadcasts == nil {
+		return errors.New("broadcast is only supported by local node")
+	}
+	entry := StateEntry{
+		Topic:   topic,
+		Payload: payload,
+		Node:    n.memberNode.Name,
+		Start:   n.state.start,
+	}
+	msg, err := encodeEntry(entry)
+	if err != nil {
+		return err
+	}
+	// version is at most 20 digits, reserve space for it
+	if len(msg)+20 > maxStateMessageSize {
+		return errors.Errorf("message of topic %s exceeds size limit of %d bytes", topic, maxStateMessageSize)
+	}
+	entry = n.state.next(topic, entry.Node, payload)
+	if msg, err = encodeEntry(entry); err != nil {
+		return err
+	}
+	n.broadcasts.QueueBroadcast(&stateBroadcast{
+		topic: topic,
+		msg:   msg,
+	})
+	n.state.notify(entry)
+	return nil
+}
+
+// Subscribe registers fn to be called when value of topic changed, either by local or remote broadcasts
+func (n *Node) Subscribe(topic string, fn Subscriber) {
+	if n.registry == nil || n.state == nil {
+		return
+	}
+	n.state.subscribe(topic, fn)
+}
+
+// State returns the latest value of topic known by local node
+func (n *Node) State(topic string) ([]byte, bool) {
+	if n.registry == nil || n.state == nil {
+		return nil, false
+	}
+	entry, ok := n.state.get(topic)
+	return entry.Payload, ok
+}
+
+// mergeEntry applies entry received from remote node. New entries are notified to subscribers and rebroadcast,
+// so that they spread even if the original broadcast didn't reach every node
+func (n *Node) mergeEntry(entry StateEntry, rebroadcast bool) {
+	if strings.HasPrefix(entry.Topic, dataTopicPrefix) {
+		// only the node itself sets its data
+		if dataTopic(entry.Node) != entry.Topic {
+			return
+		}
+		// data of nodes which have left may still be synced from nodes not aware of it yet
+		if n.services != nil && !n.services.known(entry.Node) {
+			return
+		}
+	}
+	if !n.state.apply(entry) {
+		return
+	}
+	if rebroadcast && n.broadcasts != nil {
+		if msg, err := encodeEntry(entry); err == nil {
+			n.broadcasts.QueueBroadcast(&stateBroadcast{
+				topic: entry.Topic,
+				msg:   msg,
+			})
+		}
+	}
+	n.state.notify(entry)
+}
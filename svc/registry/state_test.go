@@ -0,0 +1,158 @@
+package registry
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/memberlist"
+	"strings"
+	"testing"
+)
+
+func newStateNode(name string) *Node {
+	n := &Node{
+		memberNode: &memberlist.Node{Name: name},
+		registry: &registry{
+			state: newClusterState(),
+		},
+	}
+	n.broadcasts = &memberlist.TransmitLimitedQueue{
+		NumNodes: func() int {
+			return 2
+		},
+		RetransmitMult: 3,
+	}
+	return n
+}
+
+func TestNode_Broadcast(t *testing.T) {
+	a := newStateNode("a")
+	b := newStateNode("b")
+	var received []StateEntry
+	b.Subscribe("flag", func(entry StateEntry) {
+		received = append(received, entry)
+	})
+	b.Subscribe("flag", func(entry StateEntry) {
+		panic("subscriber panics")
+	})
+
+	require.NoError(t, a.Broadcast("flag", []byte("on")))
+	payload, ok := a.State("flag")
+	assert.True(t, ok)
+	assert.Equal(t, "on", string(payload))
+
+	msgs := (&delegate{a}).GetBroadcasts(0, 1400)
+	require.Len(t, msgs, 1)
+	assert.NotPanics(t, func() {
+		(&delegate{b}).NotifyMsg(msgs[0])
+	})
+	require.Len(t, received, 1)
+	assert.Equal(t, "a", received[0].Node)
+	assert.Equal(t, uint64(1), received[0].Version)
+	// new entry is rebroadcast by b
+	assert.Equal(t, 1, b.broadcasts.NumQueued())
+
+	// duplicated message is ignored
+	(&delegate{b}).NotifyMsg(msgs[0])
+	assert.Len(t, received, 1)
+	assert.Equal(t, 1, b.broadcasts.NumQueued())
+
+	// b saw version 1, so its broadcast overrides the one of a
+	require.NoError(t, b.Broadcast("flag", []byte("off")))
+	assert.Equal(t, uint64(2), received[1].Version)
+	(&delegate{a}).NotifyMsg(b.broadcasts.GetBroadcasts(0, 1400)[0])
+	payload, _ = a.State("flag")
+	assert.Equal(t, "off", string(payload))
+
+	assert.Error(t, a.Broadcast("", nil))
+	assert.Error(t, a.Broadcast(dataTopic("a"), nil))
+	assert.Error(t, a.Broadcast("big", []byte(strings.Repeat("a", maxStateMessageSize))))
+	assert.Error(t, (&Node{}).Broadcast("flag", nil))
+}
+
+func TestDelegate_MergeRemoteState(t *testing.T) {
+	a := newStateNode("a")
+	b := newStateNode("b")
+	require.NoError(t, a.Broadcast("x", []byte("1")))
+	require.NoError(t, a.Broadcast("y", []byte("1")))
+	require.NoError(t, b.Broadcast("y", []byte("2")))
+	require.NoError(t, b.Broadcast("y", []byte("3")))
+	require.NoError(t, b.Broadcast("z", []byte("1")))
+
+	var topics []string
+	a.Subscribe("y", func(entry StateEntry) {
+		topics = append(topics, entry.Topic)
+	})
+	a.Subscribe("z", func(entry StateEntry) {
+		topics = append(topics, entry.Topic)
+	})
+
+	(&delegate{b}).MergeRemoteState((&delegate{a}).LocalState(false), false)
+	(&delegate{a}).MergeRemoteState((&delegate{b}).LocalState(false), false)
+	assert.Equal(t, []string{"y", "z"}, topics)
+	assert.Equal(t, a.state.snapshot(), b.state.snapshot())
+	payload, _ := a.State("y")
+	assert.Equal(t, "3", string(payload))
+	payload, _ = b.State("x")
+	assert.Equal(t, "1", string(payload))
+
+	// tie of versions is broken by node name
+	entry := StateEntry{Topic: "t", Payload: []byte("a"), Version: 10, Node: "a"}
+	assert.True(t, StateEntry{Topic: "t", Version: 10, Node: "b"}.newer(entry))
+	assert.False(t, entry.newer(entry))
+	// tie of versions from different nodes is broken by start time before node name
+	assert.True(t, StateEntry{Topic: "t", Version: 10, Node: "a", Start: 1}.newer(StateEntry{Topic: "t", Version: 10, Node: "b"}))
+	// entries of a restarted node win over those of its previous run regardless of versions
+	assert.True(t, StateEntry{Topic: "t", Version: 1, Node: "a", Start: 2}.newer(StateEntry{Topic: "t", Version: 10, Node: "a", Start: 1}))
+	assert.False(t, StateEntry{Topic: "t", Version: 10, Node: "a", Start: 1}.newer(StateEntry{Topic: "t", Version: 1, Node: "a", Start: 2}))
+
+	assert.NotPanics(t, func() {
+		(&delegate{a}).MergeRemoteState([]byte("invalid"), true)
+	})
+}
+
+func TestNode_DataState(t *testing.T) {
+	a := newStateNode("a")
+	a.services = newServiceCache()
+	meta, _ := json.Marshal(mergedMeta{Meta: nodeMeta{Service: "test"}})
+	b := &memberlist.Node{Name: "b", Meta: meta}
+	eventDelegate{a}.NotifyJoin(b)
+	eventDelegate{a}.NotifyJoin(&memberlist.Node{Name: "d", Meta: meta})
+	entries := []StateEntry{
+		{Topic: dataTopic("b"), Payload: []byte(`"b"`), Version: 1, Node: "b"},
+		{Topic: dataTopic("c"), Payload: []byte(`"c"`), Version: 1, Node: "c"},
+		// d is known, but data of a node is only set by itself
+		{Topic: dataTopic("d"), Payload: []byte(`"forged"`), Version: 1, Node: "b"},
+	}
+	remote, _ := json.Marshal(entries)
+	(&delegate{a}).MergeRemoteState(remote, false)
+	_, ok := a.State(dataTopic("b"))
+	assert.True(t, ok)
+	// c is unknown
+	_, ok = a.State(dataTopic("c"))
+	assert.False(t, ok)
+	_, ok = a.State(dataTopic("d"))
+	assert.False(t, ok)
+
+	eventDelegate{a}.NotifyLeave(b)
+	_, ok = a.State(dataTopic("b"))
+	assert.False(t, ok)
+	// synced back from a node which hasn't seen b leave
+	(&delegate{a}).MergeRemoteState(remote, false)
+	_, ok = a.State(dataTopic("b"))
+	assert.False(t, ok)
+
+	// data of local node is versioned by lamport clock, and wins over data of its previous run
+	a.memberConf = &memberlist.Config{Name: "a"}
+	a.mmeta.Data = strings.Repeat("a", 600)
+	require.NoError(t, a.fitMeta(memberlist.MetaMaxSize))
+	local, ok := a.state.get(dataTopic("a"))
+	require.True(t, ok)
+	assert.Equal(t, a.state.clock, local.Version)
+	eventDelegate{a}.NotifyJoin(&memberlist.Node{Name: "a", Meta: meta})
+	stale, _ := json.Marshal([]StateEntry{{Topic: dataTopic("a"), Payload: []byte(`"stale"`), Version: local.Version + 10,
+		Node: "a", Start: local.Start - 1}})
+	(&delegate{a}).MergeRemoteState(stale, false)
+	payload, _ := a.State(dataTopic("a"))
+	assert.Equal(t, `"`+strings.Repeat("a", 600)+`"`, string(payload))
+}
@@ -62,7 +62,14 @@ func validateDataType(dir string) {
 		logrus.Panicln(err)
 	}
 	for _, file := range files {
-		astutils.BuildStructCollector(file, codegen.ExprStringP)
+		sc := astutils.BuildStructCollector(file, codegen.ExprStringP)
+		for _, structmeta := range sc.Structs {
+			for _, field := range structmeta.Fields {
+				if strings.Contains(field.Type, "chan ") {
+					panic(fmt.Errorf("not support channel as struct field type in vo package: %s.%s", structmeta.Name, field.Name))
+				}
+			}
+		}
 	}
 }
 
@@ -122,11 +129,45 @@ func validateRestApi(ic astutils.InterfaceCollector) {
 		if len(nonBasicTypes) > 1 {
 			panic("Too many golang non-built-in type parameters, can't decide which one should be put into request body!")
 		}
+		for _, param := range method.Params {
+			if strings.Contains(param.Type, "chan ") || param.Type == "io.Reader" || param.Type == "io.ReadCloser" {
+				panic(fmt.Errorf("not support %s as parameter type in method %s", param.Type, method.Name))
+			}
+		}
 		for _, param := range method.Results {
 			if re.MatchString(param.Type) {
 				panic("not support anonymous struct as parameter")
 			}
 		}
+		validateStreamResults(method)
+	}
+}
+
+// validateStreamResults checks results of methods returning io.Reader, io.ReadCloser or channel.
+// Besides error, a method returning io.Reader or io.ReadCloser can only return a string as content type,
+// a method returning channel cannot return anything else
+func validateStreamResults(method astutils.MethodMeta) {
+	var readers, chans, strs, others int
+	for _, result := range method.Results {
+		switch {
+		case result.Type == "error":
+		case result.Type == "io.Reader" || result.Type == "io.ReadCloser":
+			readers++
+		case strings.HasPrefix(result.Type, "<-chan ") || strings.HasPrefix(result.Type, "chan "):
+			chans++
+		case strings.Contains(result.Type, "chan "):
+			panic(fmt.Errorf("not support %s as result type in method %s", result.Type, method.Name))
+		case result.Type == "string":
+			strs++
+		default:
+			others++
+		}
+	}
+	if readers > 0 && (readers > 1 || chans > 0 || strs > 1 || others > 0) {
+		panic(fmt.Errorf("method %s returning stream can only return one more string result as content type besides error", method.Name))
+	}
+	if chans > 0 && (chans > 1 || strs > 0 || others > 0) {
+		panic(fmt.Errorf("method %s returning channel cannot return anything else besides error", method.Name))
 	}
 }
 
@@ -248,3 +248,31 @@ func TestSvc_Run_unwatch(t *testing.T) {
 	s := NewMockSvc("")
 	s.Run(false)
 }
+
+func Test_validateStreamResults(t *testing.T) {
+	method := func(results ...string) astutils.MethodMeta {
+		meta := astutils.MethodMeta{Name: "Stream"}
+		for _, result := range results {
+			meta.Results = append(meta.Results, astutils.FieldMeta{Type: result})
+		}
+		return meta
+	}
+	assert.NotPanics(t, func() {
+		validateStreamResults(method("io.ReadCloser", "string", "error"))
+		validateStreamResults(method("io.Reader", "error"))
+		validateStreamResults(method("<-chan vo.UserVo", "error"))
+		validateStreamResults(method("int", "string", "error"))
+	})
+	assert.Panics(t, func() {
+		validateStreamResults(method("io.ReadCloser", "int", "error"))
+	})
+	assert.Panics(t, func() {
+		validateStreamResults(method("io.Reader", "string", "string", "error"))
+	})
+	assert.Panics(t, func() {
+		validateStreamResults(method("<-chan vo.UserVo", "string", "error"))
+	})
+	assert.Panics(t, func() {
+		validateStreamResults(method("[]chan int", "error"))
+	})
+}
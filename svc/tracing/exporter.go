@@ -0,0 +1,75 @@
+package tracing
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/unionj-cloud/go-doudou/stringutils"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/exporters/zipkin"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"net/url"
+	"strings"
+)
+
+const (
+	// ExporterNone disables exporting, but trace context is still propagated
+	ExporterNone = "none"
+	// ExporterStdout writes spans to stdout as json
+	ExporterStdout = "stdout"
+	// ExporterOtlp sends spans to OpenTelemetry collectors by OTLP over http
+	ExporterOtlp = "otlp"
+	// ExporterZipkin sends spans to zipkin compatible collectors
+	ExporterZipkin = "zipkin"
+)
+
+const (
+	defaultOtlpEndpoint   = "http://localhost:4318/v1/traces"
+	defaultZipkinEndpoint = "http://localhost:9411/api/v2/spans"
+)
+
+// newExporter creates span exporter by name, sending spans to endpoint if needed. It returns nil for ExporterNone
+func newExporter(name, endpoint string) (sdktrace.SpanExporter, error) {
+	switch strings.ToLower(name) {
+	case "", ExporterNone:
+		return nil, nil
+	case ExporterStdout:
+		exporter, err := stdouttrace.New()
+		if err != nil {
+			return nil, errors.Wrap(err, "create stdout exporter failed")
+		}
+		return exporter, nil
+	case ExporterOtlp:
+		if stringutils.IsEmpty(endpoint) {
+			endpoint = defaultOtlpEndpoint
+		}
+		u, err := url.Parse(endpoint)
+		if err != nil || stringutils.IsEmpty(u.Host) {
+			return nil, errors.Errorf("invalid otlp endpoint %s, should be url like %s", endpoint, defaultOtlpEndpoint)
+		}
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(u.Host)}
+		if stringutils.IsNotEmpty(u.Path) {
+			opts = append(opts, otlptracehttp.WithURLPath(u.Path))
+		}
+		if u.Scheme == "http" {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exporter, err := otlptracehttp.New(context.Background(), opts...)
+		if err != nil {
+			return nil, errors.Wrap(err, "create otlp exporter failed")
+		}
+		return exporter, nil
+	case ExporterZipkin:
+		if stringutils.IsEmpty(endpoint) {
+			endpoint = defaultZipkinEndpoint
+		}
+		exporter, err := zipkin.New(endpoint)
+		if err != nil {
+			return nil, errors.Wrap(err, "create zipkin exporter failed")
+		}
+		return exporter, nil
+	default:
+		return nil, errors.Errorf("unknown exporter %s, should be one of %s, %s, %s and %s", name,
+			ExporterNone, ExporterStdout, ExporterOtlp, ExporterZipkin)
+	}
+}
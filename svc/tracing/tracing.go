@@ -0,0 +1,123 @@
+package tracing
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/unionj-cloud/go-doudou/stringutils"
+	"github.com/unionj-cloud/go-doudou/svc/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// InstrumentationName is name of the tracer creating spans of go-doudou
+const InstrumentationName = "github.com/unionj-cloud/go-doudou"
+
+var (
+	providerLock sync.Mutex
+	provider     trace.TracerProvider
+	// propagator propagates W3C trace context and baggage by http headers
+	propagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+)
+
+// NewTracerProvider creates OpenTelemetry tracer provider configured by GDD_TRACING_EXPORTER, GDD_TRACING_ENDPOINT
+// and GDD_TRACING_SAMPLE_RATIO, using GDD_SERVICE_NAME as service name. Root spans are sampled by the ratio,
+// and other spans follow sampling decision of their parents
+func NewTracerProvider() (*sdktrace.TracerProvider, error) {
+	exporter, err := newExporter(config.GddTracingExporter.Load(), config.GddTracingEndpoint.Load())
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid %s", config.GddTracingExporter)
+	}
+	ratio := 1.0
+	if raw := config.GddTracingSampleRatio.Load(); stringutils.IsNotEmpty(raw) {
+		if ratio, err = strconv.ParseFloat(raw, 64); err != nil {
+			return nil, errors.Wrapf(err, "invalid %s %s", config.GddTracingSampleRatio, raw)
+		}
+	}
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceNameKey.String(config.GddServiceName.Load()))),
+	}
+	if exporter != nil {
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	}
+	return sdktrace.NewTracerProvider(opts...), nil
+}
+
+// SetTracerProvider replaces tracer provider used by go-doudou, and registers it as global tracer provider of
+// OpenTelemetry, such as a provider with tracetest.SpanRecorder for testing. Nil tp makes it created from env again
+func SetTracerProvider(tp trace.TracerProvider) {
+	providerLock.Lock()
+	defer providerLock.Unlock()
+	provider = tp
+	if tp != nil {
+		otel.SetTracerProvider(tp)
+	}
+}
+
+// TracerProvider returns tracer provider used by go-doudou. It is created by NewTracerProvider at the first call
+// if not set, and registered as global tracer provider of OpenTelemetry together with W3C trace context propagator,
+// so that spans of other OpenTelemetry instrumented libraries join the same trace
+func TracerProvider() trace.TracerProvider {
+	providerLock.Lock()
+	defer providerLock.Unlock()
+	if provider == nil {
+		tp, err := NewTracerProvider()
+		if err != nil {
+			logrus.Warnf("Create tracer provider failed: %+v, spans won't be exported.\n", err)
+			tp = sdktrace.NewTracerProvider()
+		}
+		provider = tp
+		otel.SetTracerProvider(tp)
+		otel.SetTextMapPropagator(propagator)
+	}
+	return provider
+}
+
+// Tracer returns tracer of go-doudou
+func Tracer() trace.Tracer {
+	return TracerProvider().Tracer(InstrumentationName)
+}
+
+// Start starts a span as child of the span or remote span context in ctx, and returns a copy of ctx carrying the new span
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, name, opts...)
+}
+
+// Extract returns a copy of ctx carrying remote span context from traceparent and tracestate headers
+func Extract(ctx context.Context, header http.Header) context.Context {
+	return propagator.Extract(ctx, propagation.HeaderCarrier(header))
+}
+
+// Inject sets traceparent and tracestate headers from span context in ctx
+func Inject(ctx context.Context, header http.Header) {
+	propagator.Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// Shutdown flushes spans and stops exporting if tracer provider is created by OpenTelemetry sdk
+func Shutdown(ctx context.Context) error {
+	providerLock.Lock()
+	tp, ok := provider.(*sdktrace.TracerProvider)
+	providerLock.Unlock()
+	if !ok {
+		return nil
+	}
+	return errors.WithStack(tp.Shutdown(ctx))
+}
+
+// TraceIDFromContext returns hex encoded trace id from ctx, or empty string if not found
+func TraceIDFromContext(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.TraceID().IsValid() {
+		return ""
+	}
+	return sc.TraceID().String()
+}
@@ -0,0 +1,161 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/svc/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestExtractInject(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer SetTracerProvider(nil)
+
+	header := http.Header{}
+	header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	header.Set("tracestate", "congo=t61rcWkgMzE")
+	ctx := Extract(context.Background(), header)
+	assert.True(t, trace.SpanContextFromContext(ctx).IsRemote())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", TraceIDFromContext(ctx))
+
+	ctx, span := Start(ctx, "GetUser", trace.WithSpanKind(trace.SpanKindServer))
+	out := http.Header{}
+	Inject(ctx, out)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+span.SpanContext().SpanID().String()+"-01", out.Get("traceparent"))
+	assert.Equal(t, "congo=t61rcWkgMzE", out.Get("tracestate"))
+	span.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "GetUser", spans[0].Name())
+	assert.Equal(t, "00f067aa0ba902b7", spans[0].Parent().SpanID().String())
+	assert.Equal(t, InstrumentationName, spans[0].InstrumentationLibrary().Name)
+
+	out = http.Header{}
+	Inject(context.Background(), out)
+	assert.Empty(t, out.Get("traceparent"))
+	assert.Empty(t, TraceIDFromContext(Extract(context.Background(), http.Header{"Traceparent": []string{"invalid"}})))
+	// registered globally for other OpenTelemetry instrumented libraries
+	assert.Equal(t, TracerProvider(), otel.GetTracerProvider())
+}
+
+func TestNewTracerProvider(t *testing.T) {
+	defer func() {
+		os.Unsetenv(config.GddTracingExporter.String())
+		os.Unsetenv(config.GddTracingEndpoint.String())
+		os.Unsetenv(config.GddTracingSampleRatio.String())
+	}()
+	config.GddTracingSampleRatio.Write("0")
+	tp, err := NewTracerProvider()
+	require.NoError(t, err)
+	_, root := tp.Tracer("test").Start(context.Background(), "root")
+	assert.True(t, root.SpanContext().IsValid())
+	assert.False(t, root.SpanContext().IsSampled())
+	// sampled by caller even if ratio is 0
+	ctx := Extract(context.Background(), http.Header{"Traceparent": []string{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}})
+	_, child := tp.Tracer("test").Start(ctx, "child")
+	assert.True(t, child.SpanContext().IsSampled())
+
+	config.GddTracingSampleRatio.Write("all")
+	_, err = NewTracerProvider()
+	assert.Error(t, err)
+	config.GddTracingSampleRatio.Write("1")
+
+	config.GddTracingExporter.Write("unknown")
+	_, err = NewTracerProvider()
+	assert.Error(t, err)
+	config.GddTracingExporter.Write(ExporterOtlp)
+	config.GddTracingEndpoint.Write("localhost:4318")
+	_, err = NewTracerProvider()
+	assert.Error(t, err)
+}
+
+func TestNewExporter(t *testing.T) {
+	exporter, err := newExporter("", "")
+	require.NoError(t, err)
+	assert.Nil(t, exporter)
+	exporter, err = newExporter("STDOUT", "")
+	require.NoError(t, err)
+	assert.IsType(t, &stdouttrace.Exporter{}, exporter)
+}
+
+func TestNewExporter_Otlp(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r
+	}))
+	defer server.Close()
+
+	exporter, err := newExporter(ExporterOtlp, server.URL+"/v1/traces")
+	require.NoError(t, err)
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	_, span := tp.Tracer("test").Start(context.Background(), "root")
+	span.End()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, tp.Shutdown(ctx))
+
+	r := <-received
+	assert.Equal(t, "/v1/traces", r.URL.Path)
+	assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+}
+
+func TestNewExporter_Zipkin(t *testing.T) {
+	received := make(chan []map[string]interface{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var spans []map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&spans)
+		received <- spans
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	exporter, err := newExporter(ExporterZipkin, server.URL)
+	require.NoError(t, err)
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	_, span := tp.Tracer("test").Start(context.Background(), "SELECT", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("db.statement", "select 1")))
+	span.End()
+
+	spans := <-received
+	require.Len(t, spans, 1)
+	assert.Equal(t, "select", spans[0]["name"])
+	assert.Equal(t, "CLIENT", spans[0]["kind"])
+	assert.Equal(t, "select 1", spans[0]["tags"].(map[string]interface{})["db.statement"])
+}
+
+// keptExporter keeps spans on shutdown
+type keptExporter struct {
+	*tracetest.InMemoryExporter
+}
+
+func (e keptExporter) Shutdown(context.Context) error {
+	return nil
+}
+
+func TestShutdown(t *testing.T) {
+	SetTracerProvider(trace.NewNoopTracerProvider())
+	defer SetTracerProvider(nil)
+	require.NoError(t, Shutdown(context.Background()))
+
+	exporter := keptExporter{tracetest.NewInMemoryExporter()}
+	SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter)))
+	_, span := Start(context.Background(), "root")
+	span.End()
+	assert.Empty(t, exporter.GetSpans())
+	require.NoError(t, Shutdown(context.Background()))
+	assert.Len(t, exporter.GetSpans(), 1)
+}